@@ -0,0 +1,468 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"mon-api/handlers"
+
+	"github.com/BurntSushi/toml"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/options"
+	"gopkg.in/yaml.v3"
+)
+
+// Configuration
+//
+// Settings come from, in increasing precedence: built-in defaults, an
+// optional TOML or YAML file named by -config or MON_CONFIG, MON_*
+// environment variables and command-line flags. Every setting has all
+// three names, derived from its file key:
+//
+//	file key             flag                   environment
+//	data_dir             -data-dir              MON_DATA_DIR
+//	badger.sync_writes   -badger-sync-writes    MON_BADGER_SYNC_WRITES
+//
+// Lists such as cors_origins are comma-separated in flags and environment
+// variables.
+
+// Config holds the server settings
+type Config struct {
+	Listen          string        `toml:"listen" yaml:"listen"`
+	DataDir         string        `toml:"data_dir" yaml:"data_dir"`
+	DistDir         string        `toml:"dist_dir" yaml:"dist_dir"`
+	LogLevel        string        `toml:"log_level" yaml:"log_level"`
+	CORSOrigins     []string      `toml:"cors_origins" yaml:"cors_origins"`
+	TrashRetention  time.Duration `toml:"trash_retention" yaml:"trash_retention"`
+	NoteRevisions   int           `toml:"note_revisions" yaml:"note_revisions"`
+	MaxBlobSize     int64         `toml:"max_blob_size" yaml:"max_blob_size"`
+	ShutdownTimeout time.Duration `toml:"shutdown_timeout" yaml:"shutdown_timeout"`
+	Badger          BadgerConfig  `toml:"badger" yaml:"badger"`
+	Auth            AuthConfig    `toml:"auth" yaml:"auth"`
+}
+
+// BadgerConfig tunes the database
+type BadgerConfig struct {
+	ValueLogFileSize int64         `toml:"value_log_file_size" yaml:"value_log_file_size"`
+	SyncWrites       bool          `toml:"sync_writes" yaml:"sync_writes"`
+	Compression      string        `toml:"compression" yaml:"compression"`
+	GCInterval       time.Duration `toml:"gc_interval" yaml:"gc_interval"`
+	GCDiscardRatio   float64       `toml:"gc_discard_ratio" yaml:"gc_discard_ratio"`
+}
+
+// AuthConfig controls logins
+type AuthConfig struct {
+	SessionTTL    time.Duration `toml:"session_ttl" yaml:"session_ttl"`
+	SecureCookies bool          `toml:"secure_cookies" yaml:"secure_cookies"`
+}
+
+// defaultConfig returns the settings used when nothing overrides them
+func defaultConfig() Config {
+	return Config{
+		Listen:          ":8081",
+		DataDir:         "./data",
+		DistDir:         "./dist",
+		LogLevel:        "info",
+		CORSOrigins:     []string{"http://localhost:5173"}, // the Vite dev server
+		TrashRetention:  30 * 24 * time.Hour,
+		NoteRevisions:   handlers.NoteRevisionLimit,
+		MaxBlobSize:     handlers.MaxBlobSize,
+		ShutdownTimeout: 30 * time.Second,
+		Badger: BadgerConfig{
+			ValueLogFileSize: 1<<30 - 1, // Badger's default
+			SyncWrites:       false,
+			Compression:      "snappy",
+			GCInterval:       10 * time.Minute,
+			GCDiscardRatio:   0.5,
+		},
+		Auth: AuthConfig{
+			SessionTTL:    handlers.SessionTTL,
+			SecureCookies: false,
+		},
+	}
+}
+
+// dbPath is where the Badger database lives
+func (c *Config) dbPath() string { return filepath.Join(c.DataDir, "bookmarks") }
+
+// blobDir is where attachment blobs are stored
+func (c *Config) blobDir() string { return filepath.Join(c.DataDir, "blobs") }
+
+// setting is one configurable value
+type setting struct {
+	key   string // file key, dotted inside sections
+	usage string
+	value settingValue
+}
+
+// settingValue reads and prints a setting in its flag and environment form
+type settingValue interface {
+	Set(s string) error
+	String() string
+}
+
+func (s setting) flagName() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(s.key)
+}
+
+func (s setting) envName() string {
+	return "MON_" + strings.ToUpper(strings.ReplaceAll(s.key, ".", "_"))
+}
+
+// settings lists the configurable values of c
+func (c *Config) settings() []setting {
+	return []setting{
+		{"listen", "address to listen on, host:port", (*stringValue)(&c.Listen)},
+		{"data_dir", "directory holding the database and attachments", (*stringValue)(&c.DataDir)},
+		{"dist_dir", "directory holding the React build", (*stringValue)(&c.DistDir)},
+		{"log_level", "least severe messages printed: debug, info, warn or error", (*stringValue)(&c.LogLevel)},
+		{"cors_origins", "origins allowed to call the API from a browser with cookies, comma-separated; * allows any origin, without cookies", (*listValue)(&c.CORSOrigins)},
+		{"trash_retention", "how long deleted items stay in the trash before they are purged (0 keeps them)", (*durationValue)(&c.TrashRetention)},
+		{"note_revisions", "earlier versions kept per note (0 keeps none)", (*intValue)(&c.NoteRevisions)},
+		{"max_blob_size", "largest accepted attachment upload in bytes", (*int64Value)(&c.MaxBlobSize)},
+		{"shutdown_timeout", "how long to wait for in-flight requests when stopping", (*durationValue)(&c.ShutdownTimeout)},
+		{"badger.value_log_file_size", "size of each Badger value log file in bytes", (*int64Value)(&c.Badger.ValueLogFileSize)},
+		{"badger.sync_writes", "sync every write to disk before it is acknowledged", (*boolValue)(&c.Badger.SyncWrites)},
+		{"badger.compression", "block compression: none, snappy or zstd", (*stringValue)(&c.Badger.Compression)},
+		{"badger.gc_interval", "how often to reclaim space in the value log (0 disables)", (*durationValue)(&c.Badger.GCInterval)},
+		{"badger.gc_discard_ratio", "share of garbage, 0 to 1, that makes a value log file worth rewriting", (*floatValue)(&c.Badger.GCDiscardRatio)},
+		{"auth.session_ttl", "how long a browser login lasts", (*durationValue)(&c.Auth.SessionTTL)},
+		{"auth.secure_cookies", "send the session cookie over HTTPS only; enable behind TLS", (*boolValue)(&c.Auth.SecureCookies)},
+	}
+}
+
+type stringValue string
+
+func (v *stringValue) Set(s string) error { *v = stringValue(s); return nil }
+func (v *stringValue) String() string     { return string(*v) }
+
+type intValue int
+
+func (v *intValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	*v = intValue(n)
+	return err
+}
+func (v *intValue) String() string { return strconv.Itoa(int(*v)) }
+
+type int64Value int64
+
+func (v *int64Value) Set(s string) error {
+	n, err := strconv.ParseInt(s, 10, 64)
+	*v = int64Value(n)
+	return err
+}
+func (v *int64Value) String() string { return strconv.FormatInt(int64(*v), 10) }
+
+type boolValue bool
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	*v = boolValue(b)
+	return err
+}
+func (v *boolValue) String() string   { return strconv.FormatBool(bool(*v)) }
+func (v *boolValue) IsBoolFlag() bool { return true }
+
+type floatValue float64
+
+func (v *floatValue) Set(s string) error {
+	f, err := strconv.ParseFloat(s, 64)
+	*v = floatValue(f)
+	return err
+}
+func (v *floatValue) String() string { return strconv.FormatFloat(float64(*v), 'f', -1, 64) }
+
+type durationValue time.Duration
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	*v = durationValue(d)
+	return err
+}
+func (v *durationValue) String() string { return time.Duration(*v).String() }
+
+type listValue []string
+
+func (v *listValue) Set(s string) error {
+	*v = nil
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*v = append(*v, item)
+		}
+	}
+	return nil
+}
+func (v *listValue) String() string { return strings.Join(*v, ",") }
+
+// flagValue records a flag until the file and environment have been applied
+type flagValue struct {
+	setting setting
+	def     string
+	raw     *[]string // name=value of every flag given, in order
+}
+
+func (f *flagValue) Set(s string) error {
+	// Check the value now so mistakes are reported like other flag errors
+	check := defaultConfig()
+	for _, st := range check.settings() {
+		if st.key == f.setting.key {
+			if err := st.value.Set(s); err != nil {
+				return err
+			}
+		}
+	}
+	*f.raw = append(*f.raw, f.setting.key+"="+s)
+	return nil
+}
+
+func (f *flagValue) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.def
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	_, ok := f.setting.value.(*boolValue)
+	return ok
+}
+
+// errFlagsReported means the command line was invalid and the error has
+// been printed
+var errFlagsReported = errors.New("invalid command line")
+
+// configSource names where each setting's value came from
+type configSource map[string]string
+
+// action is a one-off task asked for on the command line instead of
+// serving
+type action struct {
+	printConfig bool // -print-config
+	setPassword bool // -set-password
+}
+
+// loadConfig reads the configuration from args, the environment and the
+// file they name, and the action the command line asks for.
+func loadConfig(args []string) (cfg Config, sources configSource, act action, err error) {
+	cfg = defaultConfig()
+	sources = configSource{}
+
+	fs := flag.NewFlagSet("mon-api", flag.ContinueOnError)
+	configPath := fs.String("config", "", "TOML or YAML configuration file (also MON_CONFIG)")
+	fs.BoolVar(&act.printConfig, "print-config", false, "print the effective configuration and exit")
+	fs.BoolVar(&act.setPassword, "set-password", false, "read a new password from standard input, log out every session and exit")
+
+	var raw []string
+	defaults := defaultConfig()
+	for _, s := range defaults.settings() {
+		def := s.value.String()
+		if def == "false" {
+			def = "" // like flag.Bool, don't mention a false default
+		}
+		fs.Var(&flagValue{setting: s, def: def, raw: &raw}, s.flagName(), s.usage+" ("+s.envName()+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		if err != flag.ErrHelp {
+			err = errFlagsReported // the flag set has printed it with the usage
+		}
+		return cfg, sources, act, err
+	}
+	if fs.NArg() > 0 {
+		return cfg, sources, act, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	// File, then environment, then flags
+	path := *configPath
+	if path == "" {
+		path = os.Getenv("MON_CONFIG")
+	}
+	if path != "" {
+		keys, err := readConfigFile(path, &cfg)
+		if err != nil {
+			return cfg, sources, act, err
+		}
+		for _, key := range keys {
+			sources[key] = path
+		}
+	}
+
+	byKey := make(map[string]setting)
+	for _, s := range cfg.settings() {
+		byKey[s.key] = s
+		if v, ok := os.LookupEnv(s.envName()); ok {
+			if err := s.value.Set(v); err != nil {
+				return cfg, sources, act, fmt.Errorf("%s: %v", s.envName(), err)
+			}
+			sources[s.key] = s.envName()
+		}
+	}
+	for _, kv := range raw {
+		key, v, _ := strings.Cut(kv, "=")
+		s := byKey[key]
+		if err := s.value.Set(v); err != nil {
+			return cfg, sources, act, fmt.Errorf("-%s: %v", s.flagName(), err)
+		}
+		sources[key] = "-" + s.flagName()
+	}
+
+	return cfg, sources, act, cfg.validate()
+}
+
+// readConfigFile decodes a TOML or YAML file over cfg, chosen by the file
+// extension, and returns the keys it set. Unknown keys are an error.
+func readConfigFile(path string, cfg *Config) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		md, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("%s: unknown setting %q", path, undecoded[0].String())
+		}
+		for _, key := range md.Keys() {
+			keys = append(keys, key.String())
+		}
+
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		// Decode again loosely to learn which keys were present
+		var present map[string]any
+		if err := yaml.Unmarshal(data, &present); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		for key, v := range present {
+			if section, ok := v.(map[string]any); ok {
+				for sub := range section {
+					keys = append(keys, key+"."+sub)
+				}
+				continue
+			}
+			keys = append(keys, key)
+		}
+
+	default:
+		return nil, fmt.Errorf("%s: configuration files must end in .toml, .yaml or .yml", path)
+	}
+	return keys, nil
+}
+
+// validate checks settings that have a limited range
+func (c *Config) validate() error {
+	if c.Listen == "" {
+		return fmt.Errorf("listen must not be empty")
+	}
+	if c.DataDir == "" {
+		return fmt.Errorf("data_dir must not be empty")
+	}
+	if _, err := handlers.ParseLogLevel(c.LogLevel); err != nil {
+		return err
+	}
+	if c.TrashRetention < 0 {
+		return fmt.Errorf("trash_retention must not be negative")
+	}
+	if c.NoteRevisions < 0 {
+		return fmt.Errorf("note_revisions must not be negative")
+	}
+	if c.MaxBlobSize <= 0 {
+		return fmt.Errorf("max_blob_size must be positive")
+	}
+	if c.ShutdownTimeout <= 0 {
+		return fmt.Errorf("shutdown_timeout must be positive")
+	}
+	if size := c.Badger.ValueLogFileSize; size < 1<<20 || size >= 2<<30 {
+		return fmt.Errorf("badger.value_log_file_size must be at least 1 MiB and less than 2 GiB")
+	}
+	if _, err := badgerCompression(c.Badger.Compression); err != nil {
+		return err
+	}
+	if c.Badger.GCInterval < 0 {
+		return fmt.Errorf("badger.gc_interval must not be negative")
+	}
+	if r := c.Badger.GCDiscardRatio; r <= 0 || r >= 1 {
+		return fmt.Errorf("badger.gc_discard_ratio must be between 0 and 1")
+	}
+	if c.Auth.SessionTTL < time.Minute {
+		return fmt.Errorf("auth.session_ttl must be at least a minute")
+	}
+	return nil
+}
+
+// badgerCompression maps a compression name to Badger's option
+func badgerCompression(name string) (options.CompressionType, error) {
+	switch name {
+	case "none":
+		return options.None, nil
+	case "snappy":
+		return options.Snappy, nil
+	case "zstd":
+		return options.ZSTD, nil
+	}
+	return options.None, fmt.Errorf("badger.compression must be none, snappy or zstd")
+}
+
+// badgerOptions returns the database options for the configuration
+func (c *Config) badgerOptions() badger.Options {
+	compression, _ := badgerCompression(c.Badger.Compression) // checked by validate
+	opts := badger.DefaultOptions(c.dbPath()).
+		WithValueLogFileSize(c.Badger.ValueLogFileSize).
+		WithSyncWrites(c.Badger.SyncWrites).
+		WithCompression(compression)
+	opts.Logger = nil // Disable default logger to reduce noise
+	return opts
+}
+
+// printConfig writes the effective configuration as TOML, noting where each
+// value came from
+func printConfig(w io.Writer, cfg *Config, sources configSource) {
+	section := ""
+	for _, s := range cfg.settings() {
+		name := s.key
+		if sec, key, ok := strings.Cut(s.key, "."); ok {
+			if sec != section {
+				fmt.Fprintf(w, "\n[%s]\n", sec)
+				section = sec
+			}
+			name = key
+		}
+
+		var value string
+		switch v := s.value.(type) {
+		case *stringValue, *durationValue:
+			value = strconv.Quote(v.String())
+		case *listValue:
+			quoted := make([]string, len(*v))
+			for i, item := range *v {
+				quoted[i] = strconv.Quote(item)
+			}
+			value = "[" + strings.Join(quoted, ", ") + "]"
+		default:
+			value = v.String()
+		}
+
+		source := sources[s.key]
+		if source == "" {
+			source = "default"
+		}
+		fmt.Fprintf(w, "%s = %s # %s\n", name, value, source)
+	}
+}
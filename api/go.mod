@@ -3,8 +3,13 @@ module mon-api
 go 1.24.5
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/dgraph-io/badger/v4 v4.8.0
 	github.com/json-iterator/go v1.1.12
+	github.com/yuin/goldmark v1.8.2
+	golang.org/x/crypto v0.41.0
+	golang.org/x/net v0.43.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -21,7 +26,6 @@ require (
 	go.opentelemetry.io/otel v1.37.0 // indirect
 	go.opentelemetry.io/otel/metric v1.37.0 // indirect
 	go.opentelemetry.io/otel/trace v1.37.0 // indirect
-	golang.org/x/net v0.43.0 // indirect
 	golang.org/x/sys v0.35.0 // indirect
 	google.golang.org/protobuf v1.36.7 // indirect
 )
@@ -0,0 +1,749 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Authentication
+//
+// Mon has one user. Its password is kept as a bcrypt hash; until one is set,
+// POST /auth/setup sets it and every other API request is refused. The web
+// app logs in with the password and gets a session cookie; scripts use
+// named API tokens sent as "Authorization: Bearer <token>". Requests that
+// change data with a session cookie must echo the session's CSRF token in
+// the X-CSRF-Token header, which other sites can't read, so a page that
+// makes the browser send the cookie can't forge them. Bearer tokens aren't
+// sent by browsers on their own and need no CSRF token. Setup and login have
+// no session to hold a CSRF token, so they only take JSON, which a form on
+// another site can't send, and refuse browsers calling from other sites.
+//
+//	auth/password              bcrypt hash of the password
+//	auth/session/<sha256>      sessions by hash of their cookie, expiring via TTL
+//	auth/token/<id>            API tokens, holding the hash of their secret
+
+const (
+	authPasswordKey      = "auth/password"
+	authSessionKeyPrefix = "auth/session/"
+	authTokenKeyPrefix   = "auth/token/"
+)
+
+// SessionCookie is the name of the session cookie
+const SessionCookie = "mon_session"
+
+// CSRFHeader carries the CSRF token of cookie-authenticated writes
+const CSRFHeader = "X-CSRF-Token"
+
+// SessionTTL is how long a login lasts
+var SessionTTL = 30 * 24 * time.Hour
+
+// SecureCookies marks the session cookie Secure, for servers behind HTTPS
+var SecureCookies = false
+
+// TrustedOrigins are the other origins allowed to set the password and log
+// in, the CORS origins; "*" doesn't count
+var TrustedOrigins []string
+
+// bcryptCost is the work factor of password hashes
+const bcryptCost = 12
+
+// Password lengths; bcrypt ignores bytes past 72
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+// Login attempts allowed per client address within loginWindow; a successful
+// login starts the count again
+const (
+	maxLoginAttempts = 5
+	loginWindow      = time.Minute
+)
+
+var (
+	errNoPassword     = errors.New("no password set")
+	errWrongPassword  = errors.New("wrong password")
+	errPasswordExists = errors.New("password already set")
+)
+
+type storedPassword struct {
+	Hash      string    `json:"hash"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type session struct {
+	CSRFToken string    `json:"csrf_token"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type PasswordRequest struct {
+	Password string `json:"password"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// SessionInfo describes how the current request is authenticated
+type SessionInfo struct {
+	Authenticated bool       `json:"authenticated"`
+	SetupRequired bool       `json:"setup_required"`       // No password has been set yet
+	Method        string     `json:"method,omitempty"`     // session or token
+	CSRFToken     string     `json:"csrf_token,omitempty"` // Send as X-CSRF-Token with writes
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"` // When the session ends
+	TokenName     string     `json:"token_name,omitempty"` // Name of the API token used
+}
+
+type SessionResponse struct {
+	Success bool         `json:"success"`
+	Message string       `json:"message"`
+	Data    *SessionInfo `json:"data,omitempty"`
+}
+
+type AuthResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+// newSecret returns n random bytes in hex
+func newSecret(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand doesn't fail on supported platforms
+		panic("crypto/rand: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+// secretHash is the stored form of a session or token secret
+func secretHash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func validPassword(p string) error {
+	if len(p) < minPasswordLength {
+		return &patchError{"Password must be at least 8 characters"}
+	}
+	if len(p) > maxPasswordLength {
+		return &patchError{"Password must be at most 72 bytes"}
+	}
+	return nil
+}
+
+// PasswordSet reports whether a password has been set
+func PasswordSet(db *badger.DB) (bool, error) {
+	err := db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte(authPasswordKey))
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// checkPassword compares p with the stored password, returning
+// errNoPassword if none is set and errWrongPassword if it doesn't match
+func checkPassword(db *badger.DB, p string) error {
+	var stored storedPassword
+	err := db.View(func(txn *badger.Txn) error {
+		it, err := txn.Get([]byte(authPasswordKey))
+		if err != nil {
+			return err
+		}
+		return it.Value(func(val []byte) error { return json.Unmarshal(val, &stored) })
+	})
+	if err == badger.ErrKeyNotFound {
+		return errNoPassword
+	}
+	if err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(stored.Hash), []byte(p)) != nil {
+		return errWrongPassword
+	}
+	return nil
+}
+
+// hashPassword checks a new password and returns its stored form
+func hashPassword(p string) ([]byte, error) {
+	if err := validPassword(p); err != nil {
+		return nil, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(p), bcryptCost)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(storedPassword{Hash: string(hash), UpdatedAt: time.Now()})
+}
+
+// SetPassword replaces the password and ends every session. It returns a
+// *patchError if the password is too short or too long.
+func SetPassword(db *badger.DB, p string) error {
+	data, err := hashPassword(p)
+	if err != nil {
+		return err
+	}
+	if err := updateWithRetry(db, func(txn *badger.Txn) error {
+		return txn.Set([]byte(authPasswordKey), data)
+	}); err != nil {
+		return err
+	}
+	return db.DropPrefix([]byte(authSessionKeyPrefix))
+}
+
+// createSession stores a new session and returns its cookie value
+func createSession(db *badger.DB) (string, session, error) {
+	now := time.Now()
+	secret := newSecret(32)
+	s := session{CSRFToken: newSecret(32), CreatedAt: now, ExpiresAt: now.Add(SessionTTL)}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", s, err
+	}
+	err = updateWithRetry(db, func(txn *badger.Txn) error {
+		e := badger.NewEntry([]byte(authSessionKeyPrefix+secretHash(secret)), data).WithTTL(SessionTTL)
+		return txn.SetEntry(e)
+	})
+	return secret, s, err
+}
+
+// loadSession reads the session of a cookie value
+func loadSession(db *badger.DB, secret string) (session, error) {
+	var s session
+	err := db.View(func(txn *badger.Txn) error {
+		it, err := txn.Get([]byte(authSessionKeyPrefix + secretHash(secret)))
+		if err != nil {
+			return err
+		}
+		return it.Value(func(val []byte) error { return json.Unmarshal(val, &s) })
+	})
+	if err == nil && time.Now().After(s.ExpiresAt) {
+		err = badger.ErrKeyNotFound
+	}
+	return s, err
+}
+
+func deleteSession(db *badger.DB, secret string) error {
+	return updateWithRetry(db, func(txn *badger.Txn) error {
+		return txn.Delete([]byte(authSessionKeyPrefix + secretHash(secret)))
+	})
+}
+
+func setSessionCookie(w http.ResponseWriter, secret string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    secret,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   SecureCookies,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+func clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   SecureCookies,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// loginLimiter counts login attempts per client address. An attempt counts
+// from the moment it starts, so concurrent guesses can't all pass before the
+// first one fails, and a successful login clears the count.
+type loginLimiter struct {
+	mu        sync.Mutex
+	attempts  map[string][]time.Time
+	lastSweep time.Time
+}
+
+// attempt records a login attempt and reports whether the client may make it
+func (l *loginLimiter) attempt(client string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Forget addresses that haven't tried recently, so one-off clients don't
+	// pile up
+	if now.Sub(l.lastSweep) >= loginWindow {
+		for c, times := range l.attempts {
+			if now.Sub(times[len(times)-1]) >= loginWindow {
+				delete(l.attempts, c)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	recent := l.attempts[client][:0]
+	for _, t := range l.attempts[client] {
+		if now.Sub(t) < loginWindow {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= maxLoginAttempts {
+		l.attempts[client] = recent
+		return false
+	}
+	l.attempts[client] = append(recent, now)
+	return true
+}
+
+// succeeded clears the attempts of a client that logged in
+func (l *loginLimiter) succeeded(client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.attempts, client)
+}
+
+// clientAddress is the remote IP of a request
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// authContext is how a request was authenticated
+type authContext struct {
+	method  string // session or token
+	session session
+	secret  string // session cookie value
+	token   APIToken
+}
+
+// authenticate checks the session cookie or bearer token of a request. It
+// returns nil if the request carries neither or they aren't valid.
+func authenticate(db *badger.DB, r *http.Request) (*authContext, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		raw, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			return nil, nil
+		}
+		token, err := verifyToken(db, strings.TrimSpace(raw))
+		if err == badger.ErrKeyNotFound || err == errBadToken {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &authContext{method: "token", token: token}, nil
+	}
+
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil || cookie.Value == "" {
+		return nil, nil
+	}
+	s, err := loadSession(db, cookie.Value)
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &authContext{method: "session", session: s, secret: cookie.Value}, nil
+}
+
+// safeMethod reports whether a method only reads
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// crossSiteWrite tells why a login or setup request is refused, if it is: it
+// must be JSON and, when sent by a browser, come from this server's origin or
+// a trusted one
+func crossSiteWrite(r *http.Request) (int, string) {
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		return http.StatusUnsupportedMediaType, "Content-Type must be application/json"
+	}
+
+	origin := r.Header.Get("Origin")
+	trusted := origin != "" && slices.ContainsFunc(TrustedOrigins, func(o string) bool {
+		return strings.TrimSuffix(o, "/") == origin
+	})
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return 0, ""
+	case "":
+		// Older browsers only send the origin; other clients send neither
+		if origin == "" || trusted {
+			return 0, ""
+		}
+		if u, err := url.Parse(origin); err == nil && u.Host == r.Host {
+			return 0, ""
+		}
+	default:
+		if trusted {
+			return 0, ""
+		}
+	}
+	return http.StatusForbidden, "Cross-site requests can't log in"
+}
+
+// RequireAuth refuses requests without a valid session or API token, and
+// cookie-authenticated writes without the session's CSRF token
+func RequireAuth(db *badger.DB, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth, err := authenticate(db, r)
+		if err != nil {
+			writeJSONResponse(w, http.StatusInternalServerError, AuthResponse{
+				Success: false,
+				Message: "Error checking credentials",
+			})
+			return
+		}
+		if auth == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mon"`)
+			writeJSONResponse(w, http.StatusUnauthorized, AuthResponse{
+				Success: false,
+				Message: "Authentication required",
+			})
+			return
+		}
+
+		if auth.method == "session" && !safeMethod(r.Method) {
+			sent := r.Header.Get(CSRFHeader)
+			if sent == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(auth.session.CSRFToken)) != 1 {
+				writeJSONResponse(w, http.StatusForbidden, AuthResponse{
+					Success: false,
+					Message: "Missing or invalid CSRF token",
+				})
+				return
+			}
+		}
+
+		next(w, r)
+	}
+}
+
+// AuthHandler serves login, logout, password and API token endpoints
+type AuthHandler struct {
+	db     *badger.DB
+	logins loginLimiter
+}
+
+func NewAuthHandler(db *badger.DB) *AuthHandler {
+	return &AuthHandler{db: db, logins: loginLimiter{attempts: make(map[string][]time.Time)}}
+}
+
+// GetSession tells the web app whether it is logged in and hands it the
+// CSRF token of its session
+func (h *AuthHandler) GetSession(w http.ResponseWriter, r *http.Request) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	set, err := PasswordSet(h.db)
+	var auth *authContext
+	if err == nil {
+		auth, err = authenticate(h.db, r)
+	}
+	if err != nil {
+		response := SessionResponse{
+			Success: false,
+			Message: "Error checking credentials",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	info := SessionInfo{SetupRequired: !set}
+	if auth != nil {
+		info.Authenticated = true
+		info.Method = auth.method
+		if auth.method == "session" {
+			info.CSRFToken = auth.session.CSRFToken
+			info.ExpiresAt = &auth.session.ExpiresAt
+		} else {
+			info.TokenName = auth.token.Name
+		}
+	}
+
+	// Return success response
+	response := SessionResponse{
+		Success: true,
+		Message: "Session retrieved successfully",
+		Data:    &info,
+	}
+
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// Setup sets the first password and logs in. It is refused once a password
+// exists.
+func (h *AuthHandler) Setup(w http.ResponseWriter, r *http.Request) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	if status, message := crossSiteWrite(r); status != 0 {
+		response := SessionResponse{
+			Success: false,
+			Message: message,
+		}
+		writeJSONResponse(w, status, response)
+		return
+	}
+
+	var req PasswordRequest
+	if err := readJSONRequest(r, &req); err != nil {
+		response := SessionResponse{
+			Success: false,
+			Message: "Invalid JSON format",
+		}
+		writeJSONResponse(w, http.StatusBadRequest, response)
+		return
+	}
+	data, err := hashPassword(req.Password)
+	if err != nil {
+		var perr *patchError
+		if errors.As(err, &perr) {
+			response := SessionResponse{
+				Success: false,
+				Message: perr.msg,
+			}
+			writeJSONResponse(w, http.StatusBadRequest, response)
+			return
+		}
+
+		response := SessionResponse{
+			Success: false,
+			Message: "Error saving password",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	// Only the first password can be set without logging in
+	err = updateWithRetry(h.db, func(txn *badger.Txn) error {
+		if _, err := txn.Get([]byte(authPasswordKey)); err == nil {
+			return errPasswordExists
+		} else if err != badger.ErrKeyNotFound {
+			return err
+		}
+		return txn.Set([]byte(authPasswordKey), data)
+	})
+	if err != nil {
+		if err == errPasswordExists {
+			response := SessionResponse{
+				Success: false,
+				Message: "A password is already set; log in instead",
+			}
+			writeJSONResponse(w, http.StatusConflict, response)
+			return
+		}
+
+		response := SessionResponse{
+			Success: false,
+			Message: "Error saving password",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	h.startSession(w, "Password set successfully")
+}
+
+// Login checks the password and starts a session
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	if status, message := crossSiteWrite(r); status != 0 {
+		response := SessionResponse{
+			Success: false,
+			Message: message,
+		}
+		writeJSONResponse(w, status, response)
+		return
+	}
+
+	client := clientAddress(r)
+	if !h.logins.attempt(client, time.Now()) {
+		w.Header().Set("Retry-After", "60")
+		response := SessionResponse{
+			Success: false,
+			Message: "Too many failed logins; try again in a minute",
+		}
+		writeJSONResponse(w, http.StatusTooManyRequests, response)
+		return
+	}
+
+	var req PasswordRequest
+	if err := readJSONRequest(r, &req); err != nil {
+		response := SessionResponse{
+			Success: false,
+			Message: "Invalid JSON format",
+		}
+		writeJSONResponse(w, http.StatusBadRequest, response)
+		return
+	}
+
+	if err := checkPassword(h.db, req.Password); err != nil {
+		switch err {
+		case errNoPassword:
+			response := SessionResponse{
+				Success: false,
+				Message: "No password is set yet; set one first",
+			}
+			writeJSONResponse(w, http.StatusConflict, response)
+		case errWrongPassword:
+			response := SessionResponse{
+				Success: false,
+				Message: "Wrong password",
+			}
+			writeJSONResponse(w, http.StatusUnauthorized, response)
+		default:
+			response := SessionResponse{
+				Success: false,
+				Message: "Error checking password",
+			}
+			writeJSONResponse(w, http.StatusInternalServerError, response)
+		}
+		return
+	}
+
+	h.logins.succeeded(client)
+	h.startSession(w, "Logged in successfully")
+}
+
+// startSession creates a session, sets its cookie and returns its CSRF token
+func (h *AuthHandler) startSession(w http.ResponseWriter, message string) {
+	secret, s, err := createSession(h.db)
+	if err != nil {
+		response := SessionResponse{
+			Success: false,
+			Message: "Error creating session",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
+	setSessionCookie(w, secret, s.ExpiresAt)
+
+	// Return success response
+	response := SessionResponse{
+		Success: true,
+		Message: message,
+		Data: &SessionInfo{
+			Authenticated: true,
+			Method:        "session",
+			CSRFToken:     s.CSRFToken,
+			ExpiresAt:     &s.ExpiresAt,
+		},
+	}
+
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// Logout ends the current session
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	if cookie, err := r.Cookie(SessionCookie); err == nil && cookie.Value != "" {
+		if err := deleteSession(h.db, cookie.Value); err != nil {
+			response := AuthResponse{
+				Success: false,
+				Message: "Error ending session",
+			}
+			writeJSONResponse(w, http.StatusInternalServerError, response)
+			return
+		}
+	}
+	clearSessionCookie(w)
+
+	// Return success response
+	response := AuthResponse{
+		Success: true,
+		Message: "Logged out successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// ChangePassword replaces the password after checking the current one. Every
+// session ends; a cookie-authenticated caller gets a new one.
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	var req ChangePasswordRequest
+	if err := readJSONRequest(r, &req); err != nil {
+		response := SessionResponse{
+			Success: false,
+			Message: "Invalid JSON format",
+		}
+		writeJSONResponse(w, http.StatusBadRequest, response)
+		return
+	}
+
+	if err := checkPassword(h.db, req.CurrentPassword); err != nil {
+		if err == errWrongPassword || err == errNoPassword {
+			response := SessionResponse{
+				Success: false,
+				Message: "Current password is wrong",
+			}
+			writeJSONResponse(w, http.StatusForbidden, response)
+			return
+		}
+
+		response := SessionResponse{
+			Success: false,
+			Message: "Error checking password",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	if err := SetPassword(h.db, req.NewPassword); err != nil {
+		var perr *patchError
+		if errors.As(err, &perr) {
+			response := SessionResponse{
+				Success: false,
+				Message: perr.msg,
+			}
+			writeJSONResponse(w, http.StatusBadRequest, response)
+			return
+		}
+
+		response := SessionResponse{
+			Success: false,
+			Message: "Error saving password",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	if _, err := r.Cookie(SessionCookie); err == nil {
+		h.startSession(w, "Password changed successfully")
+		return
+	}
+
+	// Return success response
+	response := SessionResponse{
+		Success: true,
+		Message: "Password changed successfully",
+	}
+
+	writeJSONResponse(w, http.StatusOK, response)
+}
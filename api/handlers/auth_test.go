@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetupAndLoginRefuseCrossSiteRequests(t *testing.T) {
+	TrustedOrigins = []string{"http://localhost:5173/"}
+	t.Cleanup(func() { TrustedOrigins = nil })
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{"form post", map[string]string{"Content-Type": "text/plain", "Origin": "https://evil.example", "Sec-Fetch-Site": "cross-site"}, http.StatusUnsupportedMediaType},
+		{"urlencoded", map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, http.StatusUnsupportedMediaType},
+		{"no content type", map[string]string{}, http.StatusUnsupportedMediaType},
+		{"cross-site json", map[string]string{"Content-Type": "application/json", "Origin": "https://evil.example", "Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+		{"same-site json", map[string]string{"Content-Type": "application/json", "Origin": "http://evil.localhost:8080", "Sec-Fetch-Site": "same-site"}, http.StatusForbidden},
+		{"foreign origin only", map[string]string{"Content-Type": "application/json", "Origin": "https://evil.example"}, http.StatusForbidden},
+		{"null origin", map[string]string{"Content-Type": "application/json", "Origin": "null"}, http.StatusForbidden},
+		{"same origin", map[string]string{"Content-Type": "application/json; charset=utf-8", "Origin": "http://example.com", "Sec-Fetch-Site": "same-origin"}, http.StatusOK},
+		{"same host origin only", map[string]string{"Content-Type": "application/json", "Origin": "http://example.com"}, http.StatusOK},
+		{"trusted origin", map[string]string{"Content-Type": "application/json", "Origin": "http://localhost:5173", "Sec-Fetch-Site": "same-site"}, http.StatusOK},
+		{"script", map[string]string{"Content-Type": "application/json"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		// A fresh database each time, so setup always has a password to set
+		h := NewAuthHandler(openTestDB(t))
+		for _, step := range []struct {
+			name    string
+			handler http.HandlerFunc
+		}{{"setup", h.Setup}, {"login", h.Login}} {
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/auth/"+step.name, strings.NewReader(`{"password": "correct horse"}`))
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			step.handler(w, r)
+			if w.Code != tt.want {
+				t.Errorf("%s %s: status %d, want %d: %s", tt.name, step.name, w.Code, tt.want, w.Body.String())
+			}
+			if tt.want != http.StatusOK && w.Header().Get("Set-Cookie") != "" {
+				t.Errorf("%s %s: refused request got a session cookie", tt.name, step.name)
+			}
+		}
+	}
+}
+
+func TestLoginLimitsConcurrentGuesses(t *testing.T) {
+	db := openTestDB(t)
+	if err := SetPassword(db, "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	h := NewAuthHandler(db)
+
+	// Every guess starts before any bcrypt comparison finishes
+	const guesses = 20
+	codes := make(chan int, guesses)
+	var wg sync.WaitGroup
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", strings.NewReader(`{"password": "wrong guess"}`))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			h.Login(w, r)
+			codes <- w.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	counts := map[int]int{}
+	for code := range codes {
+		counts[code]++
+	}
+	if counts[http.StatusUnauthorized] != maxLoginAttempts || counts[http.StatusTooManyRequests] != guesses-maxLoginAttempts {
+		t.Errorf("statuses = %v, want %d checked and the rest refused", counts, maxLoginAttempts)
+	}
+}
+
+func TestLoginLimiter(t *testing.T) {
+	l := loginLimiter{attempts: make(map[string][]time.Time)}
+	now := time.Now()
+
+	for i := 0; i < maxLoginAttempts; i++ {
+		if !l.attempt("a", now) {
+			t.Fatalf("attempt %d refused", i+1)
+		}
+	}
+	if l.attempt("a", now) {
+		t.Error("attempt past the limit allowed")
+	}
+	if !l.attempt("b", now) {
+		t.Error("other address refused")
+	}
+	if !l.attempt("a", now.Add(loginWindow)) {
+		t.Error("attempt after the window refused")
+	}
+
+	// Logging in starts the count again
+	l.succeeded("a")
+	for i := 0; i < maxLoginAttempts; i++ {
+		if !l.attempt("a", now.Add(loginWindow)) {
+			t.Fatalf("attempt %d after logging in refused", i+1)
+		}
+	}
+
+	// Addresses that stopped trying are forgotten
+	for i := 0; i < 1000; i++ {
+		l.attempt("10.0.0."+strconv.Itoa(i), now.Add(loginWindow))
+	}
+	l.attempt("c", now.Add(3*loginWindow))
+	if len(l.attempts) != 1 {
+		t.Errorf("%d addresses remembered, want 1", len(l.attempts))
+	}
+}
@@ -0,0 +1,503 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Blob storage
+//
+// Attachment contents live on disk under BlobDir, named by their SHA-256 so
+// identical uploads are stored once:
+//
+//	<BlobDir>/<first two hex digits>/<sha256>
+//
+// Badger keeps what is known about each blob and who uses it:
+//
+//	blob/<sha256>                     size, content type and upload time
+//	attach/<type>/<id>                JSON list of the blobs an item attaches
+//	blobref/<sha256>/<type>/<id>      one empty key per attaching item
+//
+// The postings are the blob's reference count. They are replaced whenever an
+// item is written, kept while it is in the trash and dropped when it is
+// purged. Revisions don't hold references, so restoring a revision leaves out
+// attachments whose blob is gone. Blobs without references are deleted once
+// they are older than blobGracePeriod, which leaves time to attach a fresh
+// upload. Uploads and the sweeper hold blobFiles while they write or delete a
+// blob's file and description, so the sweeper never removes the file of a
+// blob uploaded again after it deleted the description.
+
+// BlobDir is where blob contents are stored. Set it before serving requests.
+var BlobDir = "./data/blobs"
+
+// MaxBlobSize is the largest accepted upload in bytes
+var MaxBlobSize int64 = 32 << 20
+
+const (
+	blobKeyPrefix    = "blob/"
+	attachKeyPrefix  = "attach/"
+	blobRefKeyPrefix = "blobref/"
+)
+
+// blobGracePeriod is how long an unreferenced blob is kept
+const blobGracePeriod = 24 * time.Hour
+
+// blobSweepInterval is how often unreferenced blobs are looked for
+const blobSweepInterval = time.Hour
+
+// blobFiles keeps a blob's file and description in step between uploads and
+// the sweeper
+var blobFiles sync.Mutex
+
+var (
+	errBlobNotFound = errors.New("blob not found")
+	errBlobTooLarge = errors.New("blob exceeds the size limit")
+)
+
+// Blob describes stored content
+type Blob struct {
+	SHA256      string    `json:"sha256"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Attachment is a blob attached to an item under a file name. Size and
+// content type are filled in from the blob when the item is saved.
+type Attachment struct {
+	Blob        string `json:"blob"` // SHA-256 of the content
+	Name        string `json:"name,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+}
+
+type BlobResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Data    *Blob  `json:"data,omitempty"`
+}
+
+// attacher is implemented by items that can carry attachments
+type attacher interface {
+	attachmentList() []Attachment
+	setAttachmentList(list []Attachment)
+}
+
+func blobKey(sha string) []byte { return []byte(blobKeyPrefix + sha) }
+
+func attachKey(kind, id string) []byte { return []byte(attachKeyPrefix + kind + "/" + id) }
+
+func blobRefPrefix(sha string) []byte { return []byte(blobRefKeyPrefix + sha + "/") }
+
+func blobRefKey(sha, kind, id string) []byte {
+	return append(blobRefPrefix(sha), kind+"/"+id...)
+}
+
+// blobPath returns where a blob's content is stored
+func blobPath(sha string) string {
+	return filepath.Join(BlobDir, sha[:2], sha)
+}
+
+// validBlobID reports whether s is a lowercase hex SHA-256
+func validBlobID(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !('0' <= s[i] && s[i] <= '9' || 'a' <= s[i] && s[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// saveBlob stores content read from r, at most MaxBlobSize bytes, and
+// returns its description. contentType is detected from the content when it
+// is empty or generic.
+func saveBlob(db *badger.DB, r io.Reader, contentType string) (Blob, error) {
+	var blob Blob
+	tmpDir := filepath.Join(BlobDir, "tmp")
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return blob, err
+	}
+	tmp, err := os.CreateTemp(tmpDir, "upload-*")
+	if err != nil {
+		return blob, err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	// Hash while copying; one byte past the limit means the upload is too big
+	h := sha256.New()
+	var sniff [512]byte
+	head := 0
+	n, err := io.Copy(io.MultiWriter(tmp, h, writerFunc(func(p []byte) (int, error) {
+		head += copy(sniff[head:], p)
+		return len(p), nil
+	})), io.LimitReader(r, MaxBlobSize+1))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return blob, err
+	}
+	if n > MaxBlobSize {
+		return blob, errBlobTooLarge
+	}
+
+	// Clients without a better idea send one of the generic types
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "application/octet-stream" || mediaType == "application/x-www-form-urlencoded" {
+		contentType = http.DetectContentType(sniff[:head])
+	}
+	blob = Blob{
+		SHA256:      hex.EncodeToString(h.Sum(nil)),
+		Size:        n,
+		ContentType: contentType,
+		CreatedAt:   time.Now(),
+	}
+
+	blobFiles.Lock()
+	defer blobFiles.Unlock()
+	if err := os.MkdirAll(filepath.Dir(blobPath(blob.SHA256)), 0755); err != nil {
+		return blob, err
+	}
+	if err := os.Rename(tmp.Name(), blobPath(blob.SHA256)); err != nil {
+		return blob, err
+	}
+
+	// Keep the first upload's description; refresh its time so a re-upload
+	// of an unreferenced blob gets a new grace period
+	err = updateWithRetry(db, func(txn *badger.Txn) error {
+		if existing, err := getBlob(txn, blob.SHA256); err == nil {
+			existing.CreatedAt = blob.CreatedAt
+			blob = existing
+		} else if err != errBlobNotFound {
+			return err
+		}
+		data, err := json.Marshal(blob)
+		if err != nil {
+			return err
+		}
+		return txn.Set(blobKey(blob.SHA256), data)
+	})
+	return blob, err
+}
+
+// writerFunc adapts a function to io.Writer
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+// getBlob reads a blob's description, returning errBlobNotFound if there is
+// none
+func getBlob(txn *badger.Txn, sha string) (Blob, error) {
+	var blob Blob
+	if !validBlobID(sha) {
+		return blob, errBlobNotFound
+	}
+	it, err := txn.Get(blobKey(sha))
+	if err == badger.ErrKeyNotFound {
+		return blob, errBlobNotFound
+	}
+	if err != nil {
+		return blob, err
+	}
+	err = it.Value(func(val []byte) error { return json.Unmarshal(val, &blob) })
+	return blob, err
+}
+
+// resolveAttachments checks an item's attachments against the stored blobs,
+// filling in their size and content type. Unknown blobs are an error, or are
+// dropped if dropMissing is set.
+func (s *store[T, P]) resolveAttachments(txn *badger.Txn, item P, dropMissing bool) error {
+	a, ok := any(item).(attacher)
+	if !ok {
+		return nil
+	}
+
+	list := a.attachmentList()
+	resolved := make([]Attachment, 0, len(list))
+	seen := make(map[string]bool, len(list))
+	for _, att := range list {
+		att.Blob = strings.ToLower(strings.TrimSpace(att.Blob))
+		blob, err := getBlob(txn, att.Blob)
+		if err == errBlobNotFound {
+			if dropMissing {
+				continue
+			}
+			return &patchError{"Unknown attachment blob '" + att.Blob + "'"}
+		}
+		if err != nil {
+			return err
+		}
+		if seen[att.Blob] {
+			continue
+		}
+		seen[att.Blob] = true
+
+		att.Size = blob.Size
+		att.ContentType = blob.ContentType
+		if att.Name == "" {
+			att.Name = att.Blob[:12]
+		}
+		resolved = append(resolved, att)
+	}
+	if len(resolved) == 0 {
+		resolved = nil
+	}
+	a.setAttachmentList(resolved)
+	return nil
+}
+
+// updateBlobRefs replaces the blob references of an item with blobs
+func updateBlobRefs(txn *badger.Txn, kind, id string, blobs []string) error {
+	return replacePostings(txn, attachKey(kind, id), func(sha string) []byte {
+		return blobRefKey(sha, kind, id)
+	}, blobs)
+}
+
+// writeBlobRefs updates the blob references of an item that can carry
+// attachments
+func (s *store[T, P]) writeBlobRefs(txn *badger.Txn, item P) error {
+	a, ok := any(item).(attacher)
+	if !ok {
+		return nil
+	}
+	var blobs []string
+	for _, att := range a.attachmentList() {
+		blobs = append(blobs, att.Blob)
+	}
+	return updateBlobRefs(txn, s.kind, item.indexID(), blobs)
+}
+
+// blobReferenced reports whether any item references a blob
+func blobReferenced(txn *badger.Txn, sha string) bool {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = blobRefPrefix(sha)
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	it.Rewind()
+	return it.Valid()
+}
+
+// sweepBlobs deletes blobs that no item references and that were uploaded
+// before cutoff, returning how many were deleted
+func sweepBlobs(db *badger.DB, cutoff time.Time) (int, error) {
+	var candidates []string
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(blobKeyPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			var blob Blob
+			if err := it.Item().Value(func(val []byte) error { return json.Unmarshal(val, &blob) }); err != nil {
+				continue
+			}
+			if blob.CreatedAt.Before(cutoff) && !blobReferenced(txn, blob.SHA256) {
+				candidates = append(candidates, blob.SHA256)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, sha := range candidates {
+		removed, err := sweepBlob(db, sha, cutoff)
+		if err == errBlobNotFound {
+			continue
+		}
+		if err != nil {
+			return deleted, err
+		}
+		if removed {
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// sweepBlob deletes a blob if it is still unreferenced and uploaded before
+// cutoff, reporting whether it did
+func sweepBlob(db *badger.DB, sha string, cutoff time.Time) (bool, error) {
+	// An upload of the same content waits until the file is gone, then
+	// writes it again
+	blobFiles.Lock()
+	defer blobFiles.Unlock()
+
+	// Check again in the deleting transaction; an item may have attached
+	// the blob since
+	removed := false
+	err := updateWithRetry(db, func(txn *badger.Txn) error {
+		removed = false
+		blob, err := getBlob(txn, sha)
+		if err != nil {
+			return err
+		}
+		if !blob.CreatedAt.Before(cutoff) || blobReferenced(txn, sha) {
+			return nil
+		}
+		removed = true
+		return txn.Delete(blobKey(sha))
+	})
+	if err != nil || !removed {
+		return false, err
+	}
+	if err := os.Remove(blobPath(sha)); err != nil && !os.IsNotExist(err) {
+		Warnf("failed to remove blob file %s: %v", sha, err)
+	}
+	return true, nil
+}
+
+// SweepBlobsPeriodically deletes unreferenced blobs every hour until ctx is
+// cancelled
+func SweepBlobsPeriodically(ctx context.Context, db *badger.DB) {
+	ticker := time.NewTicker(blobSweepInterval)
+	defer ticker.Stop()
+	for {
+		n, err := sweepBlobs(db, time.Now().Add(-blobGracePeriod))
+		if err != nil {
+			Warnf("failed to sweep unreferenced blobs: %v", err)
+		} else if n > 0 {
+			Infof("🧹 Deleted %d unreferenced blob(s)", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// BlobHandler serves blob uploads and downloads
+type BlobHandler struct {
+	db *badger.DB
+}
+
+func NewBlobHandler(db *badger.DB) *BlobHandler {
+	return &BlobHandler{db: db}
+}
+
+// UploadBlob stores the request body, or the "file" field of a multipart
+// form, as a blob
+func (h *BlobHandler) UploadBlob(w http.ResponseWriter, r *http.Request) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	// Read the content from the body or the multipart file field
+	body := io.Reader(r.Body)
+	contentType := r.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "multipart/form-data") {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			response := BlobResponse{
+				Success: false,
+				Message: "Invalid multipart form",
+			}
+			writeJSONResponse(w, http.StatusBadRequest, response)
+			return
+		}
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				response := BlobResponse{
+					Success: false,
+					Message: "Missing file field",
+				}
+				writeJSONResponse(w, http.StatusBadRequest, response)
+				return
+			}
+			if part.FormName() == "file" {
+				body = part
+				contentType = part.Header.Get("Content-Type")
+				break
+			}
+		}
+	}
+
+	blob, err := saveBlob(h.db, body, contentType)
+	if err != nil {
+		if err == errBlobTooLarge {
+			response := BlobResponse{
+				Success: false,
+				Message: fmt.Sprintf("Uploads are limited to %d bytes", MaxBlobSize),
+			}
+			writeJSONResponse(w, http.StatusRequestEntityTooLarge, response)
+			return
+		}
+
+		response := BlobResponse{
+			Success: false,
+			Message: "Error saving upload",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	// Return success response
+	response := BlobResponse{
+		Success: true,
+		Message: "Blob stored successfully",
+		Data:    &blob,
+	}
+
+	writeJSONResponse(w, http.StatusCreated, response)
+}
+
+// GetBlob streams a blob, honoring Range and conditional requests
+func (h *BlobHandler) GetBlob(w http.ResponseWriter, r *http.Request) {
+	sha := r.PathValue("sha")
+
+	var blob Blob
+	err := h.db.View(func(txn *badger.Txn) error {
+		var err error
+		blob, err = getBlob(txn, sha)
+		return err
+	})
+	var f *os.File
+	if err == nil {
+		f, err = os.Open(blobPath(sha))
+	}
+	if err != nil {
+		status, message := http.StatusInternalServerError, "Error reading blob"
+		if err == errBlobNotFound || os.IsNotExist(err) {
+			status, message = http.StatusNotFound, "Blob not found"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		writeJSONResponse(w, status, BlobResponse{Success: false, Message: message})
+		return
+	}
+	defer f.Close()
+
+	// Content never changes for a hash; uploads are served inertly so an
+	// HTML or SVG file can't run script on this origin
+	w.Header().Set("Content-Type", blob.ContentType)
+	w.Header().Set("ETag", `"`+blob.SHA256+`"`)
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	if name := r.URL.Query().Get("name"); name != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": name}))
+	}
+
+	http.ServeContent(w, r, "", blob.CreatedAt, f)
+}
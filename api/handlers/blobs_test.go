@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func TestReuploadWaitsForSweeper(t *testing.T) {
+	db := openTestDB(t)
+	BlobDir = t.TempDir()
+	const content = "scanned receipt"
+	blob, err := saveBlob(db, strings.NewReader(content), "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The sweeper has deleted the description but not yet the file
+	blobFiles.Lock()
+	if err := db.Update(func(txn *badger.Txn) error { return txn.Delete(blobKey(blob.SHA256)) }); err != nil {
+		t.Fatal(err)
+	}
+	uploaded := make(chan error, 1)
+	go func() {
+		_, err := saveBlob(db, strings.NewReader(content), "text/plain")
+		uploaded <- err
+	}()
+	select {
+	case err := <-uploaded:
+		t.Fatalf("upload finished while the sweeper was deleting the blob: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	os.Remove(blobPath(blob.SHA256))
+	blobFiles.Unlock()
+
+	if err := <-uploaded; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(blobPath(blob.SHA256)); err != nil {
+		t.Errorf("re-uploaded blob has no file: %v", err)
+	}
+	db.View(func(txn *badger.Txn) error {
+		if _, err := getBlob(txn, blob.SHA256); err != nil {
+			t.Errorf("re-uploaded blob has no description: %v", err)
+		}
+		return nil
+	})
+}
+
+func TestSweepBlobs(t *testing.T) {
+	db := openTestDB(t)
+	BlobDir = t.TempDir()
+	s := newNoteStore(db)
+
+	kept, err := saveBlob(db, strings.NewReader("attached"), "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.create(&Note{Title: "Receipt", Description: "<p>x</p>", Attachments: []Attachment{{Blob: kept.SHA256}}}); err != nil {
+		t.Fatal(err)
+	}
+	orphan, err := saveBlob(db, strings.NewReader("orphan"), "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		cutoff time.Time
+		want   int
+	}{
+		{"within grace period", time.Now().Add(-time.Hour), 0},
+		{"expired", time.Now().Add(time.Hour), 1},
+		{"already swept", time.Now().Add(time.Hour), 0},
+	}
+	for _, tt := range tests {
+		if n, err := sweepBlobs(db, tt.cutoff); err != nil || n != tt.want {
+			t.Errorf("%s: sweepBlobs = %d, %v; want %d", tt.name, n, err, tt.want)
+		}
+	}
+
+	for sha, want := range map[string]bool{kept.SHA256: true, orphan.SHA256: false} {
+		if _, err := os.Stat(blobPath(sha)); (err == nil) != want {
+			t.Errorf("blob %s: file kept = %v, want %v", sha, err == nil, want)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Bulk operations
+//
+// POST /api/v1/{bookmarks,notes,youtube}/bulk applies a list of operations
+// to many items in one transaction:
+//
+//	{"operations": [
+//	  {"op": "add_tags", "ids": ["bookmark_01J...", "bookmark_01K..."], "tags": ["go"]},
+//	  {"op": "set", "ids": ["bookmark_01J..."], "fields": {"title": "Renamed"}},
+//	  {"op": "delete", "ids": ["bookmark_01M..."]}
+//	]}
+//
+// Operations run in order, so later ones see the effect of earlier ones, and
+// deleted items go to the trash as with DELETE. An item that can't be
+// changed (missing, or invalid after the change) fails on its own and is
+// reported in the results; the rest are still applied. Tag postings and the
+// search index are updated per item, but the tag counters are written once
+// for the whole request.
+
+// Bulk operation names
+const (
+	bulkDelete      = "delete"
+	bulkAddTags     = "add_tags"
+	bulkRemoveTags  = "remove_tags"
+	bulkReplaceTags = "replace_tags"
+	bulkSet         = "set"
+)
+
+// maxBulkItems bounds the item changes in one bulk request
+const maxBulkItems = 1000
+
+type BulkOperation struct {
+	Op     string                 `json:"op"`               // delete, add_tags, remove_tags, replace_tags or set
+	IDs    []string               `json:"ids"`              // Items to apply the operation to
+	Tags   []string               `json:"tags,omitempty"`   // Tags for add_tags, remove_tags and replace_tags
+	Fields map[string]interface{} `json:"fields,omitempty"` // JSON Merge Patch of the fields for set
+}
+
+type BulkRequest struct {
+	Operations []BulkOperation `json:"operations"`
+}
+
+type BulkResult struct {
+	Op      string `json:"op"`
+	ID      string `json:"id"`
+	Success bool   `json:"success"`
+	Message string `json:"message,omitempty"` // Why the item failed
+	Version int64  `json:"version,omitempty"` // New version of a changed item
+}
+
+type BulkResponse struct {
+	Success bool         `json:"success"`
+	Message string       `json:"message"`
+	Data    []BulkResult `json:"data,omitempty"`
+	Count   int          `json:"count"`  // Item changes attempted
+	Failed  int          `json:"failed"` // Item changes that failed
+}
+
+// validateBulk checks the shape of a bulk request before anything is applied
+func validateBulk(req *BulkRequest) error {
+	if len(req.Operations) == 0 {
+		return &patchError{"At least one operation is required"}
+	}
+	items := 0
+	for i, op := range req.Operations {
+		where := "Operation " + strconv.Itoa(i+1) + ": "
+		switch op.Op {
+		case bulkDelete, bulkAddTags, bulkRemoveTags, bulkReplaceTags:
+		case bulkSet:
+			if len(op.Fields) == 0 {
+				return &patchError{where + "'set' needs fields"}
+			}
+			if err := checkWritable(op.Fields); err != nil {
+				return &patchError{where + err.Error()}
+			}
+		default:
+			return &patchError{where + "unknown op '" + op.Op + "'"}
+		}
+		if len(op.IDs) == 0 {
+			return &patchError{where + "ids are required"}
+		}
+		items += len(op.IDs)
+	}
+	if items > maxBulkItems {
+		return &patchError{"At most " + strconv.Itoa(maxBulkItems) + " item changes are allowed per request"}
+	}
+	return nil
+}
+
+// bulk applies a validated bulk request in one transaction. validate checks
+// items changed by tag and set operations like a PATCH would.
+func (s *store[T, P]) bulk(req *BulkRequest, validate func(item P) error) ([]BulkResult, error) {
+	aliases := s.aliasMap()
+
+	var results []BulkResult
+	err := updateWithRetry(s.db, func(txn *badger.Txn) error {
+		results = results[:0]
+		var oldTags, newTags []string
+		now := time.Now()
+
+		for _, op := range req.Operations {
+			for _, id := range op.IDs {
+				result := BulkResult{Op: op.Op, ID: id}
+
+				existing, err := s.get(txn, id)
+				if err == badger.ErrKeyNotFound {
+					result.Message = "Not found"
+					results = append(results, result)
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				before := P(&existing).searchTags()
+
+				if op.Op == bulkDelete {
+					if err := s.moveToTrash(txn, id, existing, now); err != nil {
+						return err
+					}
+					oldTags = append(oldTags, before...)
+					result.Success = true
+					results = append(results, result)
+					continue
+				}
+
+				updated, err := s.bulkChange(existing, op, aliases, validate)
+				if err == nil {
+					err = s.resolveAttachments(txn, P(&updated), false)
+				}
+				var perr *patchError
+				if errors.As(err, &perr) {
+					result.Message = perr.msg
+					results = append(results, result)
+					continue
+				}
+				if err != nil {
+					return err
+				}
+
+				if err := s.recordRevision(txn, existing); err != nil {
+					return err
+				}
+				item := P(&updated)
+				item.setVersion(P(&existing).version() + 1)
+				item.setUpdatedAt(now)
+				if err := s.write(txn, item); err != nil {
+					return err
+				}
+				after := item.searchTags()
+				if err := s.tagIdx.update(txn, id, before, after); err != nil {
+					return err
+				}
+				oldTags = append(oldTags, before...)
+				newTags = append(newTags, after...)
+
+				result.Success = true
+				result.Version = item.version()
+				results = append(results, result)
+			}
+		}
+
+		// One counter update for the net tag changes of all items
+		return s.updateTagCounts(txn, oldTags, newTags)
+	})
+	return results, err
+}
+
+// bulkChange applies a tag or set operation to a copy of an item
+func (s *store[T, P]) bulkChange(existing T, op BulkOperation, aliases map[string]string, validate func(item P) error) (T, error) {
+	updated := existing
+	if op.Op == bulkSet {
+		var err error
+		if updated, err = mergeItem(existing, op.Fields); err != nil {
+			return updated, err
+		}
+	}
+
+	item := P(&updated)
+	tags := item.searchTags()
+	switch op.Op {
+	case bulkAddTags:
+		tags = applyTagOperations(tags, TagOperations{AddTags: op.Tags})
+	case bulkRemoveTags:
+		tags = applyTagOperations(tags, TagOperations{RemoveTags: op.Tags})
+	case bulkReplaceTags:
+		tags = applyTagOperations(nil, TagOperations{AddTags: op.Tags})
+	}
+	item.setTags(normalizeTags(tags, aliases))
+	return updated, validate(item)
+}
+
+// handleBulk serves a bulk request for one item type
+func handleBulk[T any, P itemPtr[T]](w http.ResponseWriter, r *http.Request, s *store[T, P], validate func(item P) error) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	// Parse and check the operations
+	var req BulkRequest
+	if err := readJSONRequest(r, &req); err != nil {
+		response := BulkResponse{
+			Success: false,
+			Message: "Invalid JSON format",
+		}
+		writeJSONResponse(w, http.StatusBadRequest, response)
+		return
+	}
+	if err := validateBulk(&req); err != nil {
+		response := BulkResponse{
+			Success: false,
+			Message: err.Error(),
+		}
+		writeJSONResponse(w, http.StatusBadRequest, response)
+		return
+	}
+
+	// Apply them in one transaction
+	results, err := s.bulk(&req, validate)
+	if err != nil {
+		status := http.StatusInternalServerError
+		message := "Error applying bulk operations"
+		if err == badger.ErrTxnTooBig {
+			status = http.StatusRequestEntityTooLarge
+			message = "Too many changes for one request; split the operations"
+		}
+		response := BulkResponse{
+			Success: false,
+			Message: message,
+		}
+		writeJSONResponse(w, status, response)
+		return
+	}
+
+	// Return per-item results
+	failed := 0
+	for _, res := range results {
+		if !res.Success {
+			failed++
+		}
+	}
+	response := BulkResponse{
+		Success: failed == 0,
+		Message: "Bulk operations applied",
+		Data:    results,
+		Count:   len(results),
+		Failed:  failed,
+	}
+	if failed > 0 {
+		response.Message = strconv.Itoa(failed) + " of " + strconv.Itoa(len(results)) + " item changes failed"
+	}
+
+	writeJSONResponse(w, http.StatusOK, response)
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// serveBulk posts a bulk request to a note store
+func serveBulk(t *testing.T, h *NoteHandler, body string) (*httptest.ResponseRecorder, BulkResponse) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/notes/bulk", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.BulkNotes(w, r)
+
+	var resp BulkResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+	return w, resp
+}
+
+func TestBulkOperations(t *testing.T) {
+	db := openTestDB(t)
+	h := NewNoteHandler(db)
+
+	notes := map[string]*Note{
+		"a": {Title: "A", Description: "<p>a</p>", Tags: []string{"go"}},
+		"b": {Title: "B", Description: "<p>b</p>", Tags: []string{"go", "web"}},
+		"c": {Title: "C", Description: "<p>c</p>", Tags: []string{"draft"}},
+	}
+	for _, n := range notes {
+		if err := h.store.create(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, b, c := notes["a"].ID, notes["b"].ID, notes["c"].ID
+
+	// Later operations see earlier ones: a is tagged, then deleted, then
+	// can't be tagged again. b gains and loses a tag that never reaches
+	// the counters.
+	body := `{"operations": [
+		{"op": "add_tags", "ids": ["` + a + `", "` + b + `", "note_missing"], "tags": ["temp"]},
+		{"op": "delete", "ids": ["` + a + `"]},
+		{"op": "add_tags", "ids": ["` + a + `"], "tags": ["late"]},
+		{"op": "remove_tags", "ids": ["` + b + `"], "tags": ["go", "temp"]},
+		{"op": "replace_tags", "ids": ["` + c + `"], "tags": ["go"]},
+		{"op": "set", "ids": ["` + c + `"], "fields": {"title": ""}}
+	]}`
+	w, resp := serveBulk(t, h, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("bulk: status %d: %s", w.Code, w.Body.String())
+	}
+
+	want := []BulkResult{
+		{Op: "add_tags", ID: a, Success: true, Version: 2},
+		{Op: "add_tags", ID: b, Success: true, Version: 2},
+		{Op: "add_tags", ID: "note_missing", Message: "Not found"},
+		{Op: "delete", ID: a, Success: true},
+		{Op: "add_tags", ID: a, Message: "Not found"},
+		{Op: "remove_tags", ID: b, Success: true, Version: 3},
+		{Op: "replace_tags", ID: c, Success: true, Version: 2},
+		{Op: "set", ID: c, Message: "Title is required"},
+	}
+	if !slices.Equal(resp.Data, want) {
+		t.Errorf("results:\n got %+v\nwant %+v", resp.Data, want)
+	}
+	if resp.Success || resp.Count != len(want) || resp.Failed != 3 {
+		t.Errorf("success %v, count %d, failed %d; want false, %d, 3", resp.Success, resp.Count, resp.Failed, len(want))
+	}
+
+	// The counters hold the net change: a's tags left with it, b kept only
+	// web, c swapped draft for go, and temp came and went
+	tags, err := h.store.tagList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(tags)
+	if got := strings.Join(tags, " "); got != "go,1 web,1" {
+		t.Errorf("tags = %q, want %q", got, "go,1 web,1")
+	}
+
+	// The failed set left c as the replace_tags made it
+	_, got := serveNote(t, h.GetNote, http.MethodGet, "/api/v1/notes/"+c, c, "")
+	if got.Data.Title != "C" || !slices.Equal(got.Data.Tags, []string{"go"}) {
+		t.Errorf("note c = %q %v, want C [go]", got.Data.Title, got.Data.Tags)
+	}
+}
+
+func TestBulkTooLargeForOneTransaction(t *testing.T) {
+	db := openTestDB(t)
+	h := NewNoteHandler(db)
+
+	// Rewriting the search index entries of many long notes needs more
+	// than one transaction holds
+	words := func(prefix string) string {
+		var sb strings.Builder
+		for i := 0; i < 1500; i++ {
+			sb.WriteString(" " + prefix + strconv.Itoa(i))
+		}
+		return sb.String()
+	}
+	old := words("old")
+	var ids []string
+	for i := 0; i < 200; i++ {
+		n := &Note{Title: "Note " + strconv.Itoa(i), Description: "<p>" + old + "</p>"}
+		if err := h.store.create(n); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, `"`+n.ID+`"`)
+	}
+
+	body := `{"operations": [{"op": "set", "ids": [` + strings.Join(ids, ", ") + `], "fields": {"description": "<p>` + words("new") + `</p>"}}]}`
+	w, resp := serveBulk(t, h, body)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("bulk: status %d, want 413: %s", w.Code, w.Body.String())
+	}
+	if resp.Message != "Too many changes for one request; split the operations" {
+		t.Errorf("message = %q", resp.Message)
+	}
+
+	// Nothing was applied
+	id := strings.Trim(ids[0], `"`)
+	_, got := serveNote(t, h.GetNote, http.MethodGet, "/api/v1/notes/"+id, id, "")
+	if got.Data.Description != "<p>"+old+"</p>" || got.Data.Version != 1 {
+		t.Errorf("note changed to version %d", got.Data.Version)
+	}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Conditional requests
+//
+// Every item carries a version that increases with each write. Single-item
+// responses carry an ETag derived from it, so clients can revalidate a cached
+// copy with If-None-Match and get a bodiless 304 Not Modified when the item
+// hasn't changed.
+//
+// Edits are guarded the other way round: PUT, PATCH and DELETE honor
+// If-Match and fail with 412 Precondition Failed when the item changed since
+// the client loaded it. A "version" in the request body is checked the same
+// way and fails with 409 Conflict. Both failures return the server copy so
+// the client can show the conflict.
+
+// itemETag returns the entity tag of an item version
+func itemETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// renderedETag is the ETag of an item whose description was rendered as
+// HTML. It differs from itemETag so a cached rendering never validates the
+// stored text, or the other way round.
+func renderedETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `-html"`
+}
+
+// etagMatches reports whether an If-None-Match style header lists etag.
+// Comparison is weak, as RFC 9110 requires for If-None-Match.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified sets the ETag header and, when the request's If-None-Match
+// already lists it, writes 304 Not Modified. It returns true if the response
+// has been written.
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// ifMatchSatisfied reports whether an If-Match header lists etag. Comparison
+// is strong, as RFC 9110 requires for If-Match, so weak tags never match.
+func ifMatchSatisfied(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// precondition is the item version an edit expects to replace
+type precondition struct {
+	ifMatch string // If-Match header, empty if absent
+	version int64  // version from the request body, 0 if absent
+}
+
+// requestPrecondition returns the If-Match precondition of a request
+func requestPrecondition(r *http.Request) precondition {
+	return precondition{ifMatch: r.Header.Get("If-Match")}
+}
+
+// check returns the status to fail with if the stored version doesn't meet
+// the precondition, or 0 if the edit may proceed
+func (pre precondition) check(version int64) int {
+	if pre.ifMatch != "" && !ifMatchSatisfied(pre.ifMatch, itemETag(version)) {
+		return http.StatusPreconditionFailed
+	}
+	if pre.version != 0 && pre.version != version {
+		return http.StatusConflict
+	}
+	return 0
+}
+
+// staleError reports an edit of an item that changed since the client loaded
+// it. current is the server copy.
+type staleError[T any] struct {
+	current T
+	status  int
+}
+
+func (e *staleError[T]) Error() string { return "item was modified concurrently" }
+
+// asStale returns the stale error wrapped in err, if any
+func asStale[T any](err error) (*staleError[T], bool) {
+	var stale *staleError[T]
+	return stale, errors.As(err, &stale)
+}
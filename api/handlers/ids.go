@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Item IDs
+//
+// New items get IDs of the form <type>_<ULID>, e.g.
+// bookmark_01J9Z3N4W6Q8R2T5V7X9Y1B3C5. A ULID is a 48-bit millisecond
+// timestamp followed by 80 random bits, written in Crockford base32, so IDs
+// sort lexicographically by creation time. Within one millisecond the
+// random part is incremented rather than redrawn, which keeps IDs generated
+// in a tight loop unique and ordered. Older <type>_<unix nanoseconds> IDs
+// stay valid; IDs are only ever compared as opaque strings.
+
+// crockford is the Crockford base32 alphabet used by ULIDs
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// maxIDAttempts bounds the retries when a generated ID is already taken
+const maxIDAttempts = 10
+
+var errNoFreeID = errors.New("could not generate an unused item ID")
+
+// ulidSource generates monotonic ULIDs
+type ulidSource struct {
+	mu      sync.Mutex
+	lastMs  uint64
+	entropy [10]byte
+}
+
+var ulids ulidSource
+
+// next returns a ULID for time t that sorts after every earlier one
+func (u *ulidSource) next(t time.Time) string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	ms := uint64(t.UnixMilli())
+	if ms <= u.lastMs {
+		// Same millisecond (or a clock step back): increment the entropy,
+		// carrying into the timestamp on overflow
+		ms = u.lastMs
+		if !increment(u.entropy[:]) {
+			ms++
+		}
+	} else if _, err := rand.Read(u.entropy[:]); err != nil {
+		// crypto/rand doesn't fail on supported platforms; fall back to
+		// incrementing so IDs stay unique
+		increment(u.entropy[:])
+	}
+	u.lastMs = ms
+
+	var raw [16]byte
+	binary.BigEndian.PutUint16(raw[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(raw[2:6], uint32(ms))
+	copy(raw[6:], u.entropy[:])
+	return encodeULID(raw)
+}
+
+// increment adds one to a big-endian number, reporting false on overflow
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeULID writes 128 bits as 26 Crockford base32 characters
+func encodeULID(raw [16]byte) string {
+	hi := binary.BigEndian.Uint64(raw[0:8])
+	lo := binary.BigEndian.Uint64(raw[8:16])
+
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// newItemID returns a new ID for an item of the given type
+func newItemID(kind string) string {
+	return kind + "_" + ulids.next(time.Now())
+}
+
+// newID returns an item ID that isn't used yet. Checking inside the write
+// transaction means a concurrent writer of the same key makes the
+// transaction conflict instead of silently overwriting.
+func (s *store[T, P]) newID(txn *badger.Txn) (string, error) {
+	for attempt := 0; attempt < maxIDAttempts; attempt++ {
+		id := newItemID(s.kind)
+		_, err := txn.Get(s.key(id))
+		if err == badger.ErrKeyNotFound {
+			return id, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", errNoFreeID
+}
+
+// freeID returns id if it is set and unused, and a new ID otherwise
+func (s *store[T, P]) freeID(txn *badger.Txn, id string) (string, error) {
+	if id == "" {
+		return s.newID(txn)
+	}
+	_, err := txn.Get(s.key(id))
+	if err == badger.ErrKeyNotFound {
+		return id, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return s.newID(txn)
+}
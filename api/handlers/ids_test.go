@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEncodeULID(t *testing.T) {
+	var ones [16]byte
+	for i := range ones {
+		ones[i] = 0xff
+	}
+	tests := []struct {
+		raw  [16]byte
+		want string
+	}{
+		{[16]byte{}, strings.Repeat("0", 26)},
+		{[16]byte{15: 1}, strings.Repeat("0", 25) + "1"},
+		{[16]byte{15: 31}, strings.Repeat("0", 25) + "Z"},
+		{[16]byte{15: 32}, strings.Repeat("0", 24) + "10"},
+		{ones, "7" + strings.Repeat("Z", 25)},
+		// The timestamp of the example in the ULID specification
+		{[16]byte{0x01, 0x56, 0x3e, 0x3a, 0xb5, 0xd3}, "01ARZ3NDEK" + strings.Repeat("0", 16)},
+	}
+	for _, tt := range tests {
+		if got := encodeULID(tt.raw); got != tt.want {
+			t.Errorf("encodeULID(%x) = %s, want %s", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	tests := []struct {
+		in, want []byte
+		ok       bool
+	}{
+		{[]byte{0, 0}, []byte{0, 1}, true},
+		{[]byte{0, 0xff}, []byte{1, 0}, true},
+		{[]byte{0xfe, 0xff}, []byte{0xff, 0}, true},
+		{[]byte{0xff, 0xff}, []byte{0, 0}, false},
+	}
+	for _, tt := range tests {
+		b := bytes.Clone(tt.in)
+		if ok := increment(b); ok != tt.ok || !bytes.Equal(b, tt.want) {
+			t.Errorf("increment(%x) = %x, %v; want %x, %v", tt.in, b, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestULIDSourceOrder(t *testing.T) {
+	base := time.UnixMilli(1469922850259)
+	tests := []struct {
+		name  string
+		times []time.Time
+	}{
+		{"same millisecond", []time.Time{base, base, base, base}},
+		{"advancing clock", []time.Time{base, base.Add(time.Millisecond), base.Add(time.Second)}},
+		{"clock stepping back", []time.Time{base, base.Add(-time.Second), base.Add(-time.Hour)}},
+	}
+	for _, tt := range tests {
+		var u ulidSource
+		prev := ""
+		for i, ts := range tt.times {
+			id := u.next(ts)
+			if len(id) != 26 || strings.Trim(id, crockford) != "" {
+				t.Fatalf("%s: malformed ULID %q", tt.name, id)
+			}
+			if id <= prev {
+				t.Errorf("%s: ULID %d %s doesn't sort after %s", tt.name, i, id, prev)
+			}
+			prev = id
+		}
+	}
+
+	// Timestamps show in the first ten characters
+	var u ulidSource
+	if got := u.next(base)[:10]; got != "01ARZ3NDEK" {
+		t.Errorf("timestamp part = %s, want 01ARZ3NDEK", got)
+	}
+}
+
+func TestULIDSourceEntropyOverflow(t *testing.T) {
+	base := time.UnixMilli(1469922850259)
+	var u ulidSource
+	u.next(base)
+	for i := range u.entropy {
+		u.entropy[i] = 0xff
+	}
+
+	// Running out of entropy within a millisecond carries into the next
+	// one; Crockford base32 skips L
+	id := u.next(base)
+	if want := "01ARZ3NDEM" + strings.Repeat("0", 16); id != want {
+		t.Errorf("after overflow: %s, want %s", id, want)
+	}
+	if later := u.next(base); later <= id {
+		t.Errorf("%s doesn't sort after %s", later, id)
+	}
+}
+
+func TestULIDSourceConcurrent(t *testing.T) {
+	var u ulidSource
+	const workers, perWorker = 8, 500
+	ids := make(chan string, workers*perWorker)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				ids <- u.next(time.Now())
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[string]bool, workers*perWorker)
+	for id := range ids {
+		if seen[id] {
+			t.Fatalf("duplicate ULID %s", id)
+		}
+		seen[id] = true
+	}
+}
@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"archive/zip"
+	"bytes"
 	"fmt"
 	"io"
+	"maps"
 	"mime/multipart"
 	"net/http"
+	"os"
+	"path"
 	"strings"
 	"time"
 
@@ -18,29 +23,62 @@ type ExportData struct {
 	Bookmarks  []Bookmark     `json:"bookmarks"`
 	Notes      []Note         `json:"notes"`
 	Youtube    []YoutubeVideo `json:"youtube"`
+	Blobs      []Blob         `json:"blobs,omitempty"` // Attached blobs, included in zip exports
 }
 
+// Zip exports hold the JSON export and the content of every attached blob
+const (
+	zipExportFile = "export.json"
+	zipBlobDir    = "blobs/"
+)
+
+// importBatchSize bounds the items inserted per transaction; a batch whose
+// index entries don't fit in one transaction is split further
+const importBatchSize = 200
+
 type ImportSummary struct {
 	BookmarksInserted int `json:"bookmarks_inserted"`
 	BookmarksSkipped  int `json:"bookmarks_skipped"`
 	NotesInserted     int `json:"notes_inserted"`
 	NotesSkipped      int `json:"notes_skipped"`
+	NotesSanitized    int `json:"notes_sanitized"` // Imported notes whose description HTML was cleaned
+	BlobsImported     int `json:"blobs_imported"`  // Blobs stored from a zip export
 	YoutubeInserted   int `json:"youtube_inserted"`
 	YoutubeSkipped    int `json:"youtube_skipped"`
 }
 
+type ImportResponse struct {
+	Success bool          `json:"success"`
+	Message string        `json:"message"`
+	Summary ImportSummary `json:"summary"`
+}
+
 type ImportExportHandler struct {
-	db *badger.DB
+	db        *badger.DB
+	bookmarks *store[Bookmark, *Bookmark]
+	notes     *store[Note, *Note]
+	youtube   *store[YoutubeVideo, *YoutubeVideo]
 }
 
 func NewImportExportHandler(db *badger.DB) *ImportExportHandler {
-	return &ImportExportHandler{db: db}
+	return &ImportExportHandler{
+		db:        db,
+		bookmarks: newBookmarkStore(db),
+		notes:     newNoteStore(db),
+		youtube:   newYoutubeStore(db),
+	}
 }
 
-// ExportAll returns a single JSON file with all content
+// ExportAll returns a single JSON file with all content, or with
+// ?format=zip a zip file that also holds the attached blobs
 func (h *ImportExportHandler) ExportAll(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	asZip := false
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+	case "zip":
+		asZip = true
+	default:
+		http.Error(w, "format must be json or zip", http.StatusBadRequest)
 		return
 	}
 
@@ -54,64 +92,44 @@ func (h *ImportExportHandler) ExportAll(w http.ResponseWriter, r *http.Request)
 	}
 
 	err := h.db.View(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions
-		opts.PrefetchSize = 100
-		it := txn.NewIterator(opts)
-		defer it.Close()
-
-		for it.Rewind(); it.Valid(); it.Next() {
-			item := it.Item()
-			key := string(item.Key())
+		err := h.bookmarks.each(txn, func(b *Bookmark) error {
+			out.Bookmarks = append(out.Bookmarks, *b)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
 
-			if strings.HasPrefix(key, "bookmark_") {
-				if key == "bookmark_tag_counts" || key == "tag_counts" { // ignore counts or legacy
-					continue
-				}
-				if err := item.Value(func(val []byte) error {
-					var b Bookmark
-					if e := json.Unmarshal(val, &b); e == nil && b.ID != "" {
-						out.Bookmarks = append(out.Bookmarks, b)
-					}
-					return nil
-				}); err != nil {
-					return err
-				}
-				continue
+		seen := make(map[string]bool)
+		err = h.notes.each(txn, func(n *Note) error {
+			out.Notes = append(out.Notes, *n)
+			if !asZip {
+				return nil
 			}
-
-			if strings.HasPrefix(key, "note_") {
-				if key == "note_tag_counts" {
+			for _, att := range n.Attachments {
+				if seen[att.Blob] {
 					continue
 				}
-				if err := item.Value(func(val []byte) error {
-					var n Note
-					if e := json.Unmarshal(val, &n); e == nil && n.ID != "" {
-						out.Notes = append(out.Notes, n)
-					}
-					return nil
-				}); err != nil {
-					return err
-				}
-				continue
-			}
-
-			if strings.HasPrefix(key, "youtube_") {
-				if key == "youtube_tag_counts" {
+				seen[att.Blob] = true
+				blob, err := getBlob(txn, att.Blob)
+				if err == errBlobNotFound {
 					continue
 				}
-				if err := item.Value(func(val []byte) error {
-					var y YoutubeVideo
-					if e := json.Unmarshal(val, &y); e == nil && y.ID != "" {
-						out.Youtube = append(out.Youtube, y)
-					}
-					return nil
-				}); err != nil {
+				if err != nil {
 					return err
 				}
-				continue
+				out.Blobs = append(out.Blobs, blob)
 			}
+			return nil
+		})
+		if err != nil {
+			return err
 		}
-		return nil
+
+		return h.youtube.each(txn, func(y *YoutubeVideo) error {
+			out.Youtube = append(out.Youtube, *y)
+			return nil
+		})
 	})
 
 	if err != nil {
@@ -127,6 +145,18 @@ func (h *ImportExportHandler) ExportAll(w http.ResponseWriter, r *http.Request)
 	}
 
 	ts := time.Now().UTC().Format("20060102T150405Z")
+	if asZip {
+		filename := fmt.Sprintf("mon-export-%s.zip", ts)
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
+		w.WriteHeader(http.StatusOK)
+		if err := writeExportZip(w, data, out.Blobs); err != nil {
+			// The status is sent; a truncated zip is all the client can see
+			Warnf("zip export failed: %v", err)
+		}
+		return
+	}
+
 	filename := fmt.Sprintf("mon-export-%s.json", ts)
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
@@ -136,11 +166,6 @@ func (h *ImportExportHandler) ExportAll(w http.ResponseWriter, r *http.Request)
 
 // ImportAll ingests a previously exported file and recreates content without duplicating
 func (h *ImportExportHandler) ImportAll(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Read body as JSON, supporting multipart/form-data (file field named "file")
 	var payload []byte
 	var err error
@@ -170,134 +195,169 @@ func (h *ImportExportHandler) ImportAll(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
+	// Zip exports carry the JSON export and the attached blobs
+	var zipped *zip.Reader
+	if bytes.HasPrefix(payload, []byte("PK\x03\x04")) {
+		zipped, err = zip.NewReader(bytes.NewReader(payload), int64(len(payload)))
+		if err == nil {
+			payload, err = readZipFile(zipped, zipExportFile)
+		}
+		if err != nil {
+			http.Error(w, "Invalid zip export format", http.StatusBadRequest)
+			return
+		}
+	}
+
 	var in ExportData
 	if err := json.Unmarshal(payload, &in); err != nil {
 		http.Error(w, "Invalid JSON export format", http.StatusBadRequest)
 		return
 	}
 
+	// Store the blobs first so the notes can attach them
+	sum := ImportSummary{}
+	if zipped != nil {
+		sum.BlobsImported, err = h.importBlobs(zipped, in.Blobs)
+		if err != nil {
+			http.Error(w, "Failed to import blobs", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	// Build fast lookup sets to avoid duplicates
 	bookmarkURLs := make(map[string]struct{})
 	noteKeys := make(map[string]struct{}) // title\x00description
 	ytIDs := make(map[string]struct{})
 
 	if err := h.db.View(func(txn *badger.Txn) error {
-		it := txn.NewIterator(badger.DefaultIteratorOptions)
-		defer it.Close()
-		for it.Rewind(); it.Valid(); it.Next() {
-			item := it.Item()
-			k := string(item.Key())
-			switch {
-			case strings.HasPrefix(k, "bookmark_"):
-				if k == "bookmark_tag_counts" || k == "tag_counts" {
-					continue
-				}
-				_ = item.Value(func(val []byte) error {
-					var b Bookmark
-					if e := json.Unmarshal(val, &b); e == nil {
-						u := strings.TrimSpace(strings.ToLower(b.URL))
-						if u != "" {
-							bookmarkURLs[u] = struct{}{}
-						}
-					}
-					return nil
-				})
-			case strings.HasPrefix(k, "note_"):
-				if k == "note_tag_counts" {
-					continue
-				}
-				_ = item.Value(func(val []byte) error {
-					var n Note
-					if e := json.Unmarshal(val, &n); e == nil {
-						key := strings.TrimSpace(strings.ToLower(n.Title)) + "\x00" + strings.TrimSpace(strings.ToLower(n.Description))
-						if strings.TrimSpace(n.Title) != "" && strings.TrimSpace(n.Description) != "" {
-							noteKeys[key] = struct{}{}
-						}
-					}
-					return nil
-				})
-			case strings.HasPrefix(k, "youtube_"):
-				if k == "youtube_tag_counts" {
-					continue
-				}
-				_ = item.Value(func(val []byte) error {
-					var y YoutubeVideo
-					if e := json.Unmarshal(val, &y); e == nil {
-						vid := strings.TrimSpace(y.VideoID)
-						if vid == "" {
-							vid = extractYouTubeVideoID(y.URL)
-						}
-						if vid != "" {
-							ytIDs[vid] = struct{}{}
-						}
-					}
-					return nil
-				})
+		err := h.bookmarks.each(txn, func(b *Bookmark) error {
+			u := strings.TrimSpace(strings.ToLower(b.URL))
+			if u != "" {
+				bookmarkURLs[u] = struct{}{}
 			}
+			return nil
+		})
+		if err != nil {
+			return err
 		}
-		return nil
+
+		err = h.notes.each(txn, func(n *Note) error {
+			key := strings.TrimSpace(strings.ToLower(n.Title)) + "\x00" + strings.TrimSpace(strings.ToLower(n.Description))
+			if strings.TrimSpace(n.Title) != "" && strings.TrimSpace(n.Description) != "" {
+				noteKeys[key] = struct{}{}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return h.youtube.each(txn, func(y *YoutubeVideo) error {
+			vid := strings.TrimSpace(y.VideoID)
+			if vid == "" {
+				vid = extractYouTubeVideoID(y.URL)
+			}
+			if vid != "" {
+				ytIDs[vid] = struct{}{}
+			}
+			return nil
+		})
 	}); err != nil {
 		http.Error(w, "Failed to scan database", http.StatusInternalServerError)
 		return
 	}
 
-	// Insert new items
-	sum := ImportSummary{}
-
-	err = h.db.Update(func(txn *badger.Txn) error {
-		// Bookmarks
-		for _, b := range in.Bookmarks {
-			normURL := strings.TrimSpace(strings.ToLower(b.URL))
-			if normURL == "" {
-				continue
-			}
-			if _, exists := bookmarkURLs[normURL]; exists {
-				sum.BookmarksSkipped++
-				continue
-			}
-			// Generate/ensure ID
-			id := b.ID
-			if id == "" {
-				id = fmt.Sprintf("bookmark_%d", time.Now().UnixNano())
-			} else {
-				// If key exists, generate a new one to avoid collision
-				if _, err := txn.Get([]byte(id)); err == nil {
-					id = fmt.Sprintf("bookmark_%d", time.Now().UnixNano())
+	// Insert new items in batches, writing their tag counts, tag postings,
+	// links and search entries in the same transaction as for items created
+	// one by one. A retry after a conflict starts the batch again from the
+	// state before it.
+	insertBatches := func(n int, insert func(txn *badger.Txn, i int) error) error {
+		size := importBatchSize
+		for start := 0; start < n; {
+			end := min(start+size, n)
+			before := sum
+			urls, notes, videos := maps.Clone(bookmarkURLs), maps.Clone(noteKeys), maps.Clone(ytIDs)
+			err := updateWithRetry(h.db, func(txn *badger.Txn) error {
+				sum = before
+				bookmarkURLs, noteKeys, ytIDs = maps.Clone(urls), maps.Clone(notes), maps.Clone(videos)
+				for i := start; i < end; i++ {
+					if err := insert(txn, i); err != nil {
+						return err
+					}
 				}
+				return nil
+			})
+			if err == badger.ErrTxnTooBig && end-start > 1 {
+				// Items with long texts write many index keys; try fewer
+				sum = before
+				bookmarkURLs, noteKeys, ytIDs = urls, notes, videos
+				size = (end - start) / 2
+				continue
 			}
-			// Ensure times
-			if b.CreatedAt.IsZero() {
-				b.CreatedAt = time.Now()
-			}
-			if b.UpdatedAt.IsZero() {
-				b.UpdatedAt = b.CreatedAt
-			}
-			b.ID = id
-			data, _ := json.Marshal(b)
-			if err := txn.Set([]byte(id), data); err != nil {
+			if err != nil {
 				return err
 			}
-			bookmarkURLs[normURL] = struct{}{}
-			sum.BookmarksInserted++
+			start = end
+		}
+		return nil
+	}
+
+	// Bookmarks
+	err = insertBatches(len(in.Bookmarks), func(txn *badger.Txn, i int) error {
+		b := in.Bookmarks[i]
+		normURL := strings.TrimSpace(strings.ToLower(b.URL))
+		if normURL == "" {
+			return nil
 		}
+		if _, exists := bookmarkURLs[normURL]; exists {
+			sum.BookmarksSkipped++
+			return nil
+		}
+		// Keep the exported ID unless it is taken, checked in this transaction
+		id, err := h.bookmarks.freeID(txn, b.ID)
+		if err != nil {
+			return err
+		}
+		// Ensure times
+		if b.CreatedAt.IsZero() {
+			b.CreatedAt = time.Now()
+		}
+		if b.UpdatedAt.IsZero() {
+			b.UpdatedAt = b.CreatedAt
+		}
+		b.ID = id
+		if err := h.bookmarks.write(txn, &b); err != nil {
+			return err
+		}
+		if err := h.bookmarks.updateTags(txn, id, nil, b.searchTags()); err != nil {
+			return err
+		}
+		bookmarkURLs[normURL] = struct{}{}
+		sum.BookmarksInserted++
+		return nil
+	})
 
-		// Notes
-		for _, n := range in.Notes {
+	// Notes
+	if err == nil {
+		err = insertBatches(len(in.Notes), func(txn *badger.Txn, i int) error {
+			n := in.Notes[i]
+			// Export files can carry any HTML; keep only what the editor produces
+			if !validNoteFormat(n.Format) {
+				n.Format = noteFormatHTML
+			}
+			report := sanitizeNote(&n)
 			if strings.TrimSpace(n.Title) == "" || strings.TrimSpace(n.Description) == "" {
-				continue
+				return nil
 			}
 			key := strings.TrimSpace(strings.ToLower(n.Title)) + "\x00" + strings.TrimSpace(strings.ToLower(n.Description))
 			if _, exists := noteKeys[key]; exists {
 				sum.NotesSkipped++
-				continue
+				return nil
 			}
-			id := n.ID
-			if id == "" {
-				id = fmt.Sprintf("note_%d", time.Now().UnixNano())
-			} else {
-				if _, err := txn.Get([]byte(id)); err == nil {
-					id = fmt.Sprintf("note_%d", time.Now().UnixNano())
-				}
+			// Keep the exported ID unless it is taken, checked in this transaction
+			id, err := h.notes.freeID(txn, n.ID)
+			if err != nil {
+				return err
 			}
 			if n.CreatedAt.IsZero() {
 				n.CreatedAt = time.Now()
@@ -306,34 +366,44 @@ func (h *ImportExportHandler) ImportAll(w http.ResponseWriter, r *http.Request)
 				n.UpdatedAt = n.CreatedAt
 			}
 			n.ID = id
-			data, _ := json.Marshal(n)
-			if err := txn.Set([]byte(id), data); err != nil {
+			// Attachments whose blob wasn't exported are left out
+			if err := h.notes.resolveAttachments(txn, &n, true); err != nil {
+				return err
+			}
+			if err := h.notes.write(txn, &n); err != nil {
+				return err
+			}
+			if err := h.notes.updateTags(txn, id, nil, n.searchTags()); err != nil {
 				return err
 			}
 			noteKeys[key] = struct{}{}
 			sum.NotesInserted++
-		}
+			if !report.empty() {
+				sum.NotesSanitized++
+			}
+			return nil
+		})
+	}
 
-		// YouTube
-		for _, y := range in.Youtube {
+	// YouTube
+	if err == nil {
+		err = insertBatches(len(in.Youtube), func(txn *badger.Txn, i int) error {
+			y := in.Youtube[i]
 			vid := y.VideoID
 			if vid == "" {
 				vid = extractYouTubeVideoID(y.URL)
 			}
 			if vid == "" {
-				continue
+				return nil
 			}
 			if _, exists := ytIDs[vid]; exists {
 				sum.YoutubeSkipped++
-				continue
+				return nil
 			}
-			id := y.ID
-			if id == "" {
-				id = fmt.Sprintf("youtube_%d", time.Now().UnixNano())
-			} else {
-				if _, err := txn.Get([]byte(id)); err == nil {
-					id = fmt.Sprintf("youtube_%d", time.Now().UnixNano())
-				}
+			// Keep the exported ID unless it is taken, checked in this transaction
+			id, err := h.youtube.freeID(txn, y.ID)
+			if err != nil {
+				return err
 			}
 			if y.CreatedAt.IsZero() {
 				y.CreatedAt = time.Now()
@@ -343,32 +413,29 @@ func (h *ImportExportHandler) ImportAll(w http.ResponseWriter, r *http.Request)
 			}
 			y.ID = id
 			y.VideoID = vid
-			data, _ := json.Marshal(y)
-			if err := txn.Set([]byte(id), data); err != nil {
+			if err := h.youtube.write(txn, &y); err != nil {
+				return err
+			}
+			if err := h.youtube.updateTags(txn, id, nil, y.searchTags()); err != nil {
 				return err
 			}
 			ytIDs[vid] = struct{}{}
 			sum.YoutubeInserted++
-		}
-		return nil
-	})
+			return nil
+		})
+	}
 
 	if err != nil {
+		Warnf("import failed: %v", err)
+		if err == badger.ErrTxnTooBig {
+			http.Error(w, "An imported item is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
 		http.Error(w, "Failed to import data", http.StatusInternalServerError)
 		return
 	}
 
-	// Rebuild tag counts to ensure consistency after bulk import
-	// These helpers are private but available within this package.
-	_ = (&BookmarkHandler{db: h.db}).rebuildTagCounts()
-	_ = (&NoteHandler{db: h.db}).rebuildNoteTagCounts()
-	_ = (&YoutubeHandler{db: h.db}).rebuildYoutubeTagCounts()
-
-	resp := struct {
-		Success bool          `json:"success"`
-		Message string        `json:"message"`
-		Summary ImportSummary `json:"summary"`
-	}{
+	resp := ImportResponse{
 		Success: true,
 		Message: "Import completed",
 		Summary: sum,
@@ -377,5 +444,92 @@ func (h *ImportExportHandler) ImportAll(w http.ResponseWriter, r *http.Request)
 	_ = writeJSONResponse(w, http.StatusOK, resp)
 }
 
+// writeExportZip writes a zip export of the JSON export data and blobs
+func writeExportZip(w io.Writer, data []byte, blobs []Blob) error {
+	zw := zip.NewWriter(w)
+	f, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     zipExportFile,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+
+	for _, blob := range blobs {
+		// Blob content is usually compressed already
+		f, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     zipBlobDir + blob.SHA256,
+			Method:   zip.Store,
+			Modified: blob.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+		src, err := os.Open(blobPath(blob.SHA256))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, src)
+		src.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// readZipFile returns the content of a file in a zip
+func readZipFile(zr *zip.Reader, name string) ([]byte, error) {
+	f, err := zr.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// importBlobs stores the blobs of a zip export, skipping files whose
+// content doesn't match their name, and returns how many were stored
+func (h *ImportExportHandler) importBlobs(zr *zip.Reader, blobs []Blob) (int, error) {
+	contentTypes := make(map[string]string, len(blobs))
+	for _, blob := range blobs {
+		contentTypes[blob.SHA256] = blob.ContentType
+	}
+
+	imported := 0
+	for _, f := range zr.File {
+		name, ok := strings.CutPrefix(f.Name, zipBlobDir)
+		if !ok || !validBlobID(name) || path.Base(f.Name) != name {
+			continue
+		}
+		src, err := f.Open()
+		if err != nil {
+			Warnf("skipping unreadable blob %s in import: %v", name, err)
+			continue
+		}
+		blob, err := saveBlob(h.db, src, contentTypes[name])
+		src.Close()
+		if err == errBlobTooLarge {
+			Warnf("skipping blob %s in import: larger than %d bytes", name, MaxBlobSize)
+			continue
+		}
+		if err != nil {
+			return imported, err
+		}
+		if blob.SHA256 != name {
+			// Stored under its real hash; no imported note refers to it, so
+			// the sweeper removes it later
+			Warnf("blob %s in import has different content", name)
+			continue
+		}
+		imported++
+	}
+	return imported, nil
+}
+
 // Ensure the http package keeps multipart imported even when not used directly in some builds
 var _ = multipart.FileHeader{}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func TestImportIndexesItems(t *testing.T) {
+	db := openTestDB(t)
+	h := NewImportExportHandler(db)
+
+	existing := &Note{Title: "Existing", Description: "<p>kept</p>", Tags: []string{"go"}}
+	if err := h.notes.create(existing); err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{
+		"bookmarks": [{"id": "bookmark_imported", "title": "Go blog", "url": "https://go.dev/blog", "tags": ["go", "reading"]}],
+		"notes": [
+			{"id": "note_imported", "title": "Gophers", "description": "<p>concurrency patterns</p>", "tags": ["go"]},
+			{"title": "Existing", "description": "<p>kept</p>", "tags": ["dup"]}
+		],
+		"youtube": [{"title": "Talk", "url": "https://www.youtube.com/watch?v=dQw4w9WgXcQ", "tags": ["video"]}]
+	}`
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/import", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.ImportAll(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("import: status %d: %s", w.Code, w.Body.String())
+	}
+	var resp ImportResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := ImportSummary{BookmarksInserted: 1, NotesInserted: 1, NotesSkipped: 1, YoutubeInserted: 1}
+	if resp.Summary != want {
+		t.Errorf("summary = %+v, want %+v", resp.Summary, want)
+	}
+
+	// Tag counts include the note that was there before the import
+	tags, err := h.notes.tagList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(tags, " ") != "go,2" {
+		t.Errorf("note tags = %v, want [go,2]", tags)
+	}
+
+	db.View(func(txn *badger.Txn) error {
+		tests := []struct {
+			name string
+			got  idSet
+			want string
+		}{
+			{"note postings", h.notes.tagIdx.postings(txn, "go"), "note_imported"},
+			{"bookmark postings", h.bookmarks.tagIdx.postings(txn, "reading"), "bookmark_imported"},
+		}
+		for _, tt := range tests {
+			if _, ok := tt.got[tt.want]; !ok {
+				t.Errorf("%s = %v, missing %s", tt.name, tt.got, tt.want)
+			}
+		}
+
+		scores, err := h.notes.index.search(txn, []string{"concurrency"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := scores["note_imported"]; !ok || len(scores) != 1 {
+			t.Errorf("search concurrency = %v, want note_imported", scores)
+		}
+		stats, err := h.notes.index.getStats(txn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Docs != 2 {
+			t.Errorf("search index counts %d notes, want 2", stats.Docs)
+		}
+		return nil
+	})
+}
+
+func TestImportManyItems(t *testing.T) {
+	db := openTestDB(t)
+	h := NewImportExportHandler(db)
+
+	// Thousands of items, and notes long enough that a full batch of them
+	// writes more index keys than one transaction holds
+	var in ExportData
+	for i := 0; i < 5000; i++ {
+		n := strconv.Itoa(i)
+		in.Bookmarks = append(in.Bookmarks, Bookmark{Title: "Bookmark " + n, URL: "https://example.com/" + n, Tags: []string{"bulk", "t" + n}})
+	}
+	var words strings.Builder
+	for i := 0; i < 1500; i++ {
+		words.WriteString(" w" + strconv.Itoa(i))
+	}
+	for i := 0; i < importBatchSize; i++ {
+		n := strconv.Itoa(i)
+		in.Notes = append(in.Notes, Note{Title: "Note " + n, Description: "<p>n" + n + words.String() + "</p>", Tags: []string{"bulk"}})
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	h.ImportAll(w, httptest.NewRequest(http.MethodPost, "/api/v1/import", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("import: status %d: %s", w.Code, w.Body.String())
+	}
+	var resp ImportResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if want := (ImportSummary{BookmarksInserted: 5000, NotesInserted: importBatchSize}); resp.Summary != want {
+		t.Errorf("summary = %+v, want %+v", resp.Summary, want)
+	}
+
+	tests := []struct {
+		name  string
+		store interface{ tagList() ([]string, error) }
+		want  string
+	}{
+		{"bookmarks", h.bookmarks, "bulk,5000"},
+		{"notes", h.notes, "bulk," + strconv.Itoa(importBatchSize)},
+	}
+	for _, tt := range tests {
+		tags, err := tt.store.tagList()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Contains(tags, tt.want) {
+			t.Errorf("%s: tags %v lack %s", tt.name, tags[:min(len(tags), 5)], tt.want)
+		}
+	}
+	db.View(func(txn *badger.Txn) error {
+		for _, ix := range []*searchIndex{h.bookmarks.index, h.notes.index} {
+			stats, err := ix.getStats(txn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := map[string]int64{"bookmark": 5000, "note": importBatchSize}[ix.kind]; int64(stats.Docs) != want {
+				t.Errorf("%s search index counts %d items, want %d", ix.kind, stats.Docs, want)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Wiki links
+//
+// Note descriptions can link to other items with [[note title]] or
+// [[<type>:<id>]], e.g. [[bookmark:bookmark_01J9Z3N4W6Q8R2T5V7X9Y1B3C5]].
+// Links are parsed from the visible text whenever a note is written and kept
+// as
+//
+//	links/<type>/<id>                      JSON list of the item's link targets
+//	backlinks/<target>/<type>/<id>         one empty key per link
+//
+// where a target is <type>/<id> or title/<escaped lowercase title>. Title
+// links point at whichever notes carry that title when backlinks are read,
+// so they follow the wiki convention of linking by name. The forward list
+// lets a write replace exactly the postings the previous version created.
+// Trashed items keep no links; restoring an item writes them again.
+
+const (
+	linksKeyPrefix     = "links/"
+	backlinksKeyPrefix = "backlinks/"
+)
+
+// linkPattern matches [[...]] links
+var linkPattern = regexp.MustCompile(`\[\[([^\[\]\n]+)\]\]`)
+
+// linkKinds maps the item types that can be linked to their key namespace
+var linkKinds = map[string]string{
+	"bookmark": bookmarkKeyPrefix,
+	"note":     noteKeyPrefix,
+	"youtube":  youtubeKeyPrefix,
+}
+
+// linker is implemented by items whose text can link to other items
+type linker interface {
+	linkTargets() []string
+}
+
+// titled is implemented by items that title links can point at
+type titled interface {
+	linkTitle() string
+}
+
+// Backlink is an item that links to another item
+type Backlink struct {
+	Type      string    `json:"type"`
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type BacklinksResponse struct {
+	Success bool       `json:"success"`
+	Message string     `json:"message"`
+	Data    []Backlink `json:"data,omitempty"`
+	Count   int        `json:"count"`
+}
+
+// itemTarget is the link target of an item by ID
+func itemTarget(kind, id string) string {
+	return kind + "/" + id
+}
+
+// titleTarget is the link target of the notes with a title
+func titleTarget(title string) string {
+	key := strings.ToLower(strings.Join(strings.Fields(title), " "))
+	return "title/" + url.QueryEscape(key)
+}
+
+// parseLinks returns the distinct link targets in a text
+func parseLinks(text string) []string {
+	seen := make(map[string]bool)
+	var targets []string
+	for _, m := range linkPattern.FindAllStringSubmatch(text, -1) {
+		inner := strings.TrimSpace(m[1])
+		target := ""
+		if kind, id, ok := strings.Cut(inner, ":"); ok && linkKinds[kind] != "" {
+			// IDs never contain separators; anything else isn't an ID link
+			if id = strings.TrimSpace(id); id != "" && !strings.ContainsAny(id, "/ \t") {
+				target = itemTarget(kind, id)
+			}
+		}
+		if target == "" && strings.TrimSpace(inner) != "" {
+			target = titleTarget(inner)
+		}
+		if target != "" && !seen[target] {
+			seen[target] = true
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+func linksKey(kind, id string) []byte {
+	return []byte(linksKeyPrefix + kind + "/" + id)
+}
+
+func backlinkPrefix(target string) []byte {
+	return []byte(backlinksKeyPrefix + target + "/")
+}
+
+func backlinkKey(target, kind, id string) []byte {
+	return append(backlinkPrefix(target), kind+"/"+id...)
+}
+
+// updateLinks replaces the links of an item with targets
+func updateLinks(txn *badger.Txn, kind, id string, targets []string) error {
+	return replacePostings(txn, linksKey(kind, id), func(target string) []byte {
+		return backlinkKey(target, kind, id)
+	}, targets)
+}
+
+// replacePostings stores targets as the list under listKey and replaces the
+// postings of the previous list with postings of the new one
+func replacePostings(txn *badger.Txn, listKey []byte, posting func(target string) []byte, targets []string) error {
+	var old []string
+	it, err := txn.Get(listKey)
+	if err == nil {
+		err = it.Value(func(val []byte) error { return json.Unmarshal(val, &old) })
+	}
+	if err != nil && err != badger.ErrKeyNotFound {
+		return err
+	}
+
+	keep := make(map[string]bool, len(targets))
+	for _, target := range targets {
+		keep[target] = true
+	}
+	for _, target := range old {
+		if !keep[target] {
+			if err := txn.Delete(posting(target)); err != nil {
+				return err
+			}
+		}
+	}
+	for target := range keep {
+		if err := txn.Set(posting(target), nil); err != nil {
+			return err
+		}
+	}
+
+	if len(targets) == 0 {
+		if len(old) == 0 {
+			return nil
+		}
+		return txn.Delete(listKey)
+	}
+	data, err := json.Marshal(targets)
+	if err != nil {
+		return err
+	}
+	return txn.Set(listKey, data)
+}
+
+// writeLinks updates the links of an item that can link to others
+func (s *store[T, P]) writeLinks(txn *badger.Txn, item P) error {
+	if l, ok := any(item).(linker); ok {
+		return updateLinks(txn, s.kind, item.indexID(), l.linkTargets())
+	}
+	return nil
+}
+
+// rebuildLinks re-parses the links of every item of the type
+func (s *store[T, P]) rebuildLinks() error {
+	var items []P
+	err := s.db.View(func(txn *badger.Txn) error {
+		return s.each(txn, func(item P) error {
+			if _, ok := any(item).(linker); ok {
+				items = append(items, item)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(items); start += migrationBatchSize {
+		batch := items[start:min(start+migrationBatchSize, len(items))]
+		err := updateWithRetry(s.db, func(txn *badger.Txn) error {
+			for _, item := range batch {
+				if err := s.writeLinks(txn, item); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backlinks returns the items linking to an item, most recently updated
+// first. It returns badger.ErrKeyNotFound if the item doesn't exist.
+func (s *store[T, P]) backlinks(id string) ([]Backlink, error) {
+	links := []Backlink{}
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := s.get(txn, id)
+		if err != nil {
+			return err
+		}
+
+		targets := []string{itemTarget(s.kind, id)}
+		if t, ok := any(P(&item)).(titled); ok {
+			targets = append(targets, titleTarget(t.linkTitle()))
+		}
+
+		seen := map[string]bool{itemTarget(s.kind, id): true} // an item's links to itself don't count
+		for _, target := range targets {
+			prefix := backlinkPrefix(target)
+			opts := badger.DefaultIteratorOptions
+			opts.PrefetchValues = false
+			opts.Prefix = prefix
+			it := txn.NewIterator(opts)
+
+			for it.Rewind(); it.Valid(); it.Next() {
+				source := string(it.Item().Key()[len(prefix):])
+				kind, sourceID, ok := strings.Cut(source, "/")
+				if !ok || seen[source] || linkKinds[kind] == "" {
+					continue
+				}
+				seen[source] = true
+
+				link, err := loadBacklink(txn, kind, sourceID)
+				if err == badger.ErrKeyNotFound {
+					continue
+				}
+				if err != nil {
+					it.Close()
+					return err
+				}
+				links = append(links, link)
+			}
+			it.Close()
+		}
+		return nil
+	})
+
+	sort.SliceStable(links, func(i, j int) bool { return links[i].UpdatedAt.After(links[j].UpdatedAt) })
+	return links, err
+}
+
+// loadBacklink reads the summary of a linking item
+func loadBacklink(txn *badger.Txn, kind, id string) (Backlink, error) {
+	link := Backlink{Type: kind, ID: id}
+	it, err := txn.Get([]byte(linkKinds[kind] + id))
+	if err != nil {
+		return link, err
+	}
+	err = it.Value(func(val []byte) error { return json.Unmarshal(val, &link) })
+	link.Type = kind
+	return link, err
+}
+
+// handleBacklinks serves the backlinks of one item
+func handleBacklinks[T any, P itemPtr[T]](w http.ResponseWriter, r *http.Request, s *store[T, P], notFound string) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get item ID from the {id} path segment
+	id := r.PathValue("id")
+
+	links, err := s.backlinks(id)
+	if err != nil {
+		if err == badger.ErrKeyNotFound {
+			response := BacklinksResponse{
+				Success: false,
+				Message: notFound,
+			}
+			writeJSONResponse(w, http.StatusNotFound, response)
+			return
+		}
+
+		response := BacklinksResponse{
+			Success: false,
+			Message: "Error reading backlinks from database",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	// Return success response
+	response := BacklinksResponse{
+		Success: true,
+		Message: "Backlinks retrieved successfully",
+		Data:    links,
+		Count:   len(links),
+	}
+
+	writeJSONResponse(w, http.StatusOK, response)
+}
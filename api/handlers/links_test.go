@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestParseLinks(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"no links [here] or [[]]", nil},
+		{"see [[Go Notes]]", []string{"title/go+notes"}},
+		{"[[ go   notes ]] twice [[GO NOTES]]", []string{"title/go+notes"}},
+		{"[[bookmark:bookmark_01J]] and [[note: note_01K ]]", []string{"bookmark/bookmark_01J", "note/note_01K"}},
+		{"[[video:abc]] isn't a type", []string{"title/video%3Aabc"}},
+		{"[[note:a/b]] isn't an ID", []string{"title/note%3Aa%2Fb"}},
+		{"[[split\nline]] [[a]][[b]]", []string{"title/a", "title/b"}},
+	}
+	for _, tt := range tests {
+		if got := parseLinks(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("parseLinks(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+// backlinkIDs returns the IDs of the items linking to id, most recent first
+func backlinkIDs(t *testing.T, s *store[Note, *Note], id string) []string {
+	t.Helper()
+	links, err := s.backlinks(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, l := range links {
+		ids = append(ids, l.ID)
+	}
+	return ids
+}
+
+func TestBacklinks(t *testing.T) {
+	h := NewNoteHandler(openTestDB(t))
+	s := h.store
+
+	target := &Note{Title: "Go Notes", Description: "<p>links to itself: [[Go Notes]]</p>"}
+	if err := s.create(target); err != nil {
+		t.Fatal(err)
+	}
+	byTitle := &Note{Title: "By title", Description: "<p>[[go notes]]</p>"}
+	if err := s.create(byTitle); err != nil {
+		t.Fatal(err)
+	}
+	byID := &Note{Title: "By ID", Description: "<p>[[note:" + target.ID + "]] and [[Go Notes]]</p>"}
+	if err := s.create(byID); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := backlinkIDs(t, s, target.ID), []string{byID.ID, byTitle.ID}; !slices.Equal(got, want) {
+		t.Fatalf("backlinks = %v, want %v", got, want)
+	}
+
+	// Editing a note replaces its links
+	if _, err := s.update(byTitle.ID, precondition{}, func(n Note) (Note, error) {
+		n.Description = "<p>[[Other]]</p>"
+		return n, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := backlinkIDs(t, s, target.ID), []string{byID.ID}; !slices.Equal(got, want) {
+		t.Errorf("after edit: backlinks = %v, want %v", got, want)
+	}
+
+	// Title links follow the title, not the note that had it
+	other := &Note{Title: "Other", Description: "<p>x</p>"}
+	if err := s.create(other); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := backlinkIDs(t, s, other.ID), []string{byTitle.ID}; !slices.Equal(got, want) {
+		t.Errorf("new title: backlinks = %v, want %v", got, want)
+	}
+
+	// Trashed notes link nowhere until restored
+	if err := s.delete(byID.ID, precondition{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := backlinkIDs(t, s, target.ID); len(got) != 0 {
+		t.Errorf("after delete: backlinks = %v, want none", got)
+	}
+	if _, err := s.restore(byID.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := backlinkIDs(t, s, target.ID), []string{byID.ID}; !slices.Equal(got, want) {
+		t.Errorf("after restore: backlinks = %v, want %v", got, want)
+	}
+
+	// An unknown note is a 404
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/notes/note_missing/backlinks", nil)
+	r.SetPathValue("id", "note_missing")
+	w := httptest.NewRecorder()
+	h.GetNoteBacklinks(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("missing note: status %d, want 404", w.Code)
+	}
+}
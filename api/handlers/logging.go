@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Logging
+//
+// Server messages go to standard output as before, filtered by level:
+// debug adds one line per request, info is the default and includes startup
+// and maintenance messages, warn keeps only warnings and errors.
+
+// LogLevel orders how much the server prints
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var logLevelNames = []string{"debug", "info", "warn", "error"}
+
+// Level is the least severe level printed
+var Level = LevelInfo
+
+// ParseLogLevel reads a level name
+func ParseLogLevel(s string) (LogLevel, error) {
+	for i, name := range logLevelNames {
+		if strings.EqualFold(s, name) {
+			return LogLevel(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("log level must be one of %s", strings.Join(logLevelNames, ", "))
+}
+
+func (l LogLevel) String() string {
+	if l < 0 || int(l) >= len(logLevelNames) {
+		return fmt.Sprintf("LogLevel(%d)", int(l))
+	}
+	return logLevelNames[l]
+}
+
+// Debugf prints a debug message
+func Debugf(format string, args ...any) { logf(LevelDebug, "", format, args...) }
+
+// Infof prints an informational message
+func Infof(format string, args ...any) { logf(LevelInfo, "", format, args...) }
+
+// Warnf prints a warning
+func Warnf(format string, args ...any) { logf(LevelWarn, "Warning: ", format, args...) }
+
+func logf(level LogLevel, prefix, format string, args ...any) {
+	if level < Level {
+		return
+	}
+	fmt.Printf(prefix+format+"\n", args...)
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Database maintenance
+//
+// Badger never reclaims the space of overwritten or deleted values on its
+// own: value log files are only rewritten by RunValueLogGC, one file per
+// call. CollectGarbagePeriodically calls it until there is nothing left to
+// rewrite and reports how much the value log shrank.
+//
+// CompactSearchStatsPeriodically folds the per-write changes to the search
+// index statistics into one key so searches don't have to add up many.
+
+// maxGCRounds bounds the files rewritten in one maintenance run so a large
+// backlog doesn't hold up shutdown
+const maxGCRounds = 100
+
+// collectGarbage rewrites value log files that are at least discardRatio
+// garbage until none are left or ctx is cancelled. It returns how many
+// files were rewritten.
+func collectGarbage(ctx context.Context, db *badger.DB, discardRatio float64) (int, error) {
+	rewritten := 0
+	for rewritten < maxGCRounds && ctx.Err() == nil {
+		err := db.RunValueLogGC(discardRatio)
+		if err == badger.ErrNoRewrite || err == badger.ErrRejected {
+			// Nothing worth rewriting, or the database is closing
+			return rewritten, nil
+		}
+		if err != nil {
+			return rewritten, err
+		}
+		rewritten++
+	}
+	return rewritten, nil
+}
+
+// valueLogSize sums the size of the value log files on disk. Badger's own
+// db.Size() is only refreshed once a minute.
+func valueLogSize(db *badger.DB) int64 {
+	var total int64
+	entries, err := os.ReadDir(db.Opts().ValueDir)
+	if err != nil {
+		return 0
+	}
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".vlog") {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
+
+// CollectGarbagePeriodically runs value log garbage collection every
+// interval until ctx is cancelled. An interval of zero or less disables it.
+func CollectGarbagePeriodically(ctx context.Context, db *badger.DB, interval time.Duration, discardRatio float64) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		before := valueLogSize(db)
+		n, err := collectGarbage(ctx, db, discardRatio)
+		if err != nil {
+			Warnf("value log garbage collection failed: %v", err)
+			continue
+		}
+		if n == 0 {
+			Debugf("Value log garbage collection found nothing to rewrite")
+			continue
+		}
+		reclaimed := before - valueLogSize(db)
+		Infof("♻️  Rewrote %d value log file(s), reclaiming %s", n, formatBytes(reclaimed))
+	}
+}
+
+// searchStatsCompactionInterval is how often search statistics are compacted
+const searchStatsCompactionInterval = time.Hour
+
+// CompactSearchStatsPeriodically compacts the search index statistics of
+// every item type each hour until ctx is cancelled
+func CompactSearchStatsPeriodically(ctx context.Context, db *badger.DB) {
+	ticker := time.NewTicker(searchStatsCompactionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, kind := range []string{"bookmark", "note", "youtube"} {
+			ix := &searchIndex{kind: kind}
+			if err := ix.compactStats(db); err != nil {
+				Warnf("failed to compact %s search statistics: %v", kind, err)
+			}
+		}
+	}
+}
+
+// formatBytes prints a byte count with a binary unit
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit && n > -unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, exp := float64(n)/unit, 0
+	for value >= unit || value <= -unit {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGTPE"[exp])
+}
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Note formats
+//
+// A note's description is either HTML from the editor (the default, also for
+// notes stored before formats existed) or Markdown. Markdown is stored as
+// written and rendered on the server with GitHub Flavored Markdown; raw HTML
+// in it is left out of the rendered output and dangerous link URLs are
+// dropped, so rendered Markdown is safe to display. Converting HTML to
+// Markdown understands the markup the editor produces; underlining has no
+// Markdown equivalent and is reduced to plain text.
+
+// Description formats
+const (
+	noteFormatHTML     = "html"
+	noteFormatMarkdown = "markdown"
+)
+
+// markdown renders Markdown in its default safe mode
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// validNoteFormat reports whether f names a description format; empty means
+// the default
+func validNoteFormat(f string) bool {
+	return f == "" || f == noteFormatHTML || f == noteFormatMarkdown
+}
+
+// renderMarkdown converts Markdown to HTML
+func renderMarkdown(src string) string {
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(src), &buf); err != nil {
+		// The HTML renderer only fails on write errors, which a buffer doesn't have
+		return html.EscapeString(src)
+	}
+	return buf.String()
+}
+
+// descriptionFormat returns the note's format, html if unset
+func (n *Note) descriptionFormat() string {
+	if n.Format == "" {
+		return noteFormatHTML
+	}
+	return n.Format
+}
+
+// descriptionHTML returns the description as HTML for display
+func (n *Note) descriptionHTML() string {
+	if n.descriptionFormat() == noteFormatMarkdown {
+		return renderMarkdown(n.Description)
+	}
+	return n.Description
+}
+
+// renderHTML replaces the description with its HTML rendering. The copy says
+// it is HTML, so a client saving what it read doesn't put HTML into a
+// Markdown note.
+func (n *Note) renderHTML() {
+	n.Description = n.descriptionHTML()
+	n.Format = noteFormatHTML
+}
+
+// plainDescription returns the visible text of the description
+func (n *Note) plainDescription() string {
+	return stripHTML(n.descriptionHTML())
+}
+
+// renderRequested reads ?render=html, which asks for descriptions as HTML
+// whatever their format
+func renderRequested(r *http.Request) (bool, error) {
+	switch r.URL.Query().Get("render") {
+	case "":
+		return false, nil
+	case noteFormatHTML:
+		return true, nil
+	}
+	return false, fmt.Errorf("render must be html")
+}
+
+// convertNote rewrites a note's description in another format
+func convertNote(n *Note, format string) {
+	switch {
+	case n.descriptionFormat() == format:
+	case format == noteFormatMarkdown:
+		n.Description = htmlToMarkdown(n.Description)
+	default:
+		n.Description, _ = sanitizeHTML(renderMarkdown(n.Description))
+	}
+	n.Format = format
+}
+
+// HTML to Markdown
+
+var (
+	// markdownEscaper escapes characters that would start inline Markdown
+	markdownEscaper = strings.NewReplacer(
+		`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`,
+		"<", `\<`, ">", `\>`, "#", `\#`, "|", `\|`, "~", `\~`,
+	)
+	// listMarkerPattern matches text that Markdown would read as a list item
+	listMarkerPattern = regexp.MustCompile(`^([-+]|\d+[.)])(\s|$)`)
+	whitespacePattern = regexp.MustCompile(`[ \t\r\n\f]+`)
+)
+
+// hardBreak marks a <br> until paragraphs are trimmed
+const hardBreak = "\x00"
+
+// htmlToMarkdown converts editor HTML to Markdown
+func htmlToMarkdown(s string) string {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(s), body)
+	if err != nil {
+		return strings.TrimSpace(stripHTML(s))
+	}
+	return markdownBlocks(nodes, false)
+}
+
+// isBlockNode reports whether n starts its own Markdown block
+func isBlockNode(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	switch n.DataAtom {
+	case atom.P, atom.Div, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6,
+		atom.Ul, atom.Ol, atom.Li, atom.Blockquote, atom.Pre, atom.Table:
+		return true
+	}
+	return false
+}
+
+// markdownBlocks converts a run of sibling nodes into blank-line separated
+// blocks; consecutive inline nodes form one paragraph. In a tight list item
+// nested lists follow the text directly, since a blank line would make the
+// whole list loose.
+func markdownBlocks(nodes []*html.Node, tight bool) string {
+	var out strings.Builder
+	blocks := 0
+	add := func(block string, list bool) {
+		if blocks > 0 {
+			if tight && list {
+				out.WriteString("\n")
+			} else {
+				out.WriteString("\n\n")
+			}
+		}
+		out.WriteString(block)
+		blocks++
+	}
+
+	var para strings.Builder
+	flush := func() {
+		text := strings.Trim(para.String(), " \t\n"+hardBreak)
+		if text != "" {
+			text = strings.ReplaceAll(text, hardBreak, "\\\n")
+			if m := listMarkerPattern.FindStringSubmatchIndex(text); m != nil {
+				// Keep "1. " or "- " at the start of a line as text
+				text = text[:m[3]-1] + `\` + text[m[3]-1:]
+			}
+			add(text, false)
+		}
+		para.Reset()
+	}
+
+	for _, n := range nodes {
+		if !isBlockNode(n) {
+			para.WriteString(markdownInline(n))
+			continue
+		}
+		flush()
+		if block := markdownBlock(n); block != "" {
+			add(block, n.DataAtom == atom.Ul || n.DataAtom == atom.Ol)
+		}
+	}
+	flush()
+	return out.String()
+}
+
+// markdownBlock converts one block element
+func markdownBlock(n *html.Node) string {
+	children := childNodes(n)
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		var text strings.Builder
+		for _, c := range children {
+			text.WriteString(markdownInline(c))
+		}
+		title := strings.TrimSpace(strings.ReplaceAll(text.String(), hardBreak, " "))
+		if title == "" {
+			return ""
+		}
+		level := int(n.Data[1] - '0')
+		return strings.Repeat("#", level) + " " + title
+
+	case atom.Ul, atom.Ol:
+		var items []string
+		number := 1
+		for _, c := range children {
+			if c.Type != html.ElementNode || c.DataAtom != atom.Li {
+				continue
+			}
+			marker := "- "
+			if n.DataAtom == atom.Ol {
+				marker = strconv.Itoa(number) + ". "
+				number++
+			}
+			// Continuation lines are indented to the item's content
+			body := markdownBlocks(childNodes(c), true)
+			indent := strings.Repeat(" ", len(marker))
+			lines := strings.Split(body, "\n")
+			for i := 1; i < len(lines); i++ {
+				if lines[i] != "" {
+					lines[i] = indent + lines[i]
+				}
+			}
+			items = append(items, marker+strings.Join(lines, "\n"))
+		}
+		return strings.Join(items, "\n")
+
+	case atom.Blockquote:
+		body := markdownBlocks(children, false)
+		if body == "" {
+			return ""
+		}
+		return "> " + strings.ReplaceAll(body, "\n", "\n> ")
+
+	default:
+		// p, div, li outside a list, pre and tables keep their content
+		return markdownBlocks(children, false)
+	}
+}
+
+// markdownInline converts an inline node
+func markdownInline(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return markdownEscaper.Replace(whitespacePattern.ReplaceAllString(n.Data, " "))
+	case html.ElementNode:
+	default:
+		return ""
+	}
+
+	var inner strings.Builder
+	for _, c := range childNodes(n) {
+		if isBlockNode(c) {
+			inner.WriteString(hardBreak + markdownBlock(c) + hardBreak)
+			continue
+		}
+		inner.WriteString(markdownInline(c))
+	}
+	text := inner.String()
+
+	switch n.DataAtom {
+	case atom.Br:
+		return hardBreak
+	case atom.B, atom.Strong:
+		return emphasize(text, "**")
+	case atom.I, atom.Em:
+		return emphasize(text, "*")
+	}
+	return text
+}
+
+// emphasize wraps text in a delimiter, keeping surrounding spaces outside it
+// since "** bold**" isn't emphasis in Markdown
+func emphasize(text, delim string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	start := strings.Index(text, trimmed)
+	return text[:start] + delim + trimmed + delim + text[start+len(trimmed):]
+}
+
+func childNodes(n *html.Node) []*html.Node {
+	var nodes []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		nodes = append(nodes, c)
+	}
+	return nodes
+}
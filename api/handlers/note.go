@@ -1,9 +1,8 @@
 package handlers
 
 import (
-	"fmt"
+	"errors"
 	"net/http"
-	"regexp"
 	"strings"
 	"time"
 
@@ -27,42 +26,117 @@ var (
 )
 
 type Note struct {
-	ID          string    `json:"id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Tags        []string  `json:"tags"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          string       `json:"id"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	Format      string       `json:"format,omitempty"` // html (default) or markdown
+	Tags        []string     `json:"tags"`
+	Attachments []Attachment `json:"attachments,omitempty"` // Files uploaded to /blobs
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+	Version     int64        `json:"version"`              // Increases with every write
+	DeletedAt   *time.Time   `json:"deleted_at,omitempty"` // When the item was moved to the trash
+	Score       float64      `json:"score,omitempty"`      // Relevance of a keyword search match
 }
 
+// noteSearchFields are the text fields usable as field:value in queries
+var noteSearchFields = []string{"title", "description"}
+
+func (n *Note) searchText() string {
+	return n.Title + " " + n.plainDescription() + " " + strings.Join(n.Tags, " ")
+}
+
+func (n *Note) searchField(name string) (string, bool) {
+	switch name {
+	case "title":
+		return n.Title, true
+	case "description":
+		return n.plainDescription(), true
+	}
+	return "", false
+}
+
+func (n *Note) searchTags() []string { return n.Tags }
+
+func (n *Note) searchTimes() (time.Time, time.Time) { return n.CreatedAt, n.UpdatedAt }
+
+func (n *Note) indexID() string { return n.ID }
+
+func (n *Note) indexText() (string, string, []string) {
+	return n.Title, n.plainDescription(), n.Tags
+}
+
+func (n *Note) relevance() float64 { return n.Score }
+
+func (n *Note) linkTargets() []string { return parseLinks(n.plainDescription()) }
+
+func (n *Note) linkTitle() string { return n.Title }
+
+func (n *Note) attachmentList() []Attachment { return n.Attachments }
+
+func (n *Note) setAttachmentList(list []Attachment) { n.Attachments = list }
+
+func (n *Note) setTags(tags []string) { n.Tags = tags }
+
+func (n *Note) setScore(score float64) { n.Score = score }
+
+func (n *Note) setUpdatedAt(t time.Time) { n.UpdatedAt = t }
+
+func (n *Note) version() int64 { return n.Version }
+
+func (n *Note) setVersion(ver int64) { n.Version = ver }
+
+func (n *Note) setID(id string) { n.ID = id }
+
+func (n *Note) setDeletedAt(t *time.Time) { n.DeletedAt = t }
+
 type NewNoteRequest struct {
-	Title       string   `json:"title"`
-	Description string   `json:"description"`
-	Tags        []string `json:"tags"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	Format      string       `json:"format,omitempty"` // html (default) or markdown
+	Tags        []string     `json:"tags"`
+	Attachments []Attachment `json:"attachments,omitempty"`
 }
 
 type EditNoteRequest struct {
-	Title       string   `json:"title"`
-	Description string   `json:"description"`
-	Tags        []string `json:"tags"`
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	Format      string        `json:"format,omitempty"` // html or markdown; kept when omitted
+	Tags        []string      `json:"tags"`
+	Attachments *[]Attachment `json:"attachments,omitempty"` // Replaces the attachments; kept when omitted
+	Version     int64         `json:"version,omitempty"`     // Version being replaced; 409 Conflict if stale
+}
+
+type PatchNoteRequest struct {
+	Title       *string      `json:"title,omitempty"`
+	Description *string      `json:"description,omitempty"`
+	Format      *string      `json:"format,omitempty"` // Relabels the description; see the convert endpoint to rewrite it
+	Tags        []string     `json:"tags,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"` // Replaces the attachments; null removes them
+	Version     *int64       `json:"version,omitempty"`     // Version being patched; 409 Conflict if stale
+	TagOperations
 }
 
 type NoteResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
-	Data    Note   `json:"data,omitempty"`
+	Success   bool            `json:"success"`
+	Message   string          `json:"message"`
+	Data      Note            `json:"data,omitempty"`
+	Sanitized *SanitizeReport `json:"sanitized,omitempty"` // What was removed from the description HTML
 }
 
 type NotesListResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
-	Data    []Note `json:"data,omitempty"`
-	Count   int    `json:"count"`
+	Success    bool   `json:"success"`
+	Message    string `json:"message"`
+	Data       []Note `json:"data,omitempty"`
+	Count      int    `json:"count"`
+	Total      int    `json:"total"`                 // Matches across all pages
+	NextCursor string `json:"next_cursor,omitempty"` // Cursor of the next page, empty on the last page
 }
 
 type DeleteNoteResponse struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
+	Data    *Note  `json:"data,omitempty"` // Server copy when the delete was refused as stale
 }
 
 type NoteTagsResponse struct {
@@ -72,336 +146,112 @@ type NoteTagsResponse struct {
 	Count   int      `json:"count"`
 }
 
-type NoteHandler struct {
-	db *badger.DB
-}
-
-// evaluateNoteTagExpression evaluates a tag expression against a set of note tags
-func evaluateNoteTagExpression(noteTags []string, expression string) bool {
-	if expression == "" {
-		return true // Empty expression matches all
-	}
-
-	// Create a case-insensitive set of note tags
-	tagSet := make(map[string]bool)
-	for _, tag := range noteTags {
-		tagSet[strings.ToLower(tag)] = true
-	}
-
-	// Normalize the expression to lowercase
-	expr := strings.ToLower(expression)
-
-	// Replace tag names with boolean values
-	// Find all words that could be tag names (alphanumeric + underscore + hyphen)
-	wordRegex := regexp.MustCompile(`\b[a-zA-Z0-9_-]+\b`)
-	expr = wordRegex.ReplaceAllStringFunc(expr, func(word string) string {
-		lowerWord := strings.ToLower(word)
-		// Skip logical operators
-		if lowerWord == "and" || lowerWord == "or" || lowerWord == "not" {
-			return word
-		}
-		// Replace tag names with boolean values
-		if tagSet[lowerWord] {
-			return "true"
-		}
-		return "false"
-	})
-
-	// Replace logical operators with Go equivalents
-	expr = strings.ReplaceAll(expr, " and ", " && ")
-	expr = strings.ReplaceAll(expr, " or ", " || ")
-	expr = strings.ReplaceAll(expr, " not ", " !")
-	expr = strings.ReplaceAll(expr, "not ", "!")
-
-	// Clean up extra spaces
-	expr = regexp.MustCompile(`\s+`).ReplaceAllString(expr, " ")
-	expr = strings.TrimSpace(expr)
-
-	// Use the same simple expression evaluator as bookmarks
-	return evaluateNoteSimpleBooleanExpression(expr)
-}
-
-// evaluateNoteSimpleBooleanExpression evaluates a simple boolean expression for notes
-func evaluateNoteSimpleBooleanExpression(expr string) bool {
-	// Remove all whitespace
-	expr = strings.ReplaceAll(expr, " ", "")
-
-	// Handle parentheses recursively
-	for strings.Contains(expr, "(") {
-		// Find the innermost parentheses
-		start := -1
-		for i, char := range expr {
-			if char == '(' {
-				start = i
-			} else if char == ')' && start != -1 {
-				// Evaluate the expression inside parentheses
-				inner := expr[start+1 : i]
-				result := evaluateNoteSimpleBooleanExpression(inner)
-				resultStr := "false"
-				if result {
-					resultStr = "true"
-				}
-				// Replace the parentheses expression with the result
-				expr = expr[:start] + resultStr + expr[i+1:]
-				break
-			}
-		}
-	}
-
-	// Now evaluate the expression without parentheses
-	return evaluateNoteWithoutParentheses(expr)
+type ConvertNoteRequest struct {
+	Format  string `json:"format"`            // html or markdown
+	Version int64  `json:"version,omitempty"` // Version being converted; 409 Conflict if stale
 }
 
-// evaluateNoteWithoutParentheses evaluates a boolean expression without parentheses for notes
-func evaluateNoteWithoutParentheses(expr string) bool {
-	// Handle NOT operators first
-	for strings.Contains(expr, "!") {
-		notRegex := regexp.MustCompile(`!(true|false)`)
-		expr = notRegex.ReplaceAllStringFunc(expr, func(match string) string {
-			if strings.HasSuffix(match, "true") {
-				return "false"
-			}
-			return "true"
-		})
-	}
-
-	// Handle AND operators (higher precedence than OR)
-	for strings.Contains(expr, "&&") {
-		andRegex := regexp.MustCompile(`(true|false)&&(true|false)`)
-		expr = andRegex.ReplaceAllStringFunc(expr, func(match string) string {
-			parts := strings.Split(match, "&&")
-			left := parts[0] == "true"
-			right := parts[1] == "true"
-			if left && right {
-				return "true"
-			}
-			return "false"
-		})
-	}
-
-	// Handle OR operators
-	for strings.Contains(expr, "||") {
-		orRegex := regexp.MustCompile(`(true|false)\|\|(true|false)`)
-		expr = orRegex.ReplaceAllStringFunc(expr, func(match string) string {
-			parts := strings.Split(match, "||")
-			left := parts[0] == "true"
-			right := parts[1] == "true"
-			if left || right {
-				return "true"
-			}
-			return "false"
-		})
-	}
-
-	// The final result should be either "true" or "false"
-	return expr == "true"
+type NoteDiff struct {
+	From        int64      `json:"from"`         // Older version
+	To          int64      `json:"to"`           // Newer version
+	Title       []DiffLine `json:"title"`        // Title diff
+	Description []DiffLine `json:"description"`  // Diff of the description text, one line per block
+	AddedTags   []string   `json:"added_tags"`   // Tags only in the newer version
+	RemovedTags []string   `json:"removed_tags"` // Tags only in the older version
 }
 
-func NewNoteHandler(db *badger.DB) *NoteHandler {
-	handler := &NoteHandler{db: db}
-
-	// Initialize tag counts if they don't exist (for migration)
-	handler.initializeNoteTagCounts()
-
-	return handler
+type NoteDiffResponse struct {
+	Success bool      `json:"success"`
+	Message string    `json:"message"`
+	Data    *NoteDiff `json:"data,omitempty"`
 }
 
-// initializeNoteTagCounts creates the note_tag_counts key if it doesn't exist
-// This is useful for migrating from the old all_tags system
-func (h *NoteHandler) initializeNoteTagCounts() error {
-	return h.db.View(func(txn *badger.Txn) error {
-		// Check if note_tag_counts already exists
-		_, err := txn.Get([]byte("note_tag_counts"))
-		if err == badger.ErrKeyNotFound {
-			// note_tag_counts doesn't exist, rebuild it
-			return h.rebuildNoteTagCounts()
-		}
-		return err
+// newNoteStore returns the repository holding notes
+func newNoteStore(db *badger.DB) *store[Note, *Note] {
+	return newStore[Note](db, storeConfig{
+		Kind:          "note",
+		Prefix:        noteKeyPrefix,
+		Fields:        noteSearchFields,
+		RevisionLimit: NoteRevisionLimit,
 	})
 }
 
-// updateNoteTagCounts maintains tag counts for efficient retrieval
-func (h *NoteHandler) updateNoteTagCounts(oldTags, newTags []string) error {
-	return h.db.Update(func(txn *badger.Txn) error {
-		// Get existing tag counts
-		tagCounts := make(map[string]int)
-
-		item, err := txn.Get([]byte("note_tag_counts"))
-		if err != nil && err != badger.ErrKeyNotFound {
-			return err
-		}
-
-		if err != badger.ErrKeyNotFound {
-			err = item.Value(func(val []byte) error {
-				return json.Unmarshal(val, &tagCounts)
-			})
-			if err != nil {
-				return err
-			}
-		}
-
-		// Decrease counts for old tags
-		for _, tag := range oldTags {
-			if tag != "" {
-				if count, exists := tagCounts[tag]; exists {
-					if count <= 1 {
-						delete(tagCounts, tag)
-					} else {
-						tagCounts[tag] = count - 1
-					}
-				}
-			}
-		}
-
-		// Increase counts for new tags
-		for _, tag := range newTags {
-			if tag != "" {
-				tagCounts[tag]++
-			}
-		}
-
-		// Serialize and save
-		countsJSON, err := json.Marshal(tagCounts)
-		if err != nil {
-			return err
-		}
-
-		return txn.Set([]byte("note_tag_counts"), countsJSON)
-	})
+type NoteHandler struct {
+	db    *badger.DB
+	store *store[Note, *Note]
 }
 
-// rebuildNoteTagCounts rebuilds the note_tag_counts key by scanning all existing notes
-func (h *NoteHandler) rebuildNoteTagCounts() error {
-	return h.db.Update(func(txn *badger.Txn) error {
-		// Get all tags and their counts from existing notes
-		tagCounts := make(map[string]int)
-
-		opts := badger.DefaultIteratorOptions
-		opts.PrefetchSize = 50 // Increase prefetch size for better performance
-		it := txn.NewIterator(opts)
-		defer it.Close()
-
-		for it.Rewind(); it.Valid(); it.Next() {
-			item := it.Item()
-			key := item.Key()
-
-			// Only process keys that start with "note_" and are note IDs (not tag counts)
-			keyStr := string(key)
-			if len(keyStr) >= 5 && strings.HasPrefix(keyStr, "note_") && keyStr != "note_tag_counts" {
-				err := item.Value(func(val []byte) error {
-					var note Note
-					if err := json.Unmarshal(val, &note); err != nil {
-						// Skip invalid JSON entries
-						return nil
-					}
-					// Count all tags from this note
-					for _, tag := range note.Tags {
-						if tag != "" {
-							tagCounts[tag]++
-						}
-					}
-					return nil
-				})
-				if err != nil {
-					return err
-				}
-			}
-		}
+func NewNoteHandler(db *badger.DB) *NoteHandler {
+	handler := &NoteHandler{db: db, store: newNoteStore(db)}
 
-		// Serialize and save
-		countsJSON, err := json.Marshal(tagCounts)
-		if err != nil {
-			return err
-		}
+	// Build tag counts and the search index if they don't exist (for migration)
+	handler.store.initialize()
 
-		return txn.Set([]byte("note_tag_counts"), countsJSON)
-	})
+	return handler
 }
 
 func (h *NoteHandler) NewNote(w http.ResponseWriter, r *http.Request) {
-	// Only allow POST requests
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Set content type to JSON
 	w.Header().Set("Content-Type", "application/json")
 
 	// Parse JSON request body using helper function
 	var req NewNoteRequest
 	if err := readJSONRequest(r, &req); err != nil {
-		response := NoteResponse{
-			Success: false,
-			Message: "Invalid JSON format",
-		}
-		writeJSONResponse(w, http.StatusBadRequest, response)
+		writeJSONResponse(w, http.StatusBadRequest, invalidJSONResponseNote)
 		return
 	}
 
-	// Validate required fields
-	if req.Title == "" {
+	// Validate the format and required fields
+	if !validNoteFormat(req.Format) {
 		response := NoteResponse{
 			Success: false,
-			Message: "Title is required",
+			Message: "Format must be html or markdown",
 		}
 		writeJSONResponse(w, http.StatusBadRequest, response)
 		return
 	}
 
-	if req.Description == "" {
-		response := NoteResponse{
-			Success: false,
-			Message: "Description is required",
-		}
-		writeJSONResponse(w, http.StatusBadRequest, response)
+	if req.Title == "" {
+		writeJSONResponse(w, http.StatusBadRequest, titleRequiredResponseNote)
 		return
 	}
 
-	// Initialize tags if nil
-	if req.Tags == nil {
-		req.Tags = []string{}
+	// Reduce HTML descriptions to the markup the editor produces
+	submitted := Note{Description: req.Description, Format: req.Format}
+	report := sanitizeNote(&submitted)
+	description := submitted.Description
+
+	if strings.TrimSpace(description) == "" {
+		writeJSONResponse(w, http.StatusBadRequest, descriptionRequiredResponse)
+		return
 	}
-	// Normalize tags via aliases (note)
-	aliasHandler := NewTagAliasHandler(h.db)
-	_ = h.db.View(func(txn *badger.Txn) error {
-		aliases, err := aliasHandler.getAliasMap(txn, "note")
-		if err == nil {
-			req.Tags = normalizeTags(req.Tags, aliases)
-		}
-		return nil
-	})
 
-	// Generate unique ID (simple timestamp + title hash for now)
+	// The store assigns the ID when it saves the item
 	now := time.Now()
-	noteID := fmt.Sprintf("note_%d", now.UnixNano())
 
-	// Create note object
+	// Create note object with tags normalized via aliases
 	note := Note{
-		ID:          noteID,
 		Title:       req.Title,
-		Description: req.Description,
-		Tags:        req.Tags,
+		Description: description,
+		Format:      submitted.descriptionFormat(),
+		Tags:        h.store.normalizeTags(req.Tags),
+		Attachments: req.Attachments,
 		CreatedAt:   now,
 		UpdatedAt:   now,
 	}
 
-	// Serialize note to JSON for storage
-	noteJSON, err := json.Marshal(note)
-	if err != nil {
-		response := NoteResponse{
-			Success: false,
-			Message: "Error serializing note data",
+	// Store in BadgerDB
+	if err := h.store.create(&note); err != nil {
+		var perr *patchError
+		if errors.As(err, &perr) {
+			response := NoteResponse{
+				Success: false,
+				Message: perr.msg,
+			}
+			writeJSONResponse(w, http.StatusBadRequest, response)
+			return
 		}
-		writeJSONResponse(w, http.StatusInternalServerError, response)
-		return
-	}
 
-	// Store in BadgerDB
-	err = h.db.Update(func(txn *badger.Txn) error {
-		return txn.Set([]byte(noteID), noteJSON)
-	})
-	if err != nil {
 		response := NoteResponse{
 			Success: false,
 			Message: "Error saving note to database",
@@ -410,218 +260,40 @@ func (h *NoteHandler) NewNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Update the tag counts
-	if err := h.updateNoteTagCounts([]string{}, note.Tags); err != nil {
-		// Log error but don't fail the request since note was saved
-		fmt.Printf("Warning: Failed to update note tag counts: %v\n", err)
-	}
-
 	// Return success response
 	response := NoteResponse{
-		Success: true,
-		Message: "Note created successfully",
-		Data:    note,
+		Success:   true,
+		Message:   "Note created successfully",
+		Data:      note,
+		Sanitized: report.orNil(),
 	}
 
+	w.Header().Set("ETag", itemETag(note.Version))
 	writeJSONResponse(w, http.StatusCreated, response)
 }
 
 func (h *NoteHandler) GetNotes(w http.ResponseWriter, r *http.Request) {
-	// Only allow GET requests
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Set content type to JSON
 	w.Header().Set("Content-Type", "application/json")
 
-	// Parse query parameters for tag filtering and keyword search
-	queryTags := r.URL.Query().Get("tags")
-	queryExcludeTags := r.URL.Query().Get("exclude_tags")
-	advancedExpression := strings.TrimSpace(r.URL.Query().Get("advanced"))
-	keywords := strings.TrimSpace(r.URL.Query().Get("keywords"))
-	var filterTags []string
-	var excludeTags []string
-
-	// Load alias map once
-	aliasHandler := NewTagAliasHandler(h.db)
-	var aliasMap map[string]string
-	_ = h.db.View(func(txn *badger.Txn) error {
-		m, err := aliasHandler.getAliasMap(txn, "note")
-		if err == nil {
-			aliasMap = m
-		}
-		return nil
-	})
-
-	if queryTags != "" {
-		// Split tags by comma and trim whitespace
-		for _, tag := range strings.Split(queryTags, ",") {
-			trimmed := strings.TrimSpace(tag)
-			if trimmed != "" {
-				filterTags = append(filterTags, trimmed)
-			}
-		}
+	// Parse tag filters, keyword search, paging and rendering parameters
+	opts, err := h.store.parseListOptions(r.URL.Query())
+	render, rerr := renderRequested(r)
+	if err == nil {
+		err = rerr
 	}
-
-	if queryExcludeTags != "" {
-		// Split exclude tags by comma and trim whitespace
-		for _, tag := range strings.Split(queryExcludeTags, ",") {
-			trimmed := strings.TrimSpace(tag)
-			if trimmed != "" {
-				excludeTags = append(excludeTags, trimmed)
-			}
+	if err != nil {
+		response := NotesListResponse{
+			Success: false,
+			Message: err.Error(),
+			Data:    []Note{},
+			Count:   0,
 		}
+		writeJSONResponse(w, http.StatusBadRequest, response)
+		return
 	}
 
-	// Normalize filters and expression
-	if len(filterTags) > 0 && aliasMap != nil {
-		filterTags = normalizeTags(filterTags, aliasMap)
-	}
-	if len(excludeTags) > 0 && aliasMap != nil {
-		excludeTags = normalizeTags(excludeTags, aliasMap)
-	}
-	if advancedExpression != "" && aliasMap != nil {
-		advancedExpression = normalizeExpression(advancedExpression, aliasMap)
-	}
-
-	var notes []Note
-
-	// Pre-allocate slice with estimated capacity to reduce allocations
-	notes = make([]Note, 0, 100)
-
-	// Read all notes from BadgerDB
-	err := h.db.View(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions
-		opts.PrefetchSize = 50 // Increase prefetch size for better performance
-		it := txn.NewIterator(opts)
-		defer it.Close()
-
-		for it.Rewind(); it.Valid(); it.Next() {
-			item := it.Item()
-			key := item.Key()
-
-			// Only process keys that start with "note_" and exclude metadata keys
-			keyStr := string(key)
-			if len(keyStr) >= 5 && strings.HasPrefix(keyStr, "note_") && keyStr != "note_tag_counts" {
-				err := item.Value(func(val []byte) error {
-					var note Note
-					if err := json.Unmarshal(val, &note); err != nil {
-						// Skip invalid JSON entries
-						return nil
-					}
-
-					// Normalize tags for search/UI
-					if aliasMap != nil && len(note.Tags) > 0 {
-						note.Tags = normalizeTags(note.Tags, aliasMap)
-					}
-
-					// Apply tag filtering based on mode
-					if advancedExpression != "" {
-						// Use advanced expression evaluation
-						if !evaluateNoteTagExpression(note.Tags, advancedExpression) {
-							return nil
-						}
-					} else if len(filterTags) > 0 {
-						// Apply include tag filtering if filter tags are specified
-						hasAnyTag := false
-						for _, filterTag := range filterTags {
-							for _, noteTag := range note.Tags {
-								if noteTag == filterTag {
-									hasAnyTag = true
-									break
-								}
-							}
-							if hasAnyTag {
-								break
-							}
-						}
-						// Only include note if it has any of the required tags
-						if !hasAnyTag {
-							return nil
-						}
-					} else if len(excludeTags) > 0 {
-						// Apply exclude tag filtering if exclude tags are specified
-						hasExcludedTag := false
-						for _, excludeTag := range excludeTags {
-							for _, noteTag := range note.Tags {
-								if noteTag == excludeTag {
-									hasExcludedTag = true
-									break
-								}
-							}
-							if hasExcludedTag {
-								break
-							}
-						}
-						// Exclude note if it has any of the excluded tags
-						if hasExcludedTag {
-							return nil
-						}
-					}
-
-					// Apply keyword search if keywords are specified
-					if keywords != "" {
-						// Split keywords into individual words and normalize
-						keywordWords := strings.Fields(strings.ToLower(keywords))
-						if len(keywordWords) > 0 {
-							// Create searchable text by combining title, description, and tags
-							searchableText := strings.ToLower(note.Title + " " + note.Description + " " + strings.Join(note.Tags, " "))
-
-							// Separate include and exclude words
-							var includeWords []string
-							var excludeWords []string
-
-							for _, word := range keywordWords {
-								if strings.HasPrefix(word, "-") && len(word) > 1 {
-									// Remove the "-" prefix and add to exclude list
-									excludeWords = append(excludeWords, word[1:])
-								} else {
-									// Add to include list
-									includeWords = append(includeWords, word)
-								}
-							}
-
-							// Check if any exclude words are present
-							for _, excludeWord := range excludeWords {
-								if strings.Contains(searchableText, excludeWord) {
-									// Exclude this note if it contains any exclude word
-									return nil
-								}
-							}
-
-							// Check if all include words are present (only if there are include words)
-							if len(includeWords) > 0 {
-								allIncludeWordsMatch := true
-								for _, word := range includeWords {
-									if !strings.Contains(searchableText, word) {
-										allIncludeWordsMatch = false
-										break
-									}
-								}
-
-								// Only include note if all include words are found
-								if !allIncludeWordsMatch {
-									return nil
-								}
-							}
-						}
-					}
-
-					if note.ID != "" {
-						notes = append(notes, note)
-					}
-					return nil
-				})
-				if err != nil {
-					return err
-				}
-			}
-		}
-		return nil
-	})
-
+	result, err := h.store.list(opts)
 	if err != nil {
 		response := NotesListResponse{
 			Success: false,
@@ -633,78 +305,101 @@ func (h *NoteHandler) GetNotes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Render Markdown descriptions if asked to
+	if render {
+		for i := range result.Items {
+			result.Items[i].renderHTML()
+		}
+	}
+
 	// Return success response
 	response := NotesListResponse{
-		Success: true,
-		Message: "Notes retrieved successfully",
-		Data:    notes,
-		Count:   len(notes),
+		Success:    true,
+		Message:    "Notes retrieved successfully",
+		Data:       result.Items,
+		Count:      len(result.Items),
+		Total:      result.Total,
+		NextCursor: result.NextCursor,
 	}
 
 	writeJSONResponse(w, http.StatusOK, response)
 }
 
-func (h *NoteHandler) GetNoteTags(w http.ResponseWriter, r *http.Request) {
-	// Only allow GET requests
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
+func (h *NoteHandler) GetNote(w http.ResponseWriter, r *http.Request) {
 	// Set content type to JSON
 	w.Header().Set("Content-Type", "application/json")
 
-	var tags []string
+	// Get note ID from the {id} path segment
+	noteID := r.PathValue("id")
 
-	// Load alias map for merging counts
-	aliasHandler := NewTagAliasHandler(h.db)
-	var aliasMap map[string]string
-	_ = h.db.View(func(txn *badger.Txn) error {
-		m, err := aliasHandler.getAliasMap(txn, "note")
-		if err == nil {
-			aliasMap = m
+	if noteID == "" {
+		response := NoteResponse{
+			Success: false,
+			Message: "Note ID is required",
 		}
-		return nil
-	})
+		writeJSONResponse(w, http.StatusBadRequest, response)
+		return
+	}
 
-	// Read tag counts from BadgerDB
-	err := h.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte("note_tag_counts"))
-		if err != nil {
-			if err == badger.ErrKeyNotFound {
-				// No tags exist yet, return empty list
-				tags = []string{}
-				return nil
-			}
-			return err
+	render, err := renderRequested(r)
+	if err != nil {
+		response := NoteResponse{
+			Success: false,
+			Message: err.Error(),
 		}
+		writeJSONResponse(w, http.StatusBadRequest, response)
+		return
+	}
 
-		return item.Value(func(val []byte) error {
-			var tagCounts map[string]int
-			if err := json.Unmarshal(val, &tagCounts); err != nil {
-				return err
-			}
-			// Merge counts by alias -> canonical
-			if len(aliasMap) > 0 {
-				merged := make(map[string]int)
-				for tag, count := range tagCounts {
-					canon := aliasMap[tag]
-					if canon == "" {
-						canon = tag
-					}
-					merged[canon] += count
-				}
-				tagCounts = merged
-			}
-			// Convert to "tag,{count}" format
-			tags = make([]string, 0, len(tagCounts))
-			for tag, count := range tagCounts {
-				tags = append(tags, fmt.Sprintf("%s,%d", tag, count))
+	note, err := h.store.find(noteID)
+	if err != nil {
+		if err == badger.ErrKeyNotFound {
+			response := NoteResponse{
+				Success: false,
+				Message: "Note not found",
 			}
-			return nil
-		})
-	})
+			writeJSONResponse(w, http.StatusNotFound, response)
+			return
+		}
+
+		response := NoteResponse{
+			Success: false,
+			Message: "Error reading note from database",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	// Let clients revalidate their cached copy of this representation
+	etag := itemETag(note.Version)
+	if render {
+		etag = renderedETag(note.Version)
+	}
+	if notModified(w, r, etag) {
+		return
+	}
+
+	// Render a Markdown description if asked to
+	if render {
+		note.renderHTML()
+	}
+
+	// Return success response
+	response := NoteResponse{
+		Success: true,
+		Message: "Note retrieved successfully",
+		Data:    note,
+	}
+
+	writeJSONResponse(w, http.StatusOK, response)
+}
 
+func (h *NoteHandler) GetNoteTags(w http.ResponseWriter, r *http.Request) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	// Read tag counts from BadgerDB
+	tags, err := h.store.tagList()
 	if err != nil {
 		response := NoteTagsResponse{
 			Success: false,
@@ -716,11 +411,6 @@ func (h *NoteHandler) GetNoteTags(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Initialize empty slice if nil
-	if tags == nil {
-		tags = []string{}
-	}
-
 	// Return success response
 	response := NoteTagsResponse{
 		Success: true,
@@ -733,18 +423,11 @@ func (h *NoteHandler) GetNoteTags(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *NoteHandler) DeleteNote(w http.ResponseWriter, r *http.Request) {
-	// Only allow DELETE requests
-	if r.Method != http.MethodDelete {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Set content type to JSON
 	w.Header().Set("Content-Type", "application/json")
 
-	// Get note ID from URL path
-	// Expected format: /api/delete-note/{id}
-	noteID := r.URL.Path[len("/api/delete-note/"):]
+	// Get note ID from the {id} path segment
+	noteID := r.PathValue("id")
 
 	if noteID == "" {
 		response := DeleteNoteResponse{
@@ -755,25 +438,19 @@ func (h *NoteHandler) DeleteNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get the note first to retrieve its tags for count updates
-	var deletedTags []string
-	err := h.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte(noteID))
-		if err != nil {
-			return err
-		}
-
-		return item.Value(func(val []byte) error {
-			var note Note
-			if err := json.Unmarshal(val, &note); err != nil {
-				return err
+	// Delete the note
+	if err := h.store.delete(noteID, requestPrecondition(r)); err != nil {
+		if stale, ok := asStale[Note](err); ok {
+			w.Header().Set("ETag", itemETag(stale.current.Version))
+			response := DeleteNoteResponse{
+				Success: false,
+				Message: "Note was changed by another request",
+				Data:    &stale.current,
 			}
-			deletedTags = note.Tags
-			return nil
-		})
-	})
+			writeJSONResponse(w, stale.status, response)
+			return
+		}
 
-	if err != nil {
 		if err == badger.ErrKeyNotFound {
 			response := DeleteNoteResponse{
 				Success: false,
@@ -783,20 +460,6 @@ func (h *NoteHandler) DeleteNote(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		response := DeleteNoteResponse{
-			Success: false,
-			Message: "Error reading note from database",
-		}
-		writeJSONResponse(w, http.StatusInternalServerError, response)
-		return
-	}
-
-	// Delete the note
-	err = h.db.Update(func(txn *badger.Txn) error {
-		return txn.Delete([]byte(noteID))
-	})
-
-	if err != nil {
 		response := DeleteNoteResponse{
 			Success: false,
 			Message: "Error deleting note from database",
@@ -805,34 +468,21 @@ func (h *NoteHandler) DeleteNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Update tag counts by removing the deleted note's tags
-	if err := h.updateNoteTagCounts(deletedTags, []string{}); err != nil {
-		// Log error but don't fail the request since note was deleted
-		fmt.Printf("Warning: Failed to update note tag counts: %v\n", err)
-	}
-
 	// Return success response
 	response := DeleteNoteResponse{
 		Success: true,
-		Message: "Note deleted successfully",
+		Message: "Note moved to trash",
 	}
 
 	writeJSONResponse(w, http.StatusOK, response)
 }
 
 func (h *NoteHandler) EditNote(w http.ResponseWriter, r *http.Request) {
-	// Only allow PUT requests
-	if r.Method != http.MethodPut {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Set content type to JSON
 	w.Header().Set("Content-Type", "application/json")
 
-	// Get note ID from URL path
-	// Expected format: /api/edit-note/{id}
-	noteID := r.URL.Path[len("/api/edit-note/"):]
+	// Get note ID from the {id} path segment
+	noteID := r.PathValue("id")
 
 	if noteID == "" {
 		response := NoteResponse{
@@ -846,119 +496,669 @@ func (h *NoteHandler) EditNote(w http.ResponseWriter, r *http.Request) {
 	// Parse JSON request body
 	var req EditNoteRequest
 	if err := readJSONRequest(r, &req); err != nil {
-		response := NoteResponse{
-			Success: false,
-			Message: "Invalid JSON format",
-		}
-		writeJSONResponse(w, http.StatusBadRequest, response)
+		writeJSONResponse(w, http.StatusBadRequest, invalidJSONResponseNote)
 		return
 	}
 
-	// Validate required fields
-	if req.Title == "" {
+	// Validate the format and required fields
+	if !validNoteFormat(req.Format) {
 		response := NoteResponse{
 			Success: false,
-			Message: "Title is required",
+			Message: "Format must be html or markdown",
 		}
 		writeJSONResponse(w, http.StatusBadRequest, response)
 		return
 	}
 
-	if req.Description == "" {
-		response := NoteResponse{
-			Success: false,
-			Message: "Description is required",
-		}
-		writeJSONResponse(w, http.StatusBadRequest, response)
+	if req.Title == "" {
+		writeJSONResponse(w, http.StatusBadRequest, titleRequiredResponseNote)
 		return
 	}
 
-	// Initialize tags if nil
-	if req.Tags == nil {
-		req.Tags = []string{}
+	if strings.TrimSpace(req.Description) == "" {
+		writeJSONResponse(w, http.StatusBadRequest, descriptionRequiredResponse)
+		return
 	}
+
 	// Normalize requested tags via aliases
-	aliasHandler := NewTagAliasHandler(h.db)
-	_ = h.db.View(func(txn *badger.Txn) error {
-		aliases, err := aliasHandler.getAliasMap(txn, "note")
-		if err == nil {
-			req.Tags = normalizeTags(req.Tags, aliases)
-		}
-		return nil
-	})
+	tags := h.store.normalizeTags(req.Tags)
 
-	var updatedNote Note
-	var oldTags []string
+	// Honor If-Match and the version the client loaded
+	pre := requestPrecondition(r)
+	pre.version = req.Version
 
 	// Update note in BadgerDB
-	err := h.db.Update(func(txn *badger.Txn) error {
-		// First get the existing note
-		item, err := txn.Get([]byte(noteID))
-		if err != nil {
-			return err
-		}
-
-		var existingNote Note
-		err = item.Value(func(val []byte) error {
-			return json.Unmarshal(val, &existingNote)
-		})
-		if err != nil {
-			return err
+	var report SanitizeReport
+	updatedNote, err := h.store.update(noteID, pre, func(existing Note) (Note, error) {
+		// Keep the stored format unless the request names one
+		submitted := Note{Description: req.Description, Format: req.Format}
+		if submitted.Format == "" {
+			submitted.Format = existing.descriptionFormat()
 		}
 
-		// Store old tags for count update
-		oldTags = existingNote.Tags
-
-		// Update the note with new values
-		updatedNote = Note{
-			ID:          existingNote.ID,
-			Title:       req.Title,
-			Description: req.Description,
-			Tags:        req.Tags,
-			CreatedAt:   existingNote.CreatedAt, // Keep original creation time
-			UpdatedAt:   time.Now(),             // Update the modification time
+		// Reduce HTML descriptions to the markup the editor produces
+		report = sanitizeNote(&submitted)
+		if strings.TrimSpace(submitted.Description) == "" {
+			return Note{}, &patchError{descriptionRequiredResponse.Message}
 		}
 
-		// Serialize updated note to JSON
-		noteJSON, err := json.Marshal(updatedNote)
-		if err != nil {
-			return err
+		// Keep the attachments unless the request lists them
+		attachments := existing.Attachments
+		if req.Attachments != nil {
+			attachments = *req.Attachments
 		}
 
-		// Save updated note
-		return txn.Set([]byte(noteID), noteJSON)
+		return Note{
+			ID:          existing.ID,
+			Title:       req.Title,
+			Description: submitted.Description,
+			Format:      submitted.Format,
+			Tags:        tags,
+			Attachments: attachments,
+			CreatedAt:   existing.CreatedAt, // Keep original creation time
+			UpdatedAt:   time.Now(),         // Update the modification time
+		}, nil
 	})
 
 	if err != nil {
-		if err == badger.ErrKeyNotFound {
+		var perr *patchError
+		if errors.As(err, &perr) {
 			response := NoteResponse{
 				Success: false,
-				Message: "Note not found",
+				Message: perr.msg,
 			}
-			writeJSONResponse(w, http.StatusNotFound, response)
+			writeJSONResponse(w, http.StatusBadRequest, response)
 			return
 		}
 
-		response := NoteResponse{
-			Success: false,
-			Message: "Error updating note in database",
-		}
-		writeJSONResponse(w, http.StatusInternalServerError, response)
-		return
+		if stale, ok := asStale[Note](err); ok {
+			w.Header().Set("ETag", itemETag(stale.current.Version))
+			response := NoteResponse{
+				Success: false,
+				Message: "Note was changed by another request",
+				Data:    stale.current,
+			}
+			writeJSONResponse(w, stale.status, response)
+			return
+		}
+
+		if err == badger.ErrKeyNotFound {
+			response := NoteResponse{
+				Success: false,
+				Message: "Note not found",
+			}
+			writeJSONResponse(w, http.StatusNotFound, response)
+			return
+		}
+
+		response := NoteResponse{
+			Success: false,
+			Message: "Error updating note in database",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	// Return success response
+	response := NoteResponse{
+		Success:   true,
+		Message:   "Note updated successfully",
+		Data:      updatedNote,
+		Sanitized: report.orNil(),
+	}
+
+	w.Header().Set("ETag", itemETag(updatedNote.Version))
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// PatchNote applies a JSON Merge Patch with optional add_tags/remove_tags to a note
+func (h *NoteHandler) PatchNote(w http.ResponseWriter, r *http.Request) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get note ID from the {id} path segment
+	noteID := r.PathValue("id")
+
+	if noteID == "" {
+		response := NoteResponse{
+			Success: false,
+			Message: "Note ID is required",
+		}
+		writeJSONResponse(w, http.StatusBadRequest, response)
+		return
+	}
+
+	// Parse the patch document
+	patch, err := parseItemPatch(r)
+	if err != nil {
+		response := NoteResponse{
+			Success: false,
+			Message: err.Error(),
+		}
+		writeJSONResponse(w, http.StatusBadRequest, response)
+		return
 	}
 
-	// Update the tag counts with old and new tags
-	if err := h.updateNoteTagCounts(oldTags, updatedNote.Tags); err != nil {
-		// Log error but don't fail the request since note was updated
-		fmt.Printf("Warning: Failed to update note tag counts: %v\n", err)
+	// Apply the patch in BadgerDB, keeping what sanitizing removed
+	var report SanitizeReport
+	updated, err := h.store.patch(noteID, requestPrecondition(r), patch, func(n *Note) error {
+		var err error
+		report, err = validateNotePatch(n)
+		return err
+	})
+
+	if err != nil {
+		var perr *patchError
+		if errors.As(err, &perr) {
+			response := NoteResponse{
+				Success: false,
+				Message: perr.msg,
+			}
+			writeJSONResponse(w, http.StatusBadRequest, response)
+			return
+		}
+
+		if stale, ok := asStale[Note](err); ok {
+			w.Header().Set("ETag", itemETag(stale.current.Version))
+			response := NoteResponse{
+				Success: false,
+				Message: "Note was changed by another request",
+				Data:    stale.current,
+			}
+			writeJSONResponse(w, stale.status, response)
+			return
+		}
+
+		if err == badger.ErrKeyNotFound {
+			response := NoteResponse{
+				Success: false,
+				Message: "Note not found",
+			}
+			writeJSONResponse(w, http.StatusNotFound, response)
+			return
+		}
+
+		response := NoteResponse{
+			Success: false,
+			Message: "Error updating note in database",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	// Return success response
+	response := NoteResponse{
+		Success:   true,
+		Message:   "Note updated successfully",
+		Data:      updated,
+		Sanitized: report.orNil(),
+	}
+
+	w.Header().Set("ETag", itemETag(updated.Version))
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// validateNotePatch sanitizes a patched note and checks it like EditNote
+// checks its request, returning what sanitizing removed
+func validateNotePatch(n *Note) (SanitizeReport, error) {
+	if !validNoteFormat(n.Format) {
+		return SanitizeReport{}, &patchError{"Format must be html or markdown"}
+	}
+	report := sanitizeNote(n)
+	if n.Title == "" {
+		return report, &patchError{"Title is required"}
+	}
+	if strings.TrimSpace(n.Description) == "" {
+		return report, &patchError{"Description is required"}
+	}
+	return report, nil
+}
+
+// BulkNotes applies a list of delete, tag and set operations to many notes at once
+func (h *NoteHandler) BulkNotes(w http.ResponseWriter, r *http.Request) {
+	handleBulk(w, r, h.store, func(n *Note) error {
+		_, err := validateNotePatch(n)
+		return err
+	})
+}
+
+// GetNoteBacklinks lists the items linking to a note by ID or title
+func (h *NoteHandler) GetNoteBacklinks(w http.ResponseWriter, r *http.Request) {
+	handleBacklinks(w, r, h.store, "Note not found")
+}
+
+func (h *NoteHandler) GetNoteTrash(w http.ResponseWriter, r *http.Request) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	// Load trashed notes, most recently deleted first
+	items, err := h.store.trashed()
+	if err != nil {
+		response := NotesListResponse{
+			Success: false,
+			Message: "Error reading trash from database",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	// Return success response
+	response := NotesListResponse{
+		Success: true,
+		Message: "Trashed notes retrieved successfully",
+		Data:    items,
+		Count:   len(items),
+		Total:   len(items),
+	}
+
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+func (h *NoteHandler) RestoreNote(w http.ResponseWriter, r *http.Request) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get note ID from the {id} path segment
+	noteID := r.PathValue("id")
+
+	// Move the note back out of the trash
+	restored, err := h.store.restore(noteID)
+	if err != nil {
+		if err == badger.ErrKeyNotFound {
+			response := NoteResponse{
+				Success: false,
+				Message: "Note not found in trash",
+			}
+			writeJSONResponse(w, http.StatusNotFound, response)
+			return
+		}
+
+		if err == errRestoreConflict {
+			response := NoteResponse{
+				Success: false,
+				Message: "A note with this ID already exists",
+			}
+			writeJSONResponse(w, http.StatusConflict, response)
+			return
+		}
+
+		response := NoteResponse{
+			Success: false,
+			Message: "Error restoring note in database",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	// Return success response
+	response := NoteResponse{
+		Success: true,
+		Message: "Note restored successfully",
+		Data:    restored,
+	}
+
+	w.Header().Set("ETag", itemETag(restored.Version))
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+func (h *NoteHandler) PurgeNote(w http.ResponseWriter, r *http.Request) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get note ID from the {id} path segment
+	noteID := r.PathValue("id")
+
+	// Remove the note from the trash for good
+	if err := h.store.purge(noteID); err != nil {
+		if err == badger.ErrKeyNotFound {
+			response := DeleteNoteResponse{
+				Success: false,
+				Message: "Note not found in trash",
+			}
+			writeJSONResponse(w, http.StatusNotFound, response)
+			return
+		}
+
+		response := DeleteNoteResponse{
+			Success: false,
+			Message: "Error purging note from database",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	// Return success response
+	response := DeleteNoteResponse{
+		Success: true,
+		Message: "Note permanently deleted",
+	}
+
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+func (h *NoteHandler) EmptyNoteTrash(w http.ResponseWriter, r *http.Request) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	// Purge every trashed note
+	count, err := h.store.purgeTrash(time.Time{})
+	if err != nil {
+		response := EmptyTrashResponse{
+			Success: false,
+			Message: "Error emptying trash",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	// Return success response
+	response := EmptyTrashResponse{
+		Success: true,
+		Message: "Trash emptied successfully",
+		Count:   count,
+	}
+
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// GetNoteRevisions lists the kept earlier versions of a note, newest first
+func (h *NoteHandler) GetNoteRevisions(w http.ResponseWriter, r *http.Request) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get note ID from the {id} path segment
+	noteID := r.PathValue("id")
+
+	revisions, err := h.store.revisions(noteID)
+	if err != nil {
+		if err == badger.ErrKeyNotFound {
+			response := NotesListResponse{
+				Success: false,
+				Message: "Note not found",
+			}
+			writeJSONResponse(w, http.StatusNotFound, response)
+			return
+		}
+
+		response := NotesListResponse{
+			Success: false,
+			Message: "Error reading revisions from database",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	// Return success response
+	response := NotesListResponse{
+		Success: true,
+		Message: "Revisions retrieved successfully",
+		Data:    revisions,
+		Count:   len(revisions),
+		Total:   len(revisions),
+	}
+
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// GetNoteRevision returns a note as it was at one version
+func (h *NoteHandler) GetNoteRevision(w http.ResponseWriter, r *http.Request) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get note ID and revision from the path
+	noteID := r.PathValue("id")
+	rev, err := parseRevision(r.PathValue("rev"))
+	if err != nil || rev == 0 {
+		response := NoteResponse{
+			Success: false,
+			Message: "Revision must be a positive integer",
+		}
+		writeJSONResponse(w, http.StatusBadRequest, response)
+		return
+	}
+
+	var note Note
+	err = h.store.db.View(func(txn *badger.Txn) error {
+		note, err = h.store.at(txn, noteID, rev)
+		return err
+	})
+	if err != nil {
+		if err == badger.ErrKeyNotFound || err == errRevisionNotFound {
+			response := NoteResponse{
+				Success: false,
+				Message: "Note not found",
+			}
+			if err == errRevisionNotFound {
+				response.Message = "Revision not found"
+			}
+			writeJSONResponse(w, http.StatusNotFound, response)
+			return
+		}
+
+		response := NoteResponse{
+			Success: false,
+			Message: "Error reading revision from database",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	// Return success response
+	response := NoteResponse{
+		Success: true,
+		Message: "Revision retrieved successfully",
+		Data:    note,
+	}
+
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// GetNoteDiff compares two versions of a note. ?to defaults to the current
+// version and ?from to the newest revision before it.
+func (h *NoteHandler) GetNoteDiff(w http.ResponseWriter, r *http.Request) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get note ID from the {id} path segment
+	noteID := r.PathValue("id")
+
+	// Parse the versions to compare
+	from, err := parseRevision(r.URL.Query().Get("from"))
+	if err != nil {
+		response := NoteDiffResponse{
+			Success: false,
+			Message: "from must be a positive integer",
+		}
+		writeJSONResponse(w, http.StatusBadRequest, response)
+		return
+	}
+	to, err := parseRevision(r.URL.Query().Get("to"))
+	if err != nil {
+		response := NoteDiffResponse{
+			Success: false,
+			Message: "to must be a positive integer",
+		}
+		writeJSONResponse(w, http.StatusBadRequest, response)
+		return
+	}
+
+	older, newer, err := h.store.pair(noteID, from, to)
+	if err != nil {
+		if err == badger.ErrKeyNotFound || err == errRevisionNotFound {
+			response := NoteDiffResponse{
+				Success: false,
+				Message: "Note not found",
+			}
+			if err == errRevisionNotFound {
+				response.Message = "Revision not found"
+			}
+			writeJSONResponse(w, http.StatusNotFound, response)
+			return
+		}
+
+		response := NoteDiffResponse{
+			Success: false,
+			Message: "Error reading revisions from database",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	// Compare title, visible description text and tags
+	added, removed := tagChanges(older.Tags, newer.Tags)
+	diff := &NoteDiff{
+		From:        older.Version,
+		To:          newer.Version,
+		Title:       diffLines([]string{older.Title}, []string{newer.Title}),
+		Description: diffLines(textLines(older.descriptionHTML()), textLines(newer.descriptionHTML())),
+		AddedTags:   added,
+		RemovedTags: removed,
+	}
+
+	// Return success response
+	response := NoteDiffResponse{
+		Success: true,
+		Message: "Diff computed successfully",
+		Data:    diff,
+	}
+
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// RestoreNoteRevision writes an earlier version of a note back as its newest
+// version
+func (h *NoteHandler) RestoreNoteRevision(w http.ResponseWriter, r *http.Request) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get note ID and revision from the path
+	noteID := r.PathValue("id")
+	rev, err := parseRevision(r.PathValue("rev"))
+	if err != nil || rev == 0 {
+		response := NoteResponse{
+			Success: false,
+			Message: "Revision must be a positive integer",
+		}
+		writeJSONResponse(w, http.StatusBadRequest, response)
+		return
+	}
+
+	// Honor If-Match so a restore doesn't overwrite an unseen edit
+	restored, err := h.store.restoreRevision(noteID, rev, requestPrecondition(r))
+	if err != nil {
+		if stale, ok := asStale[Note](err); ok {
+			w.Header().Set("ETag", itemETag(stale.current.Version))
+			response := NoteResponse{
+				Success: false,
+				Message: "Note was changed by another request",
+				Data:    stale.current,
+			}
+			writeJSONResponse(w, stale.status, response)
+			return
+		}
+
+		if err == badger.ErrKeyNotFound || err == errRevisionNotFound {
+			response := NoteResponse{
+				Success: false,
+				Message: "Note not found",
+			}
+			if err == errRevisionNotFound {
+				response.Message = "Revision not found"
+			}
+			writeJSONResponse(w, http.StatusNotFound, response)
+			return
+		}
+
+		response := NoteResponse{
+			Success: false,
+			Message: "Error restoring revision in database",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	// Return success response
+	response := NoteResponse{
+		Success: true,
+		Message: "Revision restored successfully",
+		Data:    restored,
+	}
+
+	w.Header().Set("ETag", itemETag(restored.Version))
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// ConvertNote rewrites a note's description in another format as a new version
+func (h *NoteHandler) ConvertNote(w http.ResponseWriter, r *http.Request) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get note ID from the {id} path segment
+	noteID := r.PathValue("id")
+
+	// Parse JSON request body
+	var req ConvertNoteRequest
+	if err := readJSONRequest(r, &req); err != nil {
+		writeJSONResponse(w, http.StatusBadRequest, invalidJSONResponseNote)
+		return
+	}
+
+	if req.Format == "" || !validNoteFormat(req.Format) {
+		response := NoteResponse{
+			Success: false,
+			Message: "Format must be html or markdown",
+		}
+		writeJSONResponse(w, http.StatusBadRequest, response)
+		return
+	}
+
+	// Honor If-Match and the version the client loaded
+	pre := requestPrecondition(r)
+	pre.version = req.Version
+
+	// Convert the note in BadgerDB; the previous version is kept as a revision
+	converted, err := h.store.update(noteID, pre, func(existing Note) (Note, error) {
+		convertNote(&existing, req.Format)
+		existing.UpdatedAt = time.Now()
+		return existing, nil
+	})
+
+	if err != nil {
+		if stale, ok := asStale[Note](err); ok {
+			w.Header().Set("ETag", itemETag(stale.current.Version))
+			response := NoteResponse{
+				Success: false,
+				Message: "Note was changed by another request",
+				Data:    stale.current,
+			}
+			writeJSONResponse(w, stale.status, response)
+			return
+		}
+
+		if err == badger.ErrKeyNotFound {
+			response := NoteResponse{
+				Success: false,
+				Message: "Note not found",
+			}
+			writeJSONResponse(w, http.StatusNotFound, response)
+			return
+		}
+
+		response := NoteResponse{
+			Success: false,
+			Message: "Error converting note in database",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
 	}
 
 	// Return success response
 	response := NoteResponse{
 		Success: true,
-		Message: "Note updated successfully",
-		Data:    updatedNote,
+		Message: "Note converted successfully",
+		Data:    converted,
 	}
 
+	w.Header().Set("ETag", itemETag(converted.Version))
 	writeJSONResponse(w, http.StatusOK, response)
 }
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// openTestDB opens an in-memory database closed at the end of the test
+func openTestDB(t *testing.T) *badger.DB {
+	t.Helper()
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// serveNote calls a note handler with a JSON body and the {id} path value
+func serveNote(t *testing.T, handler http.HandlerFunc, method, target, id, body string) (*httptest.ResponseRecorder, NoteResponse) {
+	t.Helper()
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	if id != "" {
+		r.SetPathValue("id", id)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	var resp NoteResponse
+	if w.Code != http.StatusNotModified {
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s %s: decoding %q: %v", method, target, w.Body.String(), err)
+		}
+	}
+	return w, resp
+}
+
+func TestEditNoteKeepsAttachments(t *testing.T) {
+	db := openTestDB(t)
+	BlobDir = t.TempDir()
+	h := NewNoteHandler(db)
+
+	blob, err := saveBlob(db, strings.NewReader("%PDF-1.4 receipt"), "application/pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, created := serveNote(t, h.NewNote, http.MethodPost, "/api/v1/notes", "",
+		`{"title": "Receipt", "description": "<p>March</p>", "attachments": [{"blob": "`+blob.SHA256+`", "name": "receipt.pdf"}]}`)
+	if !created.Success || len(created.Data.Attachments) != 1 {
+		t.Fatalf("create: %+v", created)
+	}
+	id := created.Data.ID
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"omitted", `{"title": "Receipt", "description": "<p>April</p>", "tags": []}`, 1},
+		{"null", `{"title": "Receipt", "description": "<p>May</p>", "attachments": null}`, 1},
+		{"empty list", `{"title": "Receipt", "description": "<p>June</p>", "attachments": []}`, 0},
+	}
+	for _, tt := range tests {
+		w, resp := serveNote(t, h.EditNote, http.MethodPut, "/api/v1/notes/"+id, id, tt.body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", tt.name, w.Code, w.Body.String())
+		}
+		if got := len(resp.Data.Attachments); got != tt.want {
+			t.Errorf("%s: %d attachments, want %d", tt.name, got, tt.want)
+		}
+
+		// The blob must stay referenced, or the sweeper deletes its file
+		var referenced bool
+		db.View(func(txn *badger.Txn) error {
+			referenced = blobReferenced(txn, blob.SHA256)
+			return nil
+		})
+		if referenced != (tt.want > 0) {
+			t.Errorf("%s: blob referenced = %v", tt.name, referenced)
+		}
+	}
+}
+
+func TestEditNoteKeepsFormat(t *testing.T) {
+	db := openTestDB(t)
+	h := NewNoteHandler(db)
+
+	_, created := serveNote(t, h.NewNote, http.MethodPost, "/api/v1/notes", "",
+		`{"title": "Plan", "format": "markdown", "description": "# Plan\n\n- **ship** it"}`)
+	if !created.Success {
+		t.Fatalf("create: %+v", created)
+	}
+	id := created.Data.ID
+
+	tests := []struct {
+		name        string
+		body        string
+		format      string
+		description string
+	}{
+		{"omitted", `{"title": "Plan", "description": "# Plan\n\n<b>bold</b>"}`, noteFormatMarkdown, "# Plan\n\n<b>bold</b>"},
+		{"html", `{"title": "Plan", "format": "html", "description": "<p>x</p><script>alert(1)</script>"}`, noteFormatHTML, "<p>x</p>"},
+		{"omitted after html", `{"title": "Plan", "description": "<p>y</p><img src=x onerror=alert(1)>"}`, noteFormatHTML, "<p>y</p>"},
+	}
+	for _, tt := range tests {
+		w, resp := serveNote(t, h.EditNote, http.MethodPut, "/api/v1/notes/"+id, id, tt.body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", tt.name, w.Code, w.Body.String())
+		}
+		if resp.Data.Format != tt.format || resp.Data.Description != tt.description {
+			t.Errorf("%s: got format %q description %q, want %q %q",
+				tt.name, resp.Data.Format, resp.Data.Description, tt.format, tt.description)
+		}
+	}
+
+	// Markup the sanitizer removes entirely still leaves an empty description
+	w, _ := serveNote(t, h.EditNote, http.MethodPut, "/api/v1/notes/"+id, id,
+		`{"title": "Plan", "description": "<script>alert(1)</script>"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("script-only description: status %d, want 400", w.Code)
+	}
+}
+
+func TestGetNoteETagPerRepresentation(t *testing.T) {
+	db := openTestDB(t)
+	h := NewNoteHandler(db)
+
+	_, created := serveNote(t, h.NewNote, http.MethodPost, "/api/v1/notes", "",
+		`{"title": "Plan", "format": "markdown", "description": "**ship**"}`)
+	id := created.Data.ID
+
+	get := func(target, inm string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.SetPathValue("id", id)
+		if inm != "" {
+			r.Header.Set("If-None-Match", inm)
+		}
+		w := httptest.NewRecorder()
+		h.GetNote(w, r)
+		return w
+	}
+
+	raw := get("/api/v1/notes/"+id, "")
+	rendered := get("/api/v1/notes/"+id+"?render=html", "")
+	rawTag, renderedTag := raw.Header().Get("ETag"), rendered.Header().Get("ETag")
+	if rawTag == "" || rawTag == renderedTag {
+		t.Fatalf("ETags %q and %q must differ", rawTag, renderedTag)
+	}
+
+	tests := []struct {
+		target string
+		inm    string
+		want   int
+	}{
+		{"/api/v1/notes/" + id, rawTag, http.StatusNotModified},
+		{"/api/v1/notes/" + id, renderedTag, http.StatusOK},
+		{"/api/v1/notes/" + id + "?render=html", renderedTag, http.StatusNotModified},
+		{"/api/v1/notes/" + id + "?render=html", rawTag, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if got := get(tt.target, tt.inm).Code; got != tt.want {
+			t.Errorf("GET %s with If-None-Match %s: status %d, want %d", tt.target, tt.inm, got, tt.want)
+		}
+	}
+}
+
+func TestRenderedNotesSayHTML(t *testing.T) {
+	db := openTestDB(t)
+	h := NewNoteHandler(db)
+
+	_, created := serveNote(t, h.NewNote, http.MethodPost, "/api/v1/notes", "",
+		`{"title": "Plan", "format": "markdown", "description": "**ship**"}`)
+	id := created.Data.ID
+
+	tests := []struct {
+		target      string
+		format      string
+		description string
+	}{
+		{"/api/v1/notes/" + id, noteFormatMarkdown, "**ship**"},
+		{"/api/v1/notes/" + id + "?render=html", noteFormatHTML, "<p><strong>ship</strong></p>\n"},
+	}
+	for _, tt := range tests {
+		_, resp := serveNote(t, h.GetNote, http.MethodGet, tt.target, id, "")
+		if resp.Data.Format != tt.format || resp.Data.Description != tt.description {
+			t.Errorf("GET %s: format %q description %q, want %q %q",
+				tt.target, resp.Data.Format, resp.Data.Description, tt.format, tt.description)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/notes?render=html", nil)
+	w := httptest.NewRecorder()
+	h.GetNotes(w, r)
+	var list NotesListResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Data) != 1 || list.Data[0].Format != noteFormatHTML {
+		t.Errorf("rendered list: %+v", list.Data)
+	}
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// List paging
+//
+// List endpoints accept:
+//
+//	limit=N                                   page size (all matches when omitted)
+//	sort=created_at|updated_at|title|relevance
+//	order=asc|desc
+//	cursor=...                                next_cursor of the previous page
+//
+// Cursors record the sort key of the last item returned rather than an
+// offset, so paging stays stable while items are added or deleted.
+
+const maxPageLimit = 1000
+
+// Sort orders accepted by list endpoints. sortByID is the default key order.
+const (
+	sortByID        = "id"
+	sortByCreatedAt = "created_at"
+	sortByUpdatedAt = "updated_at"
+	sortByTitle     = "title"
+	sortByRelevance = "relevance"
+)
+
+// listPage holds the paging and ordering parameters of a list request
+type listPage struct {
+	Limit  int
+	Sort   string
+	Desc   bool
+	Cursor *pageCursor
+}
+
+// pageCursor is the position after which the next page starts
+type pageCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v,omitempty"` // sort value of the last item returned
+	ID    string `json:"i"`
+}
+
+func (c pageCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodePageCursor(s string) (*pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var c pageCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	if c.ID == "" {
+		return nil, fmt.Errorf("missing position")
+	}
+	return &c, nil
+}
+
+// parseListPage reads limit, sort, order and cursor from a list request.
+// Keyword searches default to relevance order; everything else to key order.
+func parseListPage(q url.Values, keywordSearch bool) (listPage, error) {
+	page := listPage{Sort: sortByID}
+	if keywordSearch {
+		page.Sort, page.Desc = sortByRelevance, true
+	}
+
+	if v := strings.TrimSpace(q.Get("limit")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return page, fmt.Errorf("limit must be a positive integer")
+		}
+		page.Limit = min(n, maxPageLimit)
+	}
+
+	switch v := strings.TrimSpace(q.Get("sort")); v {
+	case "":
+	case sortByCreatedAt, sortByUpdatedAt, sortByTitle:
+		page.Sort, page.Desc = v, false
+	case sortByRelevance:
+		if !keywordSearch {
+			return page, fmt.Errorf("sort=relevance requires keywords")
+		}
+		page.Sort, page.Desc = v, true
+	default:
+		return page, fmt.Errorf("sort must be one of created_at, updated_at, title or relevance")
+	}
+
+	switch v := strings.ToLower(strings.TrimSpace(q.Get("order"))); v {
+	case "":
+	case "asc":
+		page.Desc = false
+	case "desc":
+		page.Desc = true
+	default:
+		return page, fmt.Errorf("order must be asc or desc")
+	}
+
+	if v := strings.TrimSpace(q.Get("cursor")); v != "" {
+		c, err := decodePageCursor(v)
+		if err != nil {
+			return page, fmt.Errorf("invalid cursor")
+		}
+		if c.Sort != page.Sort || c.Desc != page.Desc {
+			return page, fmt.Errorf("cursor does not match the requested sort and order")
+		}
+		page.Cursor = c
+	}
+	return page, nil
+}
+
+// pageable is implemented by items returned from list endpoints
+type pageable interface {
+	indexID() string
+	searchField(name string) (string, bool)
+	searchTimes() (created, updated time.Time)
+	relevance() float64
+}
+
+// sortTimeLayout formats times so they order lexicographically
+const sortTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// pageSortValue returns the value an item is ordered by, ties broken by ID
+func pageSortValue(item pageable, sortBy string) string {
+	switch sortBy {
+	case sortByCreatedAt:
+		created, _ := item.searchTimes()
+		return created.UTC().Format(sortTimeLayout)
+	case sortByUpdatedAt:
+		_, updated := item.searchTimes()
+		return updated.UTC().Format(sortTimeLayout)
+	case sortByTitle:
+		title, _ := item.searchField("title")
+		return strings.ToLower(title)
+	case sortByRelevance:
+		return fmt.Sprintf("%020.6f", item.relevance())
+	}
+	return ""
+}
+
+// comparePageKeys orders (value, id) pairs
+func comparePageKeys(v1, id1, v2, id2 string) int {
+	if c := strings.Compare(v1, v2); c != 0 {
+		return c
+	}
+	return strings.Compare(id1, id2)
+}
+
+// paginate sorts items and returns the requested page with the cursor of the
+// page after it, empty when this is the last page.
+func paginate[T any, P interface {
+	*T
+	pageable
+}](items []T, page listPage) ([]T, string) {
+	values := make([]string, len(items))
+	order := make([]int, len(items))
+	for i := range items {
+		values[i] = pageSortValue(P(&items[i]), page.Sort)
+		order[i] = i
+	}
+
+	less := func(a, b int) bool {
+		c := comparePageKeys(values[a], P(&items[a]).indexID(), values[b], P(&items[b]).indexID())
+		if page.Desc {
+			return c > 0
+		}
+		return c < 0
+	}
+	sort.SliceStable(order, func(i, j int) bool { return less(order[i], order[j]) })
+
+	// Skip everything up to and including the cursor position
+	start := 0
+	if c := page.Cursor; c != nil {
+		start = sort.Search(len(order), func(i int) bool {
+			idx := order[i]
+			cmp := comparePageKeys(values[idx], P(&items[idx]).indexID(), c.Value, c.ID)
+			if page.Desc {
+				return cmp < 0
+			}
+			return cmp > 0
+		})
+	}
+
+	end := len(order)
+	if page.Limit > 0 && start+page.Limit < end {
+		end = start + page.Limit
+	}
+
+	out := make([]T, 0, end-start)
+	for _, idx := range order[start:end] {
+		out = append(out, items[idx])
+	}
+
+	next := ""
+	if end < len(order) && end > start {
+		last := order[end-1]
+		next = pageCursor{
+			Sort:  page.Sort,
+			Desc:  page.Desc,
+			Value: values[last],
+			ID:    P(&items[last]).indexID(),
+		}.encode()
+	}
+	return out, next
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// pageIDs pages through notes with the given order and limit, dropping the
+// IDs in remove from the list after the first page, and returns the pages as
+// space-separated IDs
+func pageIDs(t *testing.T, notes []Note, query string, remove ...string) []string {
+	t.Helper()
+	q, _ := url.ParseQuery(query)
+	var pages []string
+	for {
+		page, err := parseListPage(q, false)
+		if err != nil {
+			t.Fatalf("parseListPage(%s): %v", q.Encode(), err)
+		}
+		items, next := paginate[Note](notes, page)
+		var ids []string
+		for _, n := range items {
+			ids = append(ids, n.ID)
+		}
+		pages = append(pages, strings.Join(ids, " "))
+		if next == "" {
+			return pages
+		}
+		if len(pages) > len(notes) {
+			t.Fatalf("%s: paging doesn't end: %v", query, pages)
+		}
+		notes = slices.DeleteFunc(notes, func(n Note) bool { return slices.Contains(remove, n.ID) })
+		q.Set("cursor", next)
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	// Titles sort case-insensitively, ties by ID
+	notes := []Note{
+		{ID: "e", Title: "banana"},
+		{ID: "a", Title: "Cherry"},
+		{ID: "d", Title: "apple"},
+		{ID: "b", Title: "Banana"},
+		{ID: "c", Title: "date"},
+	}
+	tests := []struct {
+		query  string
+		remove []string
+		want   []string
+	}{
+		{"", nil, []string{"a b c d e"}},
+		{"limit=2", nil, []string{"a b", "c d", "e"}},
+		{"limit=5", nil, []string{"a b c d e"}},
+		{"limit=2&order=desc", nil, []string{"e d", "c b", "a"}},
+		{"limit=2&sort=title", nil, []string{"d b", "e a", "c"}},
+		{"limit=3&sort=title&order=desc", nil, []string{"c a e", "b d"}},
+		// Removing the cursor item or earlier ones doesn't shift later pages
+		{"limit=2&sort=title", []string{"b", "d"}, []string{"d b", "e a", "c"}},
+		{"limit=2", []string{"a"}, []string{"a b", "c d", "e"}},
+	}
+	for _, tt := range tests {
+		got := pageIDs(t, slices.Clone(notes), tt.query, tt.remove...)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q removing %v: pages %q, want %q", tt.query, tt.remove, got, tt.want)
+		}
+	}
+}
+
+func TestParseListPageErrors(t *testing.T) {
+	titleCursor := pageCursor{Sort: sortByTitle, Value: "apple", ID: "d"}.encode()
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"limit=0", "limit must be a positive integer"},
+		{"limit=ten", "limit must be a positive integer"},
+		{"sort=size", "sort must be one of created_at, updated_at, title or relevance"},
+		{"sort=relevance", "sort=relevance requires keywords"},
+		{"order=up", "order must be asc or desc"},
+		{"cursor=not*base64", "invalid cursor"},
+		{"cursor=e30", "invalid cursor"},
+		{"cursor=" + titleCursor, "cursor does not match the requested sort and order"},
+		{"sort=title&order=desc&cursor=" + titleCursor, "cursor does not match the requested sort and order"},
+	}
+	for _, tt := range tests {
+		q, _ := url.ParseQuery(tt.query)
+		if _, err := parseListPage(q, false); err == nil || err.Error() != tt.want {
+			t.Errorf("parseListPage(%s) = %v, want %q", tt.query, err, tt.want)
+		}
+	}
+
+	q, _ := url.ParseQuery("limit=5000&sort=title&cursor=" + titleCursor)
+	page, err := parseListPage(q, false)
+	if err != nil || page.Limit != maxPageLimit || page.Cursor == nil || page.Cursor.ID != "d" {
+		t.Errorf("parseListPage(%s) = %+v, %v", q.Encode(), page, err)
+	}
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Partial updates
+//
+// PATCH bodies are JSON Merge Patch documents (RFC 7386): members replace the
+// item's fields, null removes them and nested objects merge recursively. Two
+// extra members edit tags without sending the whole list:
+//
+//	{"title": "New title", "add_tags": ["go"], "remove_tags": ["draft"]}
+//
+// "tags" is merged first, then add_tags and remove_tags are applied, then
+// the result is normalized through tag aliases as in the full edit path. A
+// "version" member is the version the client expects to patch (see
+// conditional.go), not a new value. Patched attachments are checked against
+// the stored blobs when the item is written, as in a full edit, so unknown
+// blobs are refused and sizes and content types come from the blobs.
+
+// TagOperations are the tag-specific members of a PATCH body
+type TagOperations struct {
+	AddTags    []string `json:"add_tags,omitempty"`    // Tags to add if missing
+	RemoveTags []string `json:"remove_tags,omitempty"` // Tags to remove, matched case-insensitively
+}
+
+// readOnlyFields can't be changed by a patch; the server maintains them
+var readOnlyFields = map[string]bool{
+	"id":         true,
+	"created_at": true,
+	"updated_at": true,
+	"deleted_at": true,
+	"score":      true,
+	"video_id":   true,
+}
+
+// patchError is a client mistake in a patch. Its message is returned to the
+// client with 400 Bad Request.
+type patchError struct {
+	msg string
+}
+
+func (e *patchError) Error() string { return e.msg }
+
+// itemPatch is a parsed PATCH body
+type itemPatch struct {
+	merge   map[string]interface{}
+	version int64 // expected version, 0 if the patch has none
+	TagOperations
+}
+
+// parseItemPatch reads a merge patch with optional tag operations from the
+// request body
+func parseItemPatch(r *http.Request) (*itemPatch, error) {
+	var doc interface{}
+	if err := readJSONRequest(r, &doc); err != nil {
+		return nil, &patchError{"Invalid JSON format"}
+	}
+	merge, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, &patchError{"Patch must be a JSON object"}
+	}
+
+	p := &itemPatch{merge: merge}
+	var err error
+	if p.AddTags, err = patchStrings(merge, "add_tags"); err != nil {
+		return nil, err
+	}
+	if p.RemoveTags, err = patchStrings(merge, "remove_tags"); err != nil {
+		return nil, err
+	}
+
+	// A version names the version being patched rather than a new value
+	if v, ok := merge["version"]; ok {
+		delete(merge, "version")
+		n, ok := v.(float64)
+		if !ok || n < 1 || n != float64(int64(n)) {
+			return nil, &patchError{"'version' must be a positive integer"}
+		}
+		p.version = int64(n)
+	}
+	if err := checkWritable(merge); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// checkWritable rejects patches of fields the server maintains
+func checkWritable(merge map[string]interface{}) error {
+	for field := range merge {
+		if readOnlyFields[field] {
+			return &patchError{"Field '" + field + "' is read-only"}
+		}
+	}
+	return nil
+}
+
+// patchStrings removes a member holding a list of strings from the patch
+func patchStrings(merge map[string]interface{}, name string) ([]string, error) {
+	v, ok := merge[name]
+	if !ok {
+		return nil, nil
+	}
+	delete(merge, name)
+	if v == nil {
+		return nil, nil
+	}
+
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, &patchError{"'" + name + "' must be a list of tags"}
+	}
+	out := make([]string, 0, len(list))
+	for _, item := range list {
+		s, ok := item.(string)
+		if !ok {
+			return nil, &patchError{"'" + name + "' must be a list of tags"}
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// mergePatch applies an RFC 7386 merge patch to target and returns the result
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{}, len(p))
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
+
+// mergeItem applies a merge patch to the JSON form of an item
+func mergeItem[T any](existing T, merge map[string]interface{}) (T, error) {
+	var updated T
+	data, err := json.Marshal(existing)
+	if err != nil {
+		return updated, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return updated, err
+	}
+	doc = mergePatch(doc, merge)
+	if data, err = json.Marshal(doc); err != nil {
+		return updated, err
+	}
+	if err := json.Unmarshal(data, &updated); err != nil {
+		return updated, &patchError{"Patch has a field of the wrong type"}
+	}
+	return updated, nil
+}
+
+// applyTagOperations adds and removes tags, leaving the order of kept tags
+// unchanged
+func applyTagOperations(tags []string, ops TagOperations) []string {
+	out := make([]string, 0, len(tags)+len(ops.AddTags))
+	has := func(tag string) bool {
+		for _, t := range out {
+			if strings.EqualFold(t, tag) {
+				return true
+			}
+		}
+		return false
+	}
+	removed := func(tag string) bool {
+		for _, t := range ops.RemoveTags {
+			if strings.EqualFold(strings.TrimSpace(t), tag) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, tag := range tags {
+		if !removed(tag) {
+			out = append(out, tag)
+		}
+	}
+	for _, tag := range ops.AddTags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !has(tag) && !removed(tag) {
+			out = append(out, tag)
+		}
+	}
+	return out
+}
+
+// patch applies a parsed PATCH body to an item. validate checks the patched
+// item and may fill derived fields; a *patchError it returns is reported to
+// the client. The tag counts, postings and search index are updated as for
+// a full edit.
+func (s *store[T, P]) patch(id string, pre precondition, p *itemPatch, validate func(item P) error) (T, error) {
+	aliases := s.aliasMap()
+	if p.version != 0 {
+		pre.version = p.version
+	}
+
+	return s.update(id, pre, func(existing T) (T, error) {
+		updated, err := mergeItem(existing, p.merge)
+		if err != nil {
+			return updated, err
+		}
+
+		item := P(&updated)
+		tags := applyTagOperations(item.searchTags(), p.TagOperations)
+		item.setTags(normalizeTags(tags, aliases))
+		if err := validate(item); err != nil {
+			return updated, err
+		}
+		item.setUpdatedAt(time.Now())
+		return updated, nil
+	})
+}
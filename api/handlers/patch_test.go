@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	// Cases from RFC 7386, appendix A, plus deeper nesting
+	tests := []struct {
+		target, patch, want string
+	}{
+		{`{"a": "b"}`, `{"a": "c"}`, `{"a": "c"}`},
+		{`{"a": "b"}`, `{"b": "c"}`, `{"a": "b", "b": "c"}`},
+		{`{"a": "b"}`, `{"a": null}`, `{}`},
+		{`{"a": "b", "b": "c"}`, `{"a": null}`, `{"b": "c"}`},
+		{`{"a": ["b"]}`, `{"a": "c"}`, `{"a": "c"}`},
+		{`{"a": "c"}`, `{"a": ["b"]}`, `{"a": ["b"]}`},
+		{`{"a": {"b": "c"}}`, `{"a": {"b": "d", "c": null}}`, `{"a": {"b": "d"}}`},
+		{`{"a": [{"b": "c"}]}`, `{"a": [1]}`, `{"a": [1]}`},
+		{`["a", "b"]`, `["c", "d"]`, `["c", "d"]`},
+		{`{"a": "b"}`, `["c"]`, `["c"]`},
+		{`{"a": "foo"}`, `null`, `null`},
+		{`{"a": "foo"}`, `"bar"`, `"bar"`},
+		{`{"e": null}`, `{"a": 1}`, `{"e": null, "a": 1}`},
+		{`[1, 2]`, `{"a": "b", "c": null}`, `{"a": "b"}`},
+		{`{}`, `{"a": {"bb": {"ccc": null}}}`, `{"a": {"bb": {}}}`},
+		{`{"a": {"b": {"c": 1, "d": 2}}}`, `{"a": {"b": {"c": null, "e": 3}}}`, `{"a": {"b": {"d": 2, "e": 3}}}`},
+		{`{"a": {"b": 1}}`, `{"a": null}`, `{}`},
+		{`{"a": 1}`, `{"a": {"b": null}}`, `{"a": {}}`},
+		{`{"a": 1}`, `{}`, `{"a": 1}`},
+	}
+	decode := func(s string) interface{} {
+		var v interface{}
+		if err := json.Unmarshal([]byte(s), &v); err != nil {
+			t.Fatalf("decoding %s: %v", s, err)
+		}
+		return v
+	}
+	for _, tt := range tests {
+		got := mergePatch(decode(tt.target), decode(tt.patch))
+		if want := decode(tt.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("mergePatch(%s, %s) = %v, want %s", tt.target, tt.patch, got, tt.want)
+		}
+	}
+}
+
+func TestApplyTagOperations(t *testing.T) {
+	tests := []struct {
+		tags []string
+		ops  TagOperations
+		want []string
+	}{
+		{[]string{"go", "web"}, TagOperations{AddTags: []string{"rust"}}, []string{"go", "web", "rust"}},
+		{[]string{"go", "web"}, TagOperations{AddTags: []string{" GO ", "", "new", "new"}}, []string{"go", "web", "new"}},
+		{[]string{"go", "Draft", "web"}, TagOperations{RemoveTags: []string{" draft "}}, []string{"go", "web"}},
+		{[]string{"go"}, TagOperations{AddTags: []string{"old"}, RemoveTags: []string{"OLD"}}, []string{"go"}},
+		{nil, TagOperations{}, []string{}},
+	}
+	for _, tt := range tests {
+		if got := applyTagOperations(tt.tags, tt.ops); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("applyTagOperations(%v, %+v) = %v, want %v", tt.tags, tt.ops, got, tt.want)
+		}
+	}
+}
+
+func TestPatchNoteServerFields(t *testing.T) {
+	db := openTestDB(t)
+	BlobDir = t.TempDir()
+	h := NewNoteHandler(db)
+
+	blob, err := saveBlob(db, strings.NewReader("%PDF-1.4 receipt"), "application/pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, created := serveNote(t, h.NewNote, http.MethodPost, "/api/v1/notes", "",
+		`{"title": "Receipt", "description": "<p>March</p>"}`)
+	id := created.Data.ID
+
+	tests := []struct {
+		name        string
+		body        string
+		want        int
+		attachments int
+	}{
+		{"deleted_at", `{"deleted_at": "2020-01-01T00:00:00Z"}`, http.StatusBadRequest, 0},
+		{"created_at", `{"created_at": "2020-01-01T00:00:00Z"}`, http.StatusBadRequest, 0},
+		{"unknown blob", `{"attachments": [{"blob": "` + strings.Repeat("0", 64) + `"}]}`, http.StatusBadRequest, 0},
+		{"attachment without blob", `{"attachments": [{"name": "x.pdf"}]}`, http.StatusBadRequest, 0},
+		{"forged size", `{"attachments": [{"blob": "` + blob.SHA256 + `", "size": 1, "content_type": "text/html"}]}`, http.StatusOK, 1},
+		{"null", `{"attachments": null}`, http.StatusOK, 0},
+	}
+	for _, tt := range tests {
+		w, resp := serveNote(t, h.PatchNote, http.MethodPatch, "/api/v1/notes/"+id, id, tt.body)
+		if w.Code != tt.want {
+			t.Fatalf("%s: status %d, want %d: %s", tt.name, w.Code, tt.want, w.Body.String())
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		if resp.Data.DeletedAt != nil {
+			t.Errorf("%s: note has deleted_at", tt.name)
+		}
+		if got := len(resp.Data.Attachments); got != tt.attachments {
+			t.Fatalf("%s: %d attachments, want %d", tt.name, got, tt.attachments)
+		}
+		for _, att := range resp.Data.Attachments {
+			if att.Size != blob.Size || att.ContentType != blob.ContentType {
+				t.Errorf("%s: attachment %+v doesn't describe the blob %+v", tt.name, att, blob)
+			}
+		}
+	}
+}
+
+func TestPatchNoteReportsSanitizing(t *testing.T) {
+	db := openTestDB(t)
+	h := NewNoteHandler(db)
+
+	_, created := serveNote(t, h.NewNote, http.MethodPost, "/api/v1/notes", "",
+		`{"title": "Plain", "description": "<p>kept</p>"}`)
+	id := created.Data.ID
+
+	tests := []struct {
+		name        string
+		body        string
+		want        int
+		description string
+		attrs       []string
+	}{
+		{"bad format checked first", `{"format": "rtf", "description": "<p onclick=\"x\">hi</p>"}`, http.StatusBadRequest, "", nil},
+		{"html", `{"description": "<p onclick=\"x\">hi</p>"}`, http.StatusOK, "<p>hi</p>", []string{"onclick"}},
+		{"markdown kept as written", `{"format": "markdown", "description": "<b onclick=\"x\">hi</b>"}`, http.StatusOK, `<b onclick="x">hi</b>`, nil},
+	}
+	for _, tt := range tests {
+		w, resp := serveNote(t, h.PatchNote, http.MethodPatch, "/api/v1/notes/"+id, id, tt.body)
+		if w.Code != tt.want {
+			t.Fatalf("%s: status %d, want %d: %s", tt.name, w.Code, tt.want, w.Body.String())
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		if resp.Data.Description != tt.description {
+			t.Errorf("%s: description %q, want %q", tt.name, resp.Data.Description, tt.description)
+		}
+		var attrs []string
+		if resp.Sanitized != nil {
+			attrs = resp.Sanitized.RemovedAttributes
+		}
+		if !reflect.DeepEqual(attrs, tt.attrs) {
+			t.Errorf("%s: removed attributes %v, want %v", tt.name, attrs, tt.attrs)
+		}
+	}
+}
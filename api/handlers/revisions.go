@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Revision history
+//
+// Stores created with a RevisionLimit keep the state an item had before each
+// write under
+//
+//	rev/<type>/<id>/<version>
+//
+// with the version zero-padded so keys sort oldest first. Only the newest
+// RevisionLimit revisions of an item are kept. Revisions survive a move to
+// the trash and are dropped when the item is purged.
+
+// NoteRevisionLimit is how many earlier versions are kept per note; 0 turns
+// revision history off. Set it before creating handlers.
+var NoteRevisionLimit = 50
+
+// errRevisionNotFound means an item exists but not the requested revision
+var errRevisionNotFound = errors.New("revision not found")
+
+// maxDiffCells bounds the line-by-line comparison table of a diff
+const maxDiffCells = 4_000_000
+
+// revisionLog keeps earlier versions of the items of one type
+type revisionLog struct {
+	kind  string
+	limit int
+}
+
+func (rl *revisionLog) prefix(id string) []byte {
+	return []byte(revisionKeyPrefix + rl.kind + "/" + id + "/")
+}
+
+func (rl *revisionLog) key(id string, version int64) []byte {
+	return append(rl.prefix(id), fmt.Sprintf("%020d", version)...)
+}
+
+// keys returns the revision keys of an item, oldest first
+func (rl *revisionLog) keys(txn *badger.Txn, id string) [][]byte {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = rl.prefix(id)
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	var keys [][]byte
+	for it.Rewind(); it.Valid(); it.Next() {
+		keys = append(keys, it.Item().KeyCopy(nil))
+	}
+	return keys
+}
+
+// record stores an item's state as a revision and drops revisions beyond
+// the limit
+func (rl *revisionLog) record(txn *badger.Txn, id string, version int64, item interface{}) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	if err := txn.Set(rl.key(id, version), data); err != nil {
+		return err
+	}
+
+	keys := rl.keys(txn, id)
+	for i := 0; i < len(keys)-rl.limit; i++ {
+		if err := txn.Delete(keys[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// drop removes all revisions of an item
+func (rl *revisionLog) drop(txn *badger.Txn, id string) error {
+	for _, key := range rl.keys(txn, id) {
+		if err := txn.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseRevision reads a revision number from a path segment or query
+// parameter; an empty value is 0
+func parseRevision(v string) (int64, error) {
+	if v == "" {
+		return 0, nil
+	}
+	version, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("revision must be a positive integer")
+	}
+	return version, nil
+}
+
+// recordRevision keeps the state an item had before a write, if the store
+// keeps revisions
+func (s *store[T, P]) recordRevision(txn *badger.Txn, existing T) error {
+	if s.history == nil {
+		return nil
+	}
+	item := P(&existing)
+	return s.history.record(txn, item.indexID(), item.version(), existing)
+}
+
+// revisions returns the stored revisions of an item, newest first. It
+// returns badger.ErrKeyNotFound if the item doesn't exist.
+func (s *store[T, P]) revisions(id string) ([]T, error) {
+	revs := []T{}
+	err := s.db.View(func(txn *badger.Txn) error {
+		if _, err := txn.Get(s.key(id)); err != nil {
+			return err
+		}
+		if s.history == nil {
+			return nil
+		}
+
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = s.history.prefix(id)
+		opts.Reverse = true
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		// Reverse iteration starts at the largest key with the prefix
+		for it.Seek(append(s.history.prefix(id), 0xFF)); it.Valid(); it.Next() {
+			var rev T
+			if err := it.Item().Value(func(val []byte) error { return json.Unmarshal(val, &rev) }); err != nil {
+				return err
+			}
+			revs = append(revs, rev)
+		}
+		return nil
+	})
+	return revs, err
+}
+
+// at returns an item as it was at a version: the live item for its current
+// version, a revision otherwise. It returns badger.ErrKeyNotFound if the item
+// doesn't exist and errRevisionNotFound if the version isn't kept.
+func (s *store[T, P]) at(txn *badger.Txn, id string, version int64) (T, error) {
+	current, err := s.get(txn, id)
+	if err != nil || P(&current).version() == version {
+		return current, err
+	}
+
+	var rev T
+	if s.history == nil {
+		return rev, errRevisionNotFound
+	}
+	it, err := txn.Get(s.history.key(id, version))
+	if err == badger.ErrKeyNotFound {
+		return rev, errRevisionNotFound
+	}
+	if err != nil {
+		return rev, err
+	}
+	err = it.Value(func(val []byte) error { return json.Unmarshal(val, &rev) })
+	return rev, err
+}
+
+// previousVersion returns the newest kept revision older than version, or
+// errRevisionNotFound if there is none
+func (s *store[T, P]) previousVersion(txn *badger.Txn, id string, version int64) (int64, error) {
+	if s.history == nil {
+		return 0, errRevisionNotFound
+	}
+	var prev int64
+	for _, key := range s.history.keys(txn, id) {
+		var v int64
+		if _, err := fmt.Sscanf(string(key[len(s.history.prefix(id)):]), "%d", &v); err == nil && v < version {
+			prev = v
+		}
+	}
+	if prev == 0 {
+		return 0, errRevisionNotFound
+	}
+	return prev, nil
+}
+
+// pair returns an item at two versions for a diff. A zero to means the
+// current version and a zero from the newest revision before to.
+func (s *store[T, P]) pair(id string, from, to int64) (a, b T, err error) {
+	err = s.db.View(func(txn *badger.Txn) error {
+		if to == 0 {
+			current, err := s.get(txn, id)
+			if err != nil {
+				return err
+			}
+			to = P(&current).version()
+		}
+		if b, err = s.at(txn, id, to); err != nil {
+			return err
+		}
+		if from == 0 {
+			if from, err = s.previousVersion(txn, id, to); err != nil {
+				return err
+			}
+		}
+		a, err = s.at(txn, id, from)
+		return err
+	})
+	return a, b, err
+}
+
+// restoreRevision writes a revision's content back as a new version of the
+// item. The current state becomes a revision itself, so a restore can be
+// undone.
+func (s *store[T, P]) restoreRevision(id string, version int64, pre precondition) (T, error) {
+	aliases := s.aliasMap()
+
+	var rev T
+	err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		if rev, err = s.at(txn, id, version); err != nil {
+			return err
+		}
+		// Revisions don't keep blobs alive; leave out the ones since deleted
+		return s.resolveAttachments(txn, P(&rev), true)
+	})
+	if err != nil {
+		return rev, err
+	}
+
+	return s.update(id, pre, func(existing T) (T, error) {
+		restored := rev
+		item := P(&restored)
+		item.setTags(normalizeTags(item.searchTags(), aliases))
+		item.setDeletedAt(nil)
+		item.setScore(0)
+		item.setUpdatedAt(time.Now())
+		return restored, nil
+	})
+}
+
+// Diffs
+
+// DiffLine is one line of a diff
+type DiffLine struct {
+	Op   string `json:"op"` // equal, insert or delete
+	Text string `json:"text"`
+}
+
+// blockTagPattern matches tags that start a new line of visible text
+var blockTagPattern = regexp.MustCompile(`(?i)<(?:/?(?:p|div|li|ul|ol|h[1-6]|tr|table|blockquote|pre)\b[^>]*|br\s*/?)>`)
+
+// textLines returns the visible text of an HTML fragment, one block per line
+func textLines(s string) []string {
+	text := stripHTML(blockTagPattern.ReplaceAllString(s, "\n$0"))
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// diffLines compares two lists of lines using their longest common
+// subsequence. Inputs too large for the comparison table are reported as a
+// full replacement after their common prefix and suffix.
+func diffLines(a, b []string) []DiffLine {
+	out := []DiffLine{}
+
+	// Common prefix and suffix don't need the table
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	for _, line := range a[:prefix] {
+		out = append(out, DiffLine{Op: "equal", Text: line})
+	}
+	tail := a[len(a)-suffix:]
+	a, b = a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	if len(a)*len(b) > maxDiffCells {
+		for _, line := range a {
+			out = append(out, DiffLine{Op: "delete", Text: line})
+		}
+		for _, line := range b {
+			out = append(out, DiffLine{Op: "insert", Text: line})
+		}
+	} else {
+		// lcs[i][j] is the LCS length of a[i:] and b[j:]
+		lcs := make([][]int32, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+
+		i, j := 0, 0
+		for i < len(a) && j < len(b) {
+			switch {
+			case a[i] == b[j]:
+				out = append(out, DiffLine{Op: "equal", Text: a[i]})
+				i++
+				j++
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				out = append(out, DiffLine{Op: "delete", Text: a[i]})
+				i++
+			default:
+				out = append(out, DiffLine{Op: "insert", Text: b[j]})
+				j++
+			}
+		}
+		for ; i < len(a); i++ {
+			out = append(out, DiffLine{Op: "delete", Text: a[i]})
+		}
+		for ; j < len(b); j++ {
+			out = append(out, DiffLine{Op: "insert", Text: b[j]})
+		}
+	}
+
+	for _, line := range tail {
+		out = append(out, DiffLine{Op: "equal", Text: line})
+	}
+	return out
+}
+
+// tagChanges returns the tags only in b and the tags only in a
+func tagChanges(a, b []string) (added, removed []string) {
+	added, removed = []string{}, []string{}
+	inA := make(map[string]bool, len(a))
+	for _, tag := range a {
+		inA[tag] = true
+	}
+	inB := make(map[string]bool, len(b))
+	for _, tag := range b {
+		inB[tag] = true
+		if !inA[tag] {
+			added = append(added, tag)
+		}
+	}
+	for _, tag := range a {
+		if !inB[tag] {
+			removed = append(removed, tag)
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// formatDiff writes a diff as space-separated lines prefixed with = - or +
+func formatDiff(lines []DiffLine) string {
+	marks := map[string]string{"equal": "=", "delete": "-", "insert": "+"}
+	parts := make([]string, len(lines))
+	for i, l := range lines {
+		parts[i] = marks[l.Op] + l.Text
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestDiffLines(t *testing.T) {
+	split := func(s string) []string { return strings.Fields(s) }
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"both empty", "", "", ""},
+		{"from empty", "", "a b", "+a +b"},
+		{"to empty", "a b", "", "-a -b"},
+		{"identical", "a b c", "a b c", "=a =b =c"},
+		{"replace all", "a b", "c d", "-a -b +c +d"},
+		{"insert in middle", "a c", "a b c", "=a +b =c"},
+		{"delete in middle", "a b c", "a c", "=a -b =c"},
+		{"insert at start", "b c", "a b c", "+a =b =c"},
+		{"delete at end", "a b c", "a b", "=a =b -c"},
+		{"change in middle", "a b c", "a x c", "=a -b +x =c"},
+		{"repeated lines", "a a a", "a a", "=a =a -a"},
+		{"repeated prefix and suffix", "x a x", "x x", "=x -a =x"},
+		{"reorder", "a b c", "c a b", "+c =a =b -c"},
+		{"swap", "a b", "b a", "-a =b +a"},
+		{"interleaved", "a b c d e", "b x d y", "-a =b -c +x =d -e +y"},
+	}
+	for _, tt := range tests {
+		if got := formatDiff(diffLines(split(tt.a), split(tt.b))); got != tt.want {
+			t.Errorf("%s: diff = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDiffLinesTooLargeForTable(t *testing.T) {
+	// Past maxDiffCells the middle is reported as a full replacement while
+	// the common prefix and suffix still show as equal
+	n := 2001
+	a := []string{"head"}
+	b := []string{"head"}
+	for i := 0; i < n; i++ {
+		a = append(a, "a"+strconv.Itoa(i))
+		b = append(b, "b"+strconv.Itoa(i))
+	}
+	a = append(a, "shared", "tail")
+	b = append(b, "tail")
+
+	diff := diffLines(a, b)
+	if len(diff) != 2*n+3 {
+		t.Fatalf("%d diff lines, want %d", len(diff), 2*n+3)
+	}
+	counts := map[string]int{}
+	for _, l := range diff {
+		counts[l.Op]++
+	}
+	if counts["equal"] != 2 || counts["delete"] != n+1 || counts["insert"] != n {
+		t.Errorf("ops = %v", counts)
+	}
+	if first, last := diff[0], diff[len(diff)-1]; first != (DiffLine{"equal", "head"}) || last != (DiffLine{"equal", "tail"}) {
+		t.Errorf("diff starts with %+v and ends with %+v", first, last)
+	}
+	if diff[n+1] != (DiffLine{"delete", "shared"}) || diff[n+2] != (DiffLine{"insert", "b0"}) {
+		t.Errorf("deletions should precede insertions: %+v %+v", diff[n+1], diff[n+2])
+	}
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// HTML sanitization
+//
+// Note descriptions are rendered as HTML by the web app, so they are reduced
+// to the markup the WysiwygEditor produces: block and list elements, bold,
+// italic and underline, without any attributes. Other elements are unwrapped
+// so their text survives; elements whose content is never visible text
+// (scripts, styles, embedded documents) are dropped along with it. Text is
+// escaped the way browsers serialize innerHTML, so clean editor output passes
+// through unchanged.
+
+// allowedTags are the elements kept in note descriptions
+var allowedTags = map[string]bool{
+	"p": true, "div": true, "br": true, "span": true,
+	"b": true, "strong": true, "i": true, "em": true, "u": true,
+	"ul": true, "ol": true, "li": true,
+	"h1": true, "h2": true, "h3": true,
+}
+
+// droppedTags are removed together with everything inside them
+var droppedTags = map[string]bool{
+	"script": true, "style": true, "iframe": true, "frame": true, "frameset": true,
+	"object": true, "embed": true, "applet": true, "noscript": true, "noembed": true,
+	"noframes": true, "template": true, "textarea": true, "select": true,
+	"title": true, "head": true, "svg": true, "math": true, "xmp": true,
+}
+
+// voidTags have no closing tag
+var voidTags = map[string]bool{"br": true}
+
+// textEscaper escapes text the way browsers serialize innerHTML
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\u00a0", "&nbsp;")
+
+// SanitizeReport lists what sanitizing removed from a piece of HTML
+type SanitizeReport struct {
+	RemovedTags       []string `json:"removed_tags,omitempty"`       // Elements removed or unwrapped
+	RemovedAttributes []string `json:"removed_attributes,omitempty"` // Attributes stripped from kept elements
+}
+
+// empty reports whether nothing was removed
+func (r *SanitizeReport) empty() bool {
+	return len(r.RemovedTags) == 0 && len(r.RemovedAttributes) == 0
+}
+
+// orNil returns the report, or nil if nothing was removed, for optional
+// response fields
+func (r SanitizeReport) orNil() *SanitizeReport {
+	if r.empty() {
+		return nil
+	}
+	return &r
+}
+
+// sanitizeHTML reduces s to the allowed elements and reports what it removed
+func sanitizeHTML(s string) (string, SanitizeReport) {
+	var b strings.Builder
+	removedTags := make(map[string]bool)
+	removedAttrs := make(map[string]bool)
+	skip := 0 // depth inside dropped elements
+
+	z := html.NewTokenizer(strings.NewReader(s))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break // io.EOF; the tokenizer doesn't fail on malformed input
+		}
+
+		switch tt {
+		case html.TextToken:
+			if skip == 0 {
+				b.WriteString(textEscaper.Replace(string(z.Text())))
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			name, hasAttr := z.TagName()
+			tag := string(name)
+
+			if droppedTags[tag] {
+				removedTags[tag] = true
+				if tt == html.StartTagToken {
+					skip++
+				} else if tt == html.EndTagToken && skip > 0 {
+					skip--
+				}
+				continue
+			}
+			if skip > 0 {
+				continue
+			}
+			if !allowedTags[tag] {
+				removedTags[tag] = true
+				continue
+			}
+
+			for hasAttr {
+				var key []byte
+				key, _, hasAttr = z.TagAttr()
+				removedAttrs[string(key)] = true
+			}
+			switch {
+			case tt == html.EndTagToken:
+				if !voidTags[tag] {
+					b.WriteString("</" + tag + ">")
+				}
+			default:
+				b.WriteString("<" + tag + ">")
+				if tt == html.SelfClosingTagToken && !voidTags[tag] {
+					b.WriteString("</" + tag + ">")
+				}
+			}
+
+		case html.CommentToken, html.DoctypeToken:
+			// Neither is visible; drop them silently
+		}
+	}
+
+	return b.String(), SanitizeReport{
+		RemovedTags:       sortedKeys(removedTags),
+		RemovedAttributes: sortedKeys(removedAttrs),
+	}
+}
+
+func sortedKeys(set map[string]bool) []string {
+	if len(set) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sanitizeNote sanitizes an HTML note's description in place. Markdown is
+// stored as written; its raw HTML is left out when it is rendered.
+func sanitizeNote(n *Note) SanitizeReport {
+	var report SanitizeReport
+	if n.descriptionFormat() != noteFormatHTML {
+		return report
+	}
+	n.Description, report = sanitizeHTML(n.Description)
+	return report
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	tests := []struct {
+		name  string
+		in    string
+		want  string
+		tags  []string
+		attrs []string
+	}{
+		{"editor markup", `<b>bold</b><i>i</i><ul><li>x</li></ul><div><br></div>`, `<b>bold</b><i>i</i><ul><li>x</li></ul><div><br></div>`, nil, nil},
+		{"escaped text", `<p>1 &lt; 2 &amp; &lt;script&gt;</p>`, `<p>1 &lt; 2 &amp; &lt;script&gt;</p>`, nil, nil},
+		{"javascript url", `<a href="javascript:alert(1)">x</a>`, `x`, []string{"a"}, nil},
+		{"mixed case javascript url", `<p><a href="JaVaScRiPt:alert(1)">click</a></p>`, `<p>click</p>`, []string{"a"}, nil},
+		{"form action", `<form action="javascript:alert(1)"><button>go</button></form>`, `go`, []string{"button", "form"}, nil},
+		{"iframe", `<iframe src="javascript:alert(1)"></iframe>ok`, `ok`, []string{"iframe"}, nil},
+		{"event attribute on img", `<img src=x onerror=alert(1)>`, ``, []string{"img"}, nil},
+		{"event and style attributes", `<p onclick="alert(1)" style="color:red">hi</p>`, `<p>hi</p>`, nil, []string{"onclick", "style"}},
+		{"id attribute", `<h1 id=x>T</h1>`, `<h1>T</h1>`, nil, []string{"id"}},
+		{"body onload", `<body onload=alert(1)>x</body>`, `x`, []string{"body"}, nil},
+		{"script", `<p>a<script>alert(1)</script>b</p>`, `<p>ab</p>`, []string{"script"}, nil},
+		{"uppercase external script", `<SCRIPT SRC=//evil/x.js></SCRIPT>ok`, `ok`, []string{"script"}, nil},
+		{"svg onload", `<svg onload=alert(1)><script>alert(1)</script><text>t</text></svg>after`, `after`, []string{"script", "svg"}, nil},
+		{"svg foreign object", `<svg><style>@import 'x'</style><foreignObject><p>in</p></foreignObject></svg>`, ``, []string{"style", "svg"}, nil},
+		{"style", `<style>body{background:url(javascript:alert(1))}</style><p>x</p>`, `<p>x</p>`, []string{"style"}, nil},
+		{"math mutation", `<math><mtext><table><mglyph><style><img src=x onerror=alert(1)>`, ``, []string{"math", "style"}, nil},
+		{"noscript breakout", `<noscript><p title="</noscript><img src=x onerror=alert(1)>"></noscript>`, `"&gt;`, []string{"img", "noscript"}, nil},
+		{"comment", `<!-- <script>alert(1)</script> -->text`, `text`, nil, nil},
+	}
+	for _, tt := range tests {
+		got, report := sanitizeHTML(tt.in)
+		if got != tt.want {
+			t.Errorf("%s: sanitizeHTML(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+		if !reflect.DeepEqual(report.RemovedTags, tt.tags) || !reflect.DeepEqual(report.RemovedAttributes, tt.attrs) {
+			t.Errorf("%s: removed tags %v attributes %v, want %v %v",
+				tt.name, report.RemovedTags, report.RemovedAttributes, tt.tags, tt.attrs)
+		}
+
+		// Whatever the exact output, nothing executable may survive
+		lower := strings.ToLower(got)
+		for _, bad := range []string{"<script", "<svg", "<style", "<img", "<iframe", "<a ", "javascript:", "onerror=", "onload=", "onclick="} {
+			if strings.Contains(lower, bad) {
+				t.Errorf("%s: output %q contains %q", tt.name, got, bad)
+			}
+		}
+
+		// Sanitizing is idempotent
+		if again, report := sanitizeHTML(got); again != got || !report.empty() {
+			t.Errorf("%s: sanitizing %q again gave %q", tt.name, got, again)
+		}
+	}
+}
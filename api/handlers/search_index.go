@@ -0,0 +1,541 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Full-text search index
+//
+// Each item type has its own inverted index stored alongside the items:
+//
+//	fts/<kind>/t/<term>\x00<id>  term frequency of <term> in item <id>
+//	fts/<kind>/d/<id>            indexed terms and length of item <id>
+//	fts/<kind>/stats             document count and total length
+//	fts/<kind>/sd/<ULID>         change to the count and length by one write
+//
+// The index is updated in the same transaction as the item it describes, so
+// it never drifts from the stored items. Writes record their change to the
+// collection statistics under a key of their own rather than rewriting the
+// shared stats key, so writers of unrelated items never conflict; readers add
+// the changes to the stats, and compactStats folds them in now and then.
+// Queries match terms by prefix and are ranked with BM25.
+
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+
+	// prefixMatchWeight discounts terms that only start with the query word
+	prefixMatchWeight = 0.5
+
+	// maxTermLength bounds the size of posting keys
+	maxTermLength = 64
+)
+
+// Weights applied to term frequencies by where the term occurs
+const (
+	titleTermWeight = 3
+	tagTermWeight   = 2
+	bodyTermWeight  = 1
+)
+
+// indexable is implemented by items stored in a searchIndex
+type indexable interface {
+	indexID() string
+	// indexText returns the title, the free text body and the tags
+	indexText() (title, body string, tags []string)
+}
+
+// searchIndexDoc is the per-item entry used to remove stale postings
+type searchIndexDoc struct {
+	Length int            `json:"len"`
+	Terms  map[string]int `json:"terms"`
+}
+
+// searchIndexStats holds the collection statistics BM25 needs
+type searchIndexStats struct {
+	Docs     int `json:"docs"`
+	TotalLen int `json:"total_len"`
+}
+
+// searchIndex is the inverted index for one item type
+type searchIndex struct {
+	kind string
+}
+
+func (ix *searchIndex) prefix() []byte {
+	return []byte("fts/" + ix.kind + "/")
+}
+
+func (ix *searchIndex) termPrefix(term string) []byte {
+	return []byte("fts/" + ix.kind + "/t/" + term)
+}
+
+func (ix *searchIndex) postingKey(term, id string) []byte {
+	return []byte("fts/" + ix.kind + "/t/" + term + "\x00" + id)
+}
+
+func (ix *searchIndex) docKey(id string) []byte {
+	return []byte("fts/" + ix.kind + "/d/" + id)
+}
+
+func (ix *searchIndex) statsKey() []byte {
+	return []byte("fts/" + ix.kind + "/stats")
+}
+
+func (ix *searchIndex) statsDeltaPrefix() []byte {
+	return []byte("fts/" + ix.kind + "/sd/")
+}
+
+// tokenizeText splits text into lowercase letter/digit runs
+func tokenizeText(s string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	tokens := fields[:0]
+	for _, f := range fields {
+		if r := []rune(f); len(r) > maxTermLength {
+			f = string(r[:maxTermLength])
+		}
+		tokens = append(tokens, f)
+	}
+	return tokens
+}
+
+// urlSearchText drops the scheme and "www." so they don't pollute the index
+func urlSearchText(u string) string {
+	u = strings.ToLower(u)
+	if i := strings.Index(u, "://"); i >= 0 {
+		u = u[i+3:]
+	}
+	return strings.TrimPrefix(u, "www.")
+}
+
+// stripHTML returns the visible text of an HTML fragment
+func stripHTML(s string) string {
+	var sb strings.Builder
+	inTag := false
+	skipUntil := "" // closing tag whose content is not visible text
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if inTag {
+			if c == '>' {
+				inTag = false
+			}
+			continue
+		}
+		if c != '<' {
+			if skipUntil == "" {
+				sb.WriteByte(c)
+			}
+			continue
+		}
+		inTag = true
+		rest := strings.ToLower(s[i:])
+		if skipUntil != "" {
+			if strings.HasPrefix(rest, skipUntil) {
+				skipUntil = ""
+			}
+			continue
+		}
+		switch {
+		case strings.HasPrefix(rest, "<script"):
+			skipUntil = "</script"
+		case strings.HasPrefix(rest, "<style"):
+			skipUntil = "</style"
+		default:
+			// Tags separate words, e.g. "<p>a</p><p>b</p>"
+			sb.WriteByte(' ')
+		}
+	}
+	return html.UnescapeString(sb.String())
+}
+
+// analyze computes weighted term frequencies and the document length
+func (ix *searchIndex) analyze(item indexable) searchIndexDoc {
+	title, body, tags := item.indexText()
+	doc := searchIndexDoc{Terms: make(map[string]int)}
+	add := func(text string, weight int) {
+		for _, t := range tokenizeText(text) {
+			doc.Terms[t] += weight
+			doc.Length++
+		}
+	}
+	add(title, titleTermWeight)
+	add(body, bodyTermWeight)
+	for _, tag := range tags {
+		add(tag, tagTermWeight)
+	}
+	return doc
+}
+
+// getStats returns the collection statistics: the stats key plus every
+// change recorded since it was last compacted
+func (ix *searchIndex) getStats(txn *badger.Txn) (searchIndexStats, error) {
+	var stats searchIndexStats
+	item, err := txn.Get(ix.statsKey())
+	if err != nil && err != badger.ErrKeyNotFound {
+		return stats, err
+	}
+	if err == nil {
+		if err := item.Value(func(val []byte) error { return json.Unmarshal(val, &stats) }); err != nil {
+			return stats, err
+		}
+	}
+
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = ix.statsDeltaPrefix()
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		var delta searchIndexStats
+		if err := it.Item().Value(func(val []byte) error { return json.Unmarshal(val, &delta) }); err != nil {
+			return stats, err
+		}
+		stats.Docs += delta.Docs
+		stats.TotalLen += delta.TotalLen
+	}
+	if stats.Docs < 0 || stats.TotalLen < 0 {
+		stats = searchIndexStats{}
+	}
+	return stats, nil
+}
+
+// addStats records a change to the collection statistics under a new key
+func (ix *searchIndex) addStats(txn *badger.Txn, delta searchIndexStats) error {
+	if delta == (searchIndexStats{}) {
+		return nil
+	}
+	data, err := json.Marshal(delta)
+	if err != nil {
+		return err
+	}
+	key := append(ix.statsDeltaPrefix(), ulids.next(time.Now())...)
+	return txn.Set(key, data)
+}
+
+// maxStatsCompaction bounds the changes folded in one transaction
+const maxStatsCompaction = 10000
+
+// compactStats folds the recorded changes into the stats key. Writers only
+// add new change keys, which this transaction never reads, so it doesn't
+// conflict with them.
+func (ix *searchIndex) compactStats(db *badger.DB) error {
+	for {
+		folded := 0
+		err := updateWithRetry(db, func(txn *badger.Txn) error {
+			var stats searchIndexStats
+			item, err := txn.Get(ix.statsKey())
+			if err == badger.ErrKeyNotFound {
+				return nil // never built; ensure rebuilds it
+			}
+			if err != nil {
+				return err
+			}
+			if err := item.Value(func(val []byte) error { return json.Unmarshal(val, &stats) }); err != nil {
+				return err
+			}
+
+			var keys [][]byte
+			opts := badger.DefaultIteratorOptions
+			opts.Prefix = ix.statsDeltaPrefix()
+			it := txn.NewIterator(opts)
+			for it.Rewind(); it.Valid() && len(keys) < maxStatsCompaction; it.Next() {
+				var delta searchIndexStats
+				if err := it.Item().Value(func(val []byte) error { return json.Unmarshal(val, &delta) }); err != nil {
+					it.Close()
+					return err
+				}
+				stats.Docs += delta.Docs
+				stats.TotalLen += delta.TotalLen
+				keys = append(keys, it.Item().KeyCopy(nil))
+			}
+			it.Close()
+
+			folded = len(keys)
+			if folded == 0 {
+				return nil
+			}
+			for _, key := range keys {
+				if err := txn.Delete(key); err != nil {
+					return err
+				}
+			}
+			data, err := json.Marshal(stats)
+			if err != nil {
+				return err
+			}
+			return txn.Set(ix.statsKey(), data)
+		})
+		if err != nil || folded < maxStatsCompaction {
+			return err
+		}
+	}
+}
+
+// getDoc loads the index entry of an item, nil if it isn't indexed
+func (ix *searchIndex) getDoc(txn *badger.Txn, id string) (*searchIndexDoc, error) {
+	item, err := txn.Get(ix.docKey(id))
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var doc searchIndexDoc
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &doc)
+	}); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// indexDoc adds or replaces an item in the index within txn
+func (ix *searchIndex) indexDoc(txn *badger.Txn, item indexable) error {
+	id := item.indexID()
+	var delta searchIndexStats
+	old, err := ix.getDoc(txn, id)
+	if err != nil {
+		return err
+	}
+	doc := ix.analyze(item)
+
+	// Drop postings for terms the item no longer contains
+	if old != nil {
+		for term := range old.Terms {
+			if _, ok := doc.Terms[term]; !ok {
+				if err := txn.Delete(ix.postingKey(term, id)); err != nil {
+					return err
+				}
+			}
+		}
+		delta.Docs--
+		delta.TotalLen -= old.Length
+	}
+
+	for term, tf := range doc.Terms {
+		if old != nil && old.Terms[term] == tf {
+			continue
+		}
+		if err := txn.Set(ix.postingKey(term, id), []byte(strconv.Itoa(tf))); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if err := txn.Set(ix.docKey(id), data); err != nil {
+		return err
+	}
+
+	delta.Docs++
+	delta.TotalLen += doc.Length
+	return ix.addStats(txn, delta)
+}
+
+// removeDoc removes an item from the index within txn
+func (ix *searchIndex) removeDoc(txn *badger.Txn, id string) error {
+	old, err := ix.getDoc(txn, id)
+	if err != nil || old == nil {
+		return err
+	}
+	for term := range old.Terms {
+		if err := txn.Delete(ix.postingKey(term, id)); err != nil {
+			return err
+		}
+	}
+	if err := txn.Delete(ix.docKey(id)); err != nil {
+		return err
+	}
+	return ix.addStats(txn, searchIndexStats{Docs: -1, TotalLen: -old.Length})
+}
+
+// search returns the BM25 score of every item containing all of the words,
+// matching each word as a term prefix.
+func (ix *searchIndex) search(txn *badger.Txn, words []string) (map[string]float64, error) {
+	stats, err := ix.getStats(txn)
+	if err != nil {
+		return nil, err
+	}
+	if stats.Docs == 0 {
+		return map[string]float64{}, nil
+	}
+	avgLen := float64(stats.TotalLen) / float64(stats.Docs)
+
+	// For every word, the best matching term posting per item
+	var candidates map[string]bool
+	matches := make([]map[string]searchPosting, 0, len(words))
+
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchSize = 100
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	for _, word := range words {
+		prefix := ix.termPrefix(word)
+		termsStart := len(ix.termPrefix(""))
+
+		// Group postings by term so each carries its document frequency
+		type rawPosting struct {
+			id string
+			tf int
+		}
+		byTerm := make(map[string][]rawPosting)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			key := it.Item().Key()
+			sep := bytes.IndexByte(key[termsStart:], 0)
+			if sep < 0 {
+				continue
+			}
+			term := string(key[termsStart : termsStart+sep])
+			id := string(key[termsStart+sep+1:])
+			if candidates != nil && !candidates[id] {
+				continue
+			}
+			var tf int
+			if err := it.Item().Value(func(val []byte) error {
+				n, err := strconv.Atoi(string(val))
+				tf = n
+				return err
+			}); err != nil {
+				return nil, fmt.Errorf("corrupt posting %q: %w", key, err)
+			}
+			byTerm[term] = append(byTerm[term], rawPosting{id: id, tf: tf})
+		}
+
+		best := make(map[string]searchPosting)
+		for term, postings := range byTerm {
+			weight := 1.0
+			if term != word {
+				weight = prefixMatchWeight
+			}
+			for _, p := range postings {
+				cur := searchPosting{tf: p.tf, df: len(postings), weight: weight}
+				if prev, ok := best[p.id]; !ok || cur.rank(stats.Docs) > prev.rank(stats.Docs) {
+					best[p.id] = cur
+				}
+			}
+		}
+
+		next := make(map[string]bool, len(best))
+		for id := range best {
+			next[id] = true
+		}
+		candidates = next
+		matches = append(matches, best)
+		if len(candidates) == 0 {
+			return map[string]float64{}, nil
+		}
+	}
+
+	scores := make(map[string]float64, len(candidates))
+	for id := range candidates {
+		doc, err := ix.getDoc(txn, id)
+		if err != nil {
+			return nil, err
+		}
+		docLen := avgLen
+		if doc != nil {
+			docLen = float64(doc.Length)
+		}
+		norm := bm25K1 * (1 - bm25B + bm25B*docLen/avgLen)
+		var score float64
+		for _, m := range matches {
+			p := m[id]
+			tf := float64(p.tf)
+			score += p.weight * bm25IDF(p.df, stats.Docs) * tf * (bm25K1 + 1) / (tf + norm)
+		}
+		scores[id] = math.Round(score*1000) / 1000
+	}
+	return scores, nil
+}
+
+func bm25IDF(df, docs int) float64 {
+	return math.Log(1 + (float64(docs)-float64(df)+0.5)/(float64(df)+0.5))
+}
+
+// searchPosting is one term match of a query word within an item
+type searchPosting struct {
+	tf     int
+	df     int
+	weight float64
+}
+
+// rank orders alternative prefix matches of one word within an item
+func (p searchPosting) rank(docs int) float64 {
+	return p.weight * bm25IDF(p.df, docs) * float64(p.tf)
+}
+
+// rebuild drops the index and re-indexes every item produced by each
+func (ix *searchIndex) rebuild(db *badger.DB, each func(txn *badger.Txn, fn func(indexable) error) error) error {
+	if err := db.DropPrefix(ix.prefix()); err != nil {
+		return err
+	}
+
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+
+	stats := searchIndexStats{}
+	err := db.View(func(txn *badger.Txn) error {
+		return each(txn, func(item indexable) error {
+			id := item.indexID()
+			doc := ix.analyze(item)
+			for term, tf := range doc.Terms {
+				if err := wb.Set(ix.postingKey(term, id), []byte(strconv.Itoa(tf))); err != nil {
+					return err
+				}
+			}
+			data, err := json.Marshal(doc)
+			if err != nil {
+				return err
+			}
+			stats.Docs++
+			stats.TotalLen += doc.Length
+			return wb.Set(ix.docKey(id), data)
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	if err := wb.Set(ix.statsKey(), data); err != nil {
+		return err
+	}
+	return wb.Flush()
+}
+
+// ensure rebuilds the index when it has never been built for this database
+// and otherwise folds in the statistics changes recorded since the last run
+func (ix *searchIndex) ensure(db *badger.DB, each func(txn *badger.Txn, fn func(indexable) error) error) error {
+	missing := false
+	err := db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(ix.statsKey())
+		if err == badger.ErrKeyNotFound {
+			missing = true
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if !missing {
+		return ix.compactStats(db)
+	}
+	return ix.rebuild(db, each)
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func readStats(t *testing.T, db *badger.DB, ix *searchIndex) searchIndexStats {
+	t.Helper()
+	var stats searchIndexStats
+	if err := db.View(func(txn *badger.Txn) error {
+		var err error
+		stats, err = ix.getStats(txn)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return stats
+}
+
+func TestSearchIndexWritersDontConflict(t *testing.T) {
+	db := openTestDB(t)
+	ix := &searchIndex{kind: "note"}
+	if err := ix.rebuild(db, func(*badger.Txn, func(indexable) error) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two transactions index different items concurrently
+	a, b := db.NewTransaction(true), db.NewTransaction(true)
+	defer a.Discard()
+	defer b.Discard()
+	if err := ix.indexDoc(a, &Note{ID: "note_a", Title: "alpha", Description: "one two"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.indexDoc(b, &Note{ID: "note_b", Title: "beta", Description: "three"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatalf("second writer: %v", err)
+	}
+
+	if got, want := readStats(t, db, ix), (searchIndexStats{Docs: 2, TotalLen: 5}); got != want {
+		t.Fatalf("stats = %+v, want %+v", got, want)
+	}
+
+	// Re-indexing and removing adjust the statistics
+	steps := []struct {
+		name string
+		fn   func(txn *badger.Txn) error
+		want searchIndexStats
+	}{
+		{"reindex", func(txn *badger.Txn) error {
+			return ix.indexDoc(txn, &Note{ID: "note_a", Title: "alpha", Description: "one"})
+		}, searchIndexStats{Docs: 2, TotalLen: 4}},
+		{"remove", func(txn *badger.Txn) error { return ix.removeDoc(txn, "note_b") }, searchIndexStats{Docs: 1, TotalLen: 2}},
+		{"remove missing", func(txn *badger.Txn) error { return ix.removeDoc(txn, "note_b") }, searchIndexStats{Docs: 1, TotalLen: 2}},
+	}
+	for _, step := range steps {
+		if err := db.Update(step.fn); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if got := readStats(t, db, ix); got != step.want {
+			t.Errorf("%s: stats = %+v, want %+v", step.name, got, step.want)
+		}
+	}
+
+	// Compaction folds the changes into the stats key without changing them
+	if err := ix.compactStats(db); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readStats(t, db, ix), (searchIndexStats{Docs: 1, TotalLen: 2}); got != want {
+		t.Errorf("after compaction: stats = %+v, want %+v", got, want)
+	}
+	var deltas int
+	db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = ix.statsDeltaPrefix()
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			deltas++
+		}
+		return nil
+	})
+	if deltas != 0 {
+		t.Errorf("%d statistics changes left after compaction", deltas)
+	}
+
+	// Searches keep working on the compacted statistics
+	if err := db.View(func(txn *badger.Txn) error {
+		scores, err := ix.search(txn, []string{"alp"})
+		if err != nil {
+			return err
+		}
+		if len(scores) != 1 || scores["note_a"] <= 0 {
+			t.Errorf("search alp = %v", scores)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
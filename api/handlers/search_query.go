@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Keyword search queries
+//
+// A query is a whitespace-separated list of terms that must all match:
+//
+//	golang                 word starting a term anywhere in the item, ranked by relevance
+//	"exact phrase"         phrase anywhere in the item
+//	title:golang           word in a single field (title, url, description, video)
+//	title:"go generics"    quoted field value
+//	tag:reference          item has this tag (exact, alias-aware)
+//	created:>2025-01-01    date comparison on created/updated (>, >=, <, <=, =)
+//	updated:2025-03        whole month (also a year, day or RFC 3339 time)
+//	created:2025-01..2025-02-15  inclusive date range
+//	-draft, -tag:old       any term prefixed with '-' excludes matches
+//
+// A prefix that is not a known field (e.g. "https://") is treated as part of
+// a plain word.
+
+// searchable is implemented by items that can be matched by a searchQuery
+type searchable interface {
+	// searchText is the text matched by plain words and phrases
+	searchText() string
+	// searchField returns the value of a text field, false if unsupported
+	searchField(name string) (string, bool)
+	searchTags() []string
+	searchTimes() (created, updated time.Time)
+}
+
+// searchQueryError describes an invalid query and where it went wrong.
+type searchQueryError struct {
+	Pos int // 1-based character position in the query
+	Msg string
+}
+
+func (e *searchQueryError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+}
+
+type queryTermKind int
+
+const (
+	queryTermText  queryTermKind = iota // plain word or phrase over searchText
+	queryTermField                      // substring within one text field
+	queryTermTag                        // exact tag match
+	queryTermDate                       // created/updated comparison
+)
+
+type queryTerm struct {
+	kind   queryTermKind
+	negate bool
+	phrase bool
+	field  string
+	value  string // lowercased
+	op     string // date comparison operator
+	start  time.Time
+	end    time.Time // exclusive end of the date value's interval
+}
+
+// searchQuery is a compiled keyword query, parsed once per request
+type searchQuery struct {
+	terms []queryTerm
+}
+
+// dateLayouts are tried in order; each has the span a bare value covers
+var dateLayouts = []struct {
+	layout string
+	span   func(time.Time) time.Time
+}{
+	{time.RFC3339, func(t time.Time) time.Time { return t.Add(time.Second) }},
+	{"2006-01-02T15:04", func(t time.Time) time.Time { return t.Add(time.Minute) }},
+	{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+	{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+	{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+}
+
+// parseQueryDate parses a date value into the half-open interval it covers
+func parseQueryDate(s string) (time.Time, time.Time, bool) {
+	for _, l := range dateLayouts {
+		if t, err := time.ParseInLocation(l.layout, s, time.Local); err == nil {
+			return t, l.span(t), true
+		}
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// parseSearchQuery compiles a keyword query. fields lists the text fields
+// the item type supports in addition to tag, created and updated.
+func parseSearchQuery(src string, fields []string) (*searchQuery, error) {
+	runes := []rune(src)
+	q := &searchQuery{}
+
+	textFields := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		textFields[f] = true
+	}
+
+	// readQuoted reads a quoted string starting at the opening quote
+	readQuoted := func(i int) (string, int, error) {
+		var sb strings.Builder
+		for j := i + 1; j < len(runes); j++ {
+			if runes[j] == '\\' && j+1 < len(runes) {
+				sb.WriteRune(runes[j+1])
+				j++
+				continue
+			}
+			if runes[j] == '"' {
+				return sb.String(), j + 1, nil
+			}
+			sb.WriteRune(runes[j])
+		}
+		return "", 0, &searchQueryError{Pos: i + 1, Msg: "unterminated quoted phrase"}
+	}
+
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+		pos := i + 1
+
+		term := queryTerm{kind: queryTermText}
+		if runes[i] == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) {
+			term.negate = true
+			i++
+		}
+
+		if runes[i] == '"' {
+			phrase, next, err := readQuoted(i)
+			if err != nil {
+				return nil, err
+			}
+			i = next
+			if phrase = strings.ToLower(strings.TrimSpace(phrase)); phrase != "" {
+				term.value = phrase
+				term.phrase = true
+				q.terms = append(q.terms, term)
+			}
+			continue
+		}
+
+		start := i
+		for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != ':' && runes[i] != '"' {
+			i++
+		}
+		name := strings.ToLower(string(runes[start:i]))
+		isField := i < len(runes) && runes[i] == ':' &&
+			(textFields[name] || name == "tag" || name == "created" || name == "updated")
+
+		if !isField {
+			// Plain word, which may itself contain ':' or '"'
+			for i < len(runes) && !unicode.IsSpace(runes[i]) {
+				i++
+			}
+			term.value = strings.ToLower(string(runes[start:i]))
+			q.terms = append(q.terms, term)
+			continue
+		}
+
+		// Field value, either quoted or up to the next whitespace
+		i++
+		valuePos := i + 1
+		var value string
+		if i < len(runes) && runes[i] == '"' {
+			v, next, err := readQuoted(i)
+			if err != nil {
+				return nil, err
+			}
+			value, i = v, next
+		} else {
+			vs := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) {
+				i++
+			}
+			value = string(runes[vs:i])
+		}
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return nil, &searchQueryError{Pos: pos, Msg: fmt.Sprintf("missing value for %s:", name)}
+		}
+
+		term.field = name
+		switch name {
+		case "tag":
+			term.kind = queryTermTag
+			term.value = strings.ToLower(strings.TrimPrefix(value, "#"))
+		case "created", "updated":
+			term.kind = queryTermDate
+			if err := parseDateTerm(&term, value, valuePos); err != nil {
+				return nil, err
+			}
+		default:
+			term.kind = queryTermField
+			term.value = strings.ToLower(value)
+		}
+		q.terms = append(q.terms, term)
+	}
+
+	if len(q.terms) == 0 {
+		return nil, nil
+	}
+	return q, nil
+}
+
+// parseDateTerm fills in the operator and interval of a created/updated term
+func parseDateTerm(term *queryTerm, value string, pos int) error {
+	if from, to, ok := strings.Cut(value, ".."); ok {
+		start, _, okFrom := parseQueryDate(from)
+		_, end, okTo := parseQueryDate(to)
+		if !okFrom || !okTo {
+			return &searchQueryError{Pos: pos, Msg: fmt.Sprintf("invalid date range %q (expected YYYY-MM-DD..YYYY-MM-DD)", value)}
+		}
+		term.op, term.start, term.end = "..", start, end
+		return nil
+	}
+
+	op := "="
+	for _, candidate := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(value, candidate) {
+			op = candidate
+			value = value[len(candidate):]
+			break
+		}
+	}
+	start, end, ok := parseQueryDate(value)
+	if !ok {
+		return &searchQueryError{Pos: pos, Msg: fmt.Sprintf("invalid date %q (expected YYYY-MM-DD)", value)}
+	}
+	term.op, term.start, term.end = op, start, end
+	return nil
+}
+
+// withAliases returns a copy of the query with tag terms mapped to their
+// canonical tag.
+func (q *searchQuery) withAliases(aliases map[string]string) *searchQuery {
+	if q == nil || len(aliases) == 0 {
+		return q
+	}
+	lower := make(map[string]string, len(aliases))
+	for alias, canon := range aliases {
+		if canon != "" {
+			lower[strings.ToLower(alias)] = strings.ToLower(canon)
+		}
+	}
+	out := &searchQuery{terms: make([]queryTerm, len(q.terms))}
+	copy(out.terms, q.terms)
+	for i, t := range out.terms {
+		if t.kind != queryTermTag {
+			continue
+		}
+		if canon, ok := lower[t.value]; ok {
+			out.terms[i].value = canon
+		}
+	}
+	return out
+}
+
+// splitIndexTerms separates the plain words that can be answered by the
+// full-text index from the terms that must still be checked per item.
+func (q *searchQuery) splitIndexTerms() ([]string, *searchQuery) {
+	if q == nil {
+		return nil, nil
+	}
+	var words []string
+	rest := &searchQuery{}
+	for _, t := range q.terms {
+		if t.kind == queryTermText && !t.negate && !t.phrase {
+			if tokens := tokenizeText(t.value); len(tokens) > 0 {
+				words = append(words, tokens...)
+				continue
+			}
+		}
+		rest.terms = append(rest.terms, t)
+	}
+	if len(rest.terms) == 0 {
+		rest = nil
+	}
+	return words, rest
+}
+
+// Matches reports whether an item satisfies every term of the query
+func (q *searchQuery) Matches(item searchable) bool {
+	if q == nil {
+		return true // No query matches all
+	}
+	var text string
+	for _, t := range q.terms {
+		var ok bool
+		switch t.kind {
+		case queryTermText:
+			if text == "" {
+				text = strings.ToLower(item.searchText())
+			}
+			ok = strings.Contains(text, t.value)
+		case queryTermField:
+			v, supported := item.searchField(t.field)
+			ok = supported && strings.Contains(strings.ToLower(v), t.value)
+		case queryTermTag:
+			for _, tag := range item.searchTags() {
+				if strings.ToLower(tag) == t.value {
+					ok = true
+					break
+				}
+			}
+		case queryTermDate:
+			created, updated := item.searchTimes()
+			ts := created
+			if t.field == "updated" {
+				ts = updated
+			}
+			ok = t.matchesTime(ts)
+		}
+		if ok == t.negate {
+			return false
+		}
+	}
+	return true
+}
+
+func (t queryTerm) matchesTime(ts time.Time) bool {
+	switch t.op {
+	case ">":
+		return !ts.Before(t.end)
+	case ">=":
+		return !ts.Before(t.start)
+	case "<":
+		return ts.Before(t.start)
+	case "<=":
+		return ts.Before(t.end)
+	default: // "=" and ".." both cover [start, end)
+		return !ts.Before(t.start) && ts.Before(t.end)
+	}
+}
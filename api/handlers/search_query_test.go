@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testQueryFields = []string{"title", "url", "description"}
+
+func TestParseSearchQuery(t *testing.T) {
+	text := func(v string) queryTerm { return queryTerm{kind: queryTermText, value: v} }
+	tests := []struct {
+		src  string
+		want []queryTerm
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"Golang", []queryTerm{text("golang")}},
+		{`"Exact  Phrase" go`, []queryTerm{{kind: queryTermText, phrase: true, value: "exact  phrase"}, text("go")}},
+		{`""`, nil},
+		{"title:Golang", []queryTerm{{kind: queryTermField, field: "title", value: "golang"}}},
+		{"TITLE:go", []queryTerm{{kind: queryTermField, field: "title", value: "go"}}},
+		{`title:"go generics"`, []queryTerm{{kind: queryTermField, field: "title", value: "go generics"}}},
+		{`description:"say \"hi\""`, []queryTerm{{kind: queryTermField, field: "description", value: `say "hi"`}}},
+		{"tag:#Reference", []queryTerm{{kind: queryTermTag, field: "tag", value: "reference"}}},
+		{"-draft -tag:old", []queryTerm{
+			{kind: queryTermText, negate: true, value: "draft"},
+			{kind: queryTermTag, negate: true, field: "tag", value: "old"},
+		}},
+		{`-"exact phrase"`, []queryTerm{{kind: queryTermText, negate: true, phrase: true, value: "exact phrase"}}},
+		{"- go", []queryTerm{text("-"), text("go")}},
+		// Unknown fields are plain words
+		{"https://go.dev video:abc", []queryTerm{text("https://go.dev"), text("video:abc")}},
+		{`say"hi"`, []queryTerm{text(`say"hi"`)}},
+	}
+	for _, tt := range tests {
+		q, err := parseSearchQuery(tt.src, testQueryFields)
+		if err != nil {
+			t.Errorf("%q: %v", tt.src, err)
+			continue
+		}
+		var got []queryTerm
+		if q != nil {
+			got = q.terms
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q parsed as %+v, want %+v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestParseSearchQueryDates(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.Local) }
+	tests := []struct {
+		src        string
+		field, op  string
+		start, end time.Time
+	}{
+		{"created:2025-03-04", "created", "=", day(2025, 3, 4), day(2025, 3, 5)},
+		{"updated:2025-03", "updated", "=", day(2025, 3, 1), day(2025, 4, 1)},
+		{"created:2025", "created", "=", day(2025, 1, 1), day(2026, 1, 1)},
+		{"created:>2025-01-01", "created", ">", day(2025, 1, 1), day(2025, 1, 2)},
+		{"created:>=2025-01-01", "created", ">=", day(2025, 1, 1), day(2025, 1, 2)},
+		{"updated:<=2025-12", "updated", "<=", day(2025, 12, 1), day(2026, 1, 1)},
+		{"created:2025-01..2025-02-15", "created", "..", day(2025, 1, 1), day(2025, 2, 16)},
+		{"created:2025-01-02T15:04", "created", "=",
+			time.Date(2025, 1, 2, 15, 4, 0, 0, time.Local), time.Date(2025, 1, 2, 15, 5, 0, 0, time.Local)},
+	}
+	for _, tt := range tests {
+		q, err := parseSearchQuery(tt.src, testQueryFields)
+		if err != nil {
+			t.Errorf("%q: %v", tt.src, err)
+			continue
+		}
+		term := q.terms[0]
+		if term.kind != queryTermDate || term.field != tt.field || term.op != tt.op ||
+			!term.start.Equal(tt.start) || !term.end.Equal(tt.end) {
+			t.Errorf("%q parsed as %s %s [%v, %v), want %s %s [%v, %v)",
+				tt.src, term.field, term.op, term.start, term.end, tt.field, tt.op, tt.start, tt.end)
+		}
+	}
+}
+
+func TestParseSearchQueryErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		pos int
+		msg string
+	}{
+		{`go "open`, 4, "unterminated quoted phrase"},
+		{`title:"open`, 7, "unterminated quoted phrase"},
+		{"go title:", 4, "missing value for title:"},
+		{`tag:""`, 1, "missing value for tag:"},
+		{"created:yesterday", 9, `invalid date "yesterday"`},
+		{"go -updated:>13-2025", 13, `invalid date "13-2025"`},
+		{"created:2025..later", 9, `invalid date range "2025..later"`},
+	}
+	for _, tt := range tests {
+		_, err := parseSearchQuery(tt.src, testQueryFields)
+		var qerr *searchQueryError
+		if !errors.As(err, &qerr) {
+			t.Errorf("%q: error %v, want a *searchQueryError", tt.src, err)
+			continue
+		}
+		if qerr.Pos != tt.pos || !strings.HasPrefix(qerr.Msg, tt.msg) {
+			t.Errorf("%q: %q at %d, want %q at %d", tt.src, qerr.Msg, qerr.Pos, tt.msg, tt.pos)
+		}
+	}
+}
+
+func TestSearchQueryMatches(t *testing.T) {
+	created := time.Date(2025, 3, 4, 12, 0, 0, 0, time.Local)
+	b := &Bookmark{
+		Title:     "Go generics explained",
+		URL:       "https://go.dev/blog/intro-generics",
+		Tags:      []string{"Reference", "go"},
+		CreatedAt: created,
+		UpdatedAt: created.AddDate(0, 1, 0),
+	}
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{"generics", true},
+		{`"go generics"`, true},
+		{`"generics go"`, false},
+		{"title:explained url:go.dev", true},
+		{"title:blog", false},
+		{"tag:reference", true},
+		{"tag:refer", false},
+		{"-tag:go", false},
+		{"created:2025-03", true},
+		{"created:>2025-03-04", false},
+		{"created:>=2025-03-04 updated:2025-04", true},
+		{"updated:<2025-04", false},
+		{"created:2025-01..2025-03-04", true},
+		{"description:generics", false},
+	}
+	for _, tt := range tests {
+		q, err := parseSearchQuery(tt.src, []string{"title", "url"})
+		if err != nil {
+			t.Errorf("%q: %v", tt.src, err)
+			continue
+		}
+		if got := q.Matches(b); got != tt.want {
+			t.Errorf("%q matches = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Storage layout
+//
+// Every entity type lives in its own key namespace so iterators can use
+// Badger's Prefix option instead of scanning the whole database:
+//
+//	b/<id>                    bookmarks
+//	n/<id>                    notes
+//	y/<id>                    YouTube videos
+//	trash/<type>/<id>         deleted items awaiting purge, see trash.go
+//	rev/<type>/<id>/<version> earlier versions of notes, see revisions.go
+//	links/<type>/<id>         wiki links of an item, see links.go
+//	backlinks/<target>/...    wiki link postings by target
+//	blob/<sha256>             attachment blobs, stored on disk; see blobs.go
+//	attach/<type>/<id>        blobs attached to an item
+//	blobref/<sha256>/...      blob references by blob
+//	tagcount/<type>/<tag>     number of items carrying a tag
+//	tagidx/<type>/<tag>/<id>  tag postings, see tag_index.go
+//	meta/tag_aliases/<type>   tag aliases per type
+//	meta/schema_version       storage layout version
+//	auth/...                  password, sessions and API tokens, see auth.go
+//	fts/<type>/...            full-text search index
+//
+// Item IDs (e.g. "bookmark_01J9Z3N4W6Q8R2T5V7X9Y1B3C5", see ids.go) are
+// unchanged by the namespace; only the key they are stored under is prefixed.
+
+const (
+	bookmarkKeyPrefix = "b/"
+	noteKeyPrefix     = "n/"
+	youtubeKeyPrefix  = "y/"
+	metaKeyPrefix     = "meta/"
+	tagCountKeyPrefix = "tagcount/"
+	trashKeyPrefix    = "trash/"
+	revisionKeyPrefix = "rev/"
+)
+
+// storageSchemaVersion is the current storage layout version
+const storageSchemaVersion = 6
+
+var schemaVersionKey = []byte(metaKeyPrefix + "schema_version")
+
+func bookmarkKey(id string) []byte { return []byte(bookmarkKeyPrefix + id) }
+func noteKey(id string) []byte     { return []byte(noteKeyPrefix + id) }
+func youtubeKey(id string) []byte  { return []byte(youtubeKeyPrefix + id) }
+
+// tagCountPrefix returns the namespace of the per-tag counters of an item type
+func tagCountPrefix(kind string) []byte {
+	return []byte(tagCountKeyPrefix + kind + "/")
+}
+
+// tagCountKey returns the key holding the number of items carrying a tag
+func tagCountKey(kind, tag string) []byte {
+	return append(tagCountPrefix(kind), tag...)
+}
+
+// trashPrefix returns the namespace of the trashed items of a type
+func trashPrefix(kind string) []byte {
+	return []byte(trashKeyPrefix + kind + "/")
+}
+
+// tagAliasesKey returns the key holding the tag aliases of an item type
+func tagAliasesKey(kind string) []byte {
+	return []byte(metaKeyPrefix + "tag_aliases/" + kind)
+}
+
+// maxTxnAttempts bounds how often a conflicting transaction is retried
+const maxTxnAttempts = 10
+
+// updateWithRetry runs fn in a read-write transaction, retrying when Badger
+// reports a conflict with a concurrent transaction. fn must not keep state
+// between attempts other than through the values it assigns.
+func updateWithRetry(db *badger.DB, fn func(txn *badger.Txn) error) error {
+	var err error
+	for attempt := 0; attempt < maxTxnAttempts; attempt++ {
+		if err = db.Update(fn); err != badger.ErrConflict {
+			return err
+		}
+		// Back off a little so the competing transaction can finish
+		time.Sleep(time.Duration(attempt+1) * time.Millisecond)
+	}
+	return err
+}
+
+// legacyKeyTarget maps a key from the original flat layout to its namespaced
+// key. An empty target means the key is obsolete and is dropped.
+func legacyKeyTarget(key string) (string, bool) {
+	switch key {
+	case "bookmark_tag_aliases":
+		return string(tagAliasesKey("bookmark")), true
+	case "note_tag_aliases":
+		return string(tagAliasesKey("note")), true
+	case "youtube_tag_aliases":
+		return string(tagAliasesKey("youtube")), true
+	case "tag_counts", "note_tag_counts", "youtube_tag_counts", "bookmark_tag_counts":
+		// Tag count blobs are rebuilt as per-tag counters, see migrateTagCounts
+		return "", true
+	}
+	switch {
+	case strings.HasPrefix(key, "bookmark_"):
+		return bookmarkKeyPrefix + key, true
+	case strings.HasPrefix(key, "note_"):
+		return noteKeyPrefix + key, true
+	case strings.HasPrefix(key, "youtube_"):
+		return youtubeKeyPrefix + key, true
+	}
+	return "", false
+}
+
+// migrationBatchSize bounds the number of keys moved per transaction
+const migrationBatchSize = 500
+
+// storageMigrations upgrade the database one layout version at a time; entry
+// i brings a database from version i+1 to version i+2.
+var storageMigrations = []func(db *badger.DB) error{
+	migrateFlatKeys,
+	migrateTagCounts,
+	migrateTagIndex,
+	migrateSanitizeNotes,
+	migrateLinks,
+}
+
+// MigrateStorage upgrades a database to the current storage layout. Each step
+// runs once; later calls only read the schema version.
+func MigrateStorage(db *badger.DB) error {
+	version := 1
+	err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(schemaVersionKey)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			version, err = strconv.Atoi(string(val))
+			return err
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+
+	for ; version < storageSchemaVersion; version++ {
+		if err := storageMigrations[version-1](db); err != nil {
+			return err
+		}
+		err = db.Update(func(txn *badger.Txn) error {
+			return txn.Set(schemaVersionKey, []byte(strconv.Itoa(version+1)))
+		})
+		if err != nil {
+			return fmt.Errorf("writing schema version: %w", err)
+		}
+	}
+	return nil
+}
+
+// migrateFlatKeys moves a database from the original flat key layout to the
+// namespaced layout (v1 -> v2)
+func migrateFlatKeys(db *badger.DB) error {
+	// Collect legacy keys first; moving them while iterating would revisit them
+	var legacy []string
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			key := string(it.Item().Key())
+			if _, ok := legacyKeyTarget(key); ok {
+				legacy = append(legacy, key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("scanning legacy keys: %w", err)
+	}
+
+	// Each batch copies and deletes its keys atomically, so an interrupted
+	// migration resumes with the keys that are still in the old layout.
+	for start := 0; start < len(legacy); start += migrationBatchSize {
+		batch := legacy[start:min(start+migrationBatchSize, len(legacy))]
+		err := db.Update(func(txn *badger.Txn) error {
+			for _, key := range batch {
+				target, _ := legacyKeyTarget(key)
+				if target != "" {
+					item, err := txn.Get([]byte(key))
+					if err != nil {
+						return err
+					}
+					val, err := item.ValueCopy(nil)
+					if err != nil {
+						return err
+					}
+					if err := txn.Set([]byte(target), val); err != nil {
+						return err
+					}
+				}
+				if err := txn.Delete([]byte(key)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("migrating keys: %w", err)
+		}
+	}
+
+	if len(legacy) > 0 {
+		Infof("📦 Migrated %d keys to storage layout v2", len(legacy))
+	}
+	return nil
+}
+
+// migrateTagCounts replaces the per-type tag count JSON blobs with one
+// counter key per tag (v2 -> v3). Counts are recomputed from the items, which
+// also repairs any drift in the old blobs.
+func migrateTagCounts(db *badger.DB) error {
+	rebuilds := map[string]func() error{
+		"bookmark": newBookmarkStore(db).rebuildTagCounts,
+		"note":     newNoteStore(db).rebuildTagCounts,
+		"youtube":  newYoutubeStore(db).rebuildTagCounts,
+	}
+	for kind, rebuild := range rebuilds {
+		if err := rebuild(); err != nil {
+			return fmt.Errorf("rebuilding %s tag counts: %w", kind, err)
+		}
+		err := db.Update(func(txn *badger.Txn) error {
+			return txn.Delete([]byte(metaKeyPrefix + "tag_counts/" + kind))
+		})
+		if err != nil {
+			return fmt.Errorf("removing %s tag count blob: %w", kind, err)
+		}
+	}
+	return nil
+}
+
+// migrateTagIndex builds the tag postings of existing items (v3 -> v4)
+func migrateTagIndex(db *badger.DB) error {
+	rebuilds := map[string]func() error{
+		"bookmark": newBookmarkStore(db).rebuildTagIndex,
+		"note":     newNoteStore(db).rebuildTagIndex,
+		"youtube":  newYoutubeStore(db).rebuildTagIndex,
+	}
+	for kind, rebuild := range rebuilds {
+		if err := rebuild(); err != nil {
+			return fmt.Errorf("building %s tag index: %w", kind, err)
+		}
+	}
+	return nil
+}
+
+// migrateSanitizeNotes runs the descriptions of existing notes, trashed
+// notes and note revisions through the HTML sanitizer (v4 -> v5). Live notes
+// that change get a new version so cached copies are revalidated.
+func migrateSanitizeNotes(db *badger.DB) error {
+	notes := newNoteStore(db)
+	prefixes := [][]byte{[]byte(noteKeyPrefix), trashPrefix("note"), []byte(revisionKeyPrefix + "note/")}
+
+	cleaned := 0
+	for _, prefix := range prefixes {
+		// Find the entries the sanitizer would change
+		var dirty [][]byte
+		err := db.View(func(txn *badger.Txn) error {
+			opts := badger.DefaultIteratorOptions
+			opts.Prefix = prefix
+			it := txn.NewIterator(opts)
+			defer it.Close()
+
+			for it.Rewind(); it.Valid(); it.Next() {
+				var n Note
+				if err := it.Item().Value(func(val []byte) error { return json.Unmarshal(val, &n) }); err != nil {
+					Warnf("skipping unreadable note entry %s: %v", it.Item().Key(), err)
+					continue
+				}
+				if clean, _ := sanitizeHTML(n.Description); clean != n.Description {
+					dirty = append(dirty, it.Item().KeyCopy(nil))
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("scanning notes: %w", err)
+		}
+
+		for start := 0; start < len(dirty); start += migrationBatchSize {
+			batch := dirty[start:min(start+migrationBatchSize, len(dirty))]
+			err := db.Update(func(txn *badger.Txn) error {
+				for _, key := range batch {
+					item, err := txn.Get(key)
+					if err != nil {
+						return err
+					}
+					var n Note
+					if err := item.Value(func(val []byte) error { return json.Unmarshal(val, &n) }); err != nil {
+						return err
+					}
+					sanitizeNote(&n)
+
+					// Live notes are reindexed; trash and revisions are stored as is
+					if string(prefix) == noteKeyPrefix {
+						n.Version++
+						if err := notes.write(txn, &n); err != nil {
+							return err
+						}
+						continue
+					}
+					data, err := json.Marshal(n)
+					if err != nil {
+						return err
+					}
+					if err := txn.Set(key, data); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("sanitizing notes: %w", err)
+			}
+		}
+		cleaned += len(dirty)
+	}
+
+	if cleaned > 0 {
+		Infof("🧹 Sanitized the HTML of %d stored notes and revisions", cleaned)
+	}
+	return nil
+}
+
+// migrateLinks builds the wiki link index of existing notes (v5 -> v6)
+func migrateLinks(db *badger.DB) error {
+	if err := newNoteStore(db).rebuildLinks(); err != nil {
+		return fmt.Errorf("building link index: %w", err)
+	}
+	return nil
+}
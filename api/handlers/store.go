@@ -0,0 +1,656 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// storeItem is implemented by pointers to the content types kept in a store.
+// The embedded interfaces give the store everything it needs for searching,
+// indexing and paging; the setters let it adjust items it loads.
+type storeItem interface {
+	searchable
+	indexable
+	pageable
+	setTags(tags []string)
+	setScore(score float64)
+	setUpdatedAt(t time.Time)
+	version() int64
+	setVersion(v int64)
+	setID(id string)
+	setDeletedAt(t *time.Time)
+}
+
+// itemPtr constrains P to be a pointer to T that implements storeItem
+type itemPtr[T any] interface {
+	*T
+	storeItem
+}
+
+// storeConfig describes one content type
+type storeConfig struct {
+	Kind   string   // type name used for aliases, counts and the search index
+	Prefix string   // key namespace, see storage.go
+	Fields []string // text fields usable as field:value in search queries
+
+	// RevisionLimit is how many earlier versions of each item are kept, see
+	// revisions.go; 0 keeps none
+	RevisionLimit int
+}
+
+// store is the typed repository shared by the bookmark, note and YouTube
+// handlers: CRUD, tag counts, alias normalization, filtering and search.
+type store[T any, P itemPtr[T]] struct {
+	db     *badger.DB
+	kind   string
+	prefix string
+	fields []string
+	index  *searchIndex
+	tagIdx *tagIndex
+
+	history *revisionLog // nil unless the type keeps revisions
+}
+
+func newStore[T any, P itemPtr[T]](db *badger.DB, cfg storeConfig) *store[T, P] {
+	s := &store[T, P]{
+		db:     db,
+		kind:   cfg.Kind,
+		prefix: cfg.Prefix,
+		fields: cfg.Fields,
+		index:  &searchIndex{kind: cfg.Kind},
+		tagIdx: &tagIndex{kind: cfg.Kind},
+	}
+	if cfg.RevisionLimit > 0 {
+		s.history = &revisionLog{kind: cfg.Kind, limit: cfg.RevisionLimit}
+	}
+	return s
+}
+
+func (s *store[T, P]) key(id string) []byte {
+	return []byte(s.prefix + id)
+}
+
+// initialize builds the search index for databases that predate it
+func (s *store[T, P]) initialize() {
+	if err := s.index.ensure(s.db, s.eachIndexable); err != nil {
+		Warnf("failed to build %s search index: %v", s.kind, err)
+	}
+}
+
+// get loads one item, returning badger.ErrKeyNotFound if it doesn't exist
+func (s *store[T, P]) get(txn *badger.Txn, id string) (T, error) {
+	var item T
+	it, err := txn.Get(s.key(id))
+	if err != nil {
+		return item, err
+	}
+	err = it.Value(func(val []byte) error {
+		return json.Unmarshal(val, &item)
+	})
+	return item, err
+}
+
+// find loads one item with its tags normalized via aliases, returning
+// badger.ErrKeyNotFound if it doesn't exist
+func (s *store[T, P]) find(id string) (T, error) {
+	aliases := s.aliasMap()
+
+	var item T
+	err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		item, err = s.get(txn, id)
+		return err
+	})
+	if err == nil && aliases != nil && len(P(&item).searchTags()) > 0 {
+		P(&item).setTags(normalizeTags(P(&item).searchTags(), aliases))
+	}
+	return item, err
+}
+
+// each calls fn for every stored item, skipping entries that don't decode
+func (s *store[T, P]) each(txn *badger.Txn, fn func(item P) error) error {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchSize = 50 // Increase prefetch size for better performance
+	opts.Prefix = []byte(s.prefix)
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	for it.Rewind(); it.Valid(); it.Next() {
+		var item T
+		err := it.Item().Value(func(val []byte) error {
+			return json.Unmarshal(val, &item)
+		})
+		if err != nil || P(&item).indexID() == "" {
+			// Skip invalid JSON entries
+			continue
+		}
+		if err := fn(&item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *store[T, P]) eachIndexable(txn *badger.Txn, fn func(indexable) error) error {
+	return s.each(txn, func(item P) error { return fn(item) })
+}
+
+// write stores an item and its search index entry within txn. It returns a
+// *patchError if the item attaches an unknown blob.
+func (s *store[T, P]) write(txn *badger.Txn, item P) error {
+	if err := s.resolveAttachments(txn, item, false); err != nil {
+		return err
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	if err := txn.Set(s.key(item.indexID()), data); err != nil {
+		return err
+	}
+	if err := s.writeLinks(txn, item); err != nil {
+		return err
+	}
+	if err := s.writeBlobRefs(txn, item); err != nil {
+		return err
+	}
+	return s.index.indexDoc(txn, item)
+}
+
+// create assigns a new ID to an item and stores it as its first version
+func (s *store[T, P]) create(item P) error {
+	item.setVersion(1)
+	return updateWithRetry(s.db, func(txn *badger.Txn) error {
+		id, err := s.newID(txn)
+		if err != nil {
+			return err
+		}
+		item.setID(id)
+
+		if err := s.write(txn, item); err != nil {
+			return err
+		}
+		return s.updateTags(txn, item.indexID(), nil, item.searchTags())
+	})
+}
+
+// update applies fn to the stored item and saves the result as its next
+// version. It returns badger.ErrKeyNotFound if the item doesn't exist and a
+// *staleError if the stored version doesn't meet pre. fn may run more than
+// once if the transaction conflicts with a concurrent write.
+func (s *store[T, P]) update(id string, pre precondition, fn func(existing T) (T, error)) (T, error) {
+	var updated T
+	err := updateWithRetry(s.db, func(txn *badger.Txn) error {
+		existing, err := s.get(txn, id)
+		if err != nil {
+			return err
+		}
+		version := P(&existing).version()
+		if status := pre.check(version); status != 0 {
+			return &staleError[T]{current: existing, status: status}
+		}
+
+		updated, err = fn(existing)
+		if err != nil {
+			return err
+		}
+		if err := s.recordRevision(txn, existing); err != nil {
+			return err
+		}
+		P(&updated).setVersion(version + 1)
+		if err := s.write(txn, &updated); err != nil {
+			return err
+		}
+
+		// Update the tag counts and postings with old and new tags
+		return s.updateTags(txn, id, P(&existing).searchTags(), P(&updated).searchTags())
+	})
+	return updated, err
+}
+
+// delete moves an item to the trash. It returns badger.ErrKeyNotFound if the
+// item doesn't exist and a *staleError if the stored version doesn't meet pre.
+func (s *store[T, P]) delete(id string, pre precondition) error {
+	return updateWithRetry(s.db, func(txn *badger.Txn) error {
+		existing, err := s.get(txn, id)
+		if err != nil {
+			return err
+		}
+		if status := pre.check(P(&existing).version()); status != 0 {
+			return &staleError[T]{current: existing, status: status}
+		}
+
+		if err := s.moveToTrash(txn, id, existing, time.Now()); err != nil {
+			return err
+		}
+
+		// Trashed items don't count towards their tags
+		return s.updateTagCounts(txn, P(&existing).searchTags(), nil)
+	})
+}
+
+// aliasMap loads the alias->canonical tag mapping, nil if unavailable
+func (s *store[T, P]) aliasMap() map[string]string {
+	var aliases map[string]string
+	_ = s.db.View(func(txn *badger.Txn) error {
+		m, err := NewTagAliasHandler(s.db).getAliasMap(txn, s.kind)
+		if err == nil {
+			aliases = m
+		}
+		return nil
+	})
+	return aliases
+}
+
+// normalizeTags maps aliases in requested tags to their canonical tag
+func (s *store[T, P]) normalizeTags(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	if aliases := s.aliasMap(); aliases != nil {
+		return normalizeTags(tags, aliases)
+	}
+	return tags
+}
+
+// updateTags maintains the tag counters and tag postings of an item
+func (s *store[T, P]) updateTags(txn *badger.Txn, id string, oldTags, newTags []string) error {
+	if err := s.updateTagCounts(txn, oldTags, newTags); err != nil {
+		return err
+	}
+	return s.tagIdx.update(txn, id, oldTags, newTags)
+}
+
+// updateTagCounts maintains the per-tag counters for efficient retrieval. It
+// runs in the transaction that writes the item so counts never drift from the
+// items, and only touches the counters of tags that changed.
+func (s *store[T, P]) updateTagCounts(txn *badger.Txn, oldTags, newTags []string) error {
+	delta := make(map[string]int)
+	for _, tag := range oldTags {
+		if tag != "" {
+			delta[tag]--
+		}
+	}
+	for _, tag := range newTags {
+		if tag != "" {
+			delta[tag]++
+		}
+	}
+
+	for tag, d := range delta {
+		if d == 0 {
+			continue
+		}
+		key := tagCountKey(s.kind, tag)
+		count, err := readCounter(txn, key)
+		if err != nil {
+			return err
+		}
+		if count += d; count <= 0 {
+			err = txn.Delete(key)
+		} else {
+			err = txn.Set(key, []byte(strconv.Itoa(count)))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readCounter returns the integer stored at key, 0 if it doesn't exist
+func readCounter(txn *badger.Txn, key []byte) (int, error) {
+	item, err := txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	err = item.Value(func(val []byte) error {
+		count, err = strconv.Atoi(string(val))
+		return err
+	})
+	return count, err
+}
+
+// rebuildTagCounts recomputes the tag counters by scanning all existing items
+func (s *store[T, P]) rebuildTagCounts() error {
+	// Get all tags and their counts from existing items
+	tagCounts := make(map[string]int)
+	err := s.db.View(func(txn *badger.Txn) error {
+		return s.each(txn, func(item P) error {
+			for _, tag := range item.searchTags() {
+				if tag != "" {
+					tagCounts[tag]++
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.DropPrefix(tagCountPrefix(s.kind)); err != nil {
+		return err
+	}
+	wb := s.db.NewWriteBatch()
+	defer wb.Cancel()
+	for tag, count := range tagCounts {
+		if err := wb.Set(tagCountKey(s.kind, tag), []byte(strconv.Itoa(count))); err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
+
+// rebuildTagIndex re-creates the tag postings of all items from scratch
+func (s *store[T, P]) rebuildTagIndex() error {
+	return s.tagIdx.rebuild(s.db, func(txn *badger.Txn, fn func(id string, tags []string) error) error {
+		return s.each(txn, func(item P) error {
+			return fn(item.indexID(), item.searchTags())
+		})
+	})
+}
+
+// storedTags returns every tag stored on at least one item, read from the
+// tag counters
+func (s *store[T, P]) storedTags(txn *badger.Txn) []string {
+	prefix := tagCountPrefix(s.kind)
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = prefix
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	var tags []string
+	for it.Rewind(); it.Valid(); it.Next() {
+		tags = append(tags, string(it.Item().Key()[len(prefix):]))
+	}
+	return tags
+}
+
+// allIDs returns the IDs of every stored item without loading their values
+func (s *store[T, P]) allIDs(txn *badger.Txn) idSet {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = []byte(s.prefix)
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	ids := make(idSet)
+	for it.Rewind(); it.Valid(); it.Next() {
+		ids[string(it.Item().Key()[len(s.prefix):])] = struct{}{}
+	}
+	return ids
+}
+
+// resolveTagFilter resolves the tag filter of a list request to the set of
+// matching item IDs using the tag postings. It returns nil when the request
+// has no tag filter.
+func (s *store[T, P]) resolveTagFilter(txn *badger.Txn, opts listOptions) idSet {
+	if opts.tagExpr == nil && len(opts.filterTags) == 0 && len(opts.excludeTags) == 0 {
+		return nil
+	}
+
+	// Group stored tags by the name they are filtered under once aliases are
+	// applied, mirroring how list results normalize item tags
+	byCanon := make(map[string][]string)
+	for _, tag := range s.storedTags(txn) {
+		canon := opts.aliases[tag]
+		if canon == "" {
+			canon = tag
+		}
+		if opts.tagExpr != nil {
+			// Advanced expressions compare tags case-insensitively
+			canon = strings.ToLower(canon)
+		}
+		byCanon[canon] = append(byCanon[canon], tag)
+	}
+	leaf := func(name string) idSet {
+		ids := make(idSet)
+		for _, tag := range byCanon[name] {
+			ids = ids.union(s.tagIdx.postings(txn, tag))
+		}
+		return ids
+	}
+
+	var universe idSet
+	all := func() idSet {
+		if universe == nil {
+			universe = s.allIDs(txn)
+		}
+		return universe
+	}
+
+	anyOf := func(names []string) idSet {
+		ids := make(idSet)
+		for _, name := range names {
+			ids = ids.union(leaf(name))
+		}
+		return ids
+	}
+
+	switch {
+	case opts.tagExpr != nil:
+		return opts.tagExpr.Resolve(leaf, all)
+	case len(opts.filterTags) > 0:
+		return anyOf(opts.filterTags)
+	default:
+		return all().minus(anyOf(opts.excludeTags))
+	}
+}
+
+// tagList returns "tag,{count}" entries with alias counts merged into their
+// canonical tag
+func (s *store[T, P]) tagList() ([]string, error) {
+	aliasMap := s.aliasMap()
+
+	// Read the per-tag counters
+	tagCounts := make(map[string]int)
+	err := s.db.View(func(txn *badger.Txn) error {
+		prefix := tagCountPrefix(s.kind)
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			tag := string(item.Key()[len(prefix):])
+			err := item.Value(func(val []byte) error {
+				count, err := strconv.Atoi(string(val))
+				if err != nil {
+					return err
+				}
+
+				// Merge counts by alias -> canonical
+				canon := aliasMap[tag]
+				if canon == "" {
+					canon = tag
+				}
+				tagCounts[canon] += count
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert to "tag,{count}" format
+	tags := make([]string, 0, len(tagCounts))
+	for tag, count := range tagCounts {
+		tags = append(tags, fmt.Sprintf("%s,%d", tag, count))
+	}
+	return tags, nil
+}
+
+// listOptions is a parsed list request
+type listOptions struct {
+	aliases     map[string]string
+	filterTags  []string
+	excludeTags []string
+	tagExpr     *tagExpression
+	query       *searchQuery
+	words       []string // plain keywords answered by the search index
+	page        listPage
+}
+
+// parseListOptions reads the filter, search and paging parameters of a list
+// request. Errors describe invalid input and map to 400 responses.
+func (s *store[T, P]) parseListOptions(q url.Values) (listOptions, error) {
+	opts := listOptions{aliases: s.aliasMap()}
+
+	// Split comma-separated tags and trim whitespace
+	splitTags := func(v string) []string {
+		var tags []string
+		for _, tag := range strings.Split(v, ",") {
+			if trimmed := strings.TrimSpace(tag); trimmed != "" {
+				tags = append(tags, trimmed)
+			}
+		}
+		if len(tags) > 0 && opts.aliases != nil {
+			tags = normalizeTags(tags, opts.aliases)
+		}
+		return tags
+	}
+	opts.filterTags = splitTags(q.Get("tags"))
+	opts.excludeTags = splitTags(q.Get("exclude_tags"))
+
+	// Compile the advanced expression once for the whole request
+	if advanced := strings.TrimSpace(q.Get("advanced")); advanced != "" {
+		expr, err := parseTagExpression(advanced)
+		if err != nil {
+			return opts, fmt.Errorf("Invalid advanced expression: %w", err)
+		}
+		opts.tagExpr = expr.withAliases(opts.aliases)
+	}
+
+	// Compile the keyword query once for the whole request
+	query, err := parseSearchQuery(strings.TrimSpace(q.Get("keywords")), s.fields)
+	if err != nil {
+		return opts, fmt.Errorf("Invalid search query: %w", err)
+	}
+	opts.words, opts.query = query.withAliases(opts.aliases).splitIndexTerms()
+
+	// Read paging and ordering parameters
+	opts.page, err = parseListPage(q, len(opts.words) > 0)
+	if err != nil {
+		return opts, fmt.Errorf("Invalid paging parameters: %w", err)
+	}
+	return opts, nil
+}
+
+// matchesTags applies the tag filter mode of a list request
+func (opts *listOptions) matchesTags(tags []string) bool {
+	hasAny := func(want []string) bool {
+		for _, w := range want {
+			for _, tag := range tags {
+				if tag == w {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	switch {
+	case opts.tagExpr != nil:
+		// Use advanced expression evaluation
+		return opts.tagExpr.Matches(tags)
+	case len(opts.filterTags) > 0:
+		// Only include items that have any of the required tags
+		return hasAny(opts.filterTags)
+	case len(opts.excludeTags) > 0:
+		// Exclude items that have any of the excluded tags
+		return !hasAny(opts.excludeTags)
+	}
+	return true
+}
+
+// listResult is one page of a list request
+type listResult[T any] struct {
+	Items      []T
+	Total      int
+	NextCursor string
+}
+
+// list returns the page of items matching a list request
+func (s *store[T, P]) list(opts listOptions) (listResult[T], error) {
+	// Pre-allocate slice with estimated capacity to reduce allocations
+	items := make([]T, 0, 100)
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		// visit applies the filters to one stored item
+		visit := func(item P, score float64) {
+			item.setScore(score)
+
+			// Normalize stored tags on the fly for UI/search consistency
+			if opts.aliases != nil && len(item.searchTags()) > 0 {
+				item.setTags(normalizeTags(item.searchTags(), opts.aliases))
+			}
+
+			if opts.matchesTags(item.searchTags()) && opts.query.Matches(item) {
+				items = append(items, *item)
+			}
+		}
+
+		// Resolve tag filters and keywords to candidate IDs first so only
+		// matching items are loaded
+		candidates := s.resolveTagFilter(txn, opts)
+		var scores map[string]float64
+		if len(opts.words) > 0 {
+			var err error
+			scores, err = s.index.search(txn, opts.words)
+			if err != nil {
+				return err
+			}
+			matched := make(idSet, len(scores))
+			for id := range scores {
+				matched[id] = struct{}{}
+			}
+			if candidates == nil {
+				candidates = matched
+			} else {
+				candidates = candidates.intersect(matched)
+			}
+		}
+
+		if candidates == nil {
+			return s.each(txn, func(item P) error {
+				visit(item, 0)
+				return nil
+			})
+		}
+		for id := range candidates {
+			item, err := s.get(txn, id)
+			if err == badger.ErrKeyNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			visit(&item, scores[id])
+		}
+		return nil
+	})
+	if err != nil {
+		return listResult[T]{}, err
+	}
+
+	// Sort and cut the requested page
+	page, next := paginate[T, P](items, opts.page)
+	return listResult[T]{Items: page, Total: len(items), NextCursor: next}, nil
+}
@@ -3,7 +3,6 @@ package handlers
 import (
 	"fmt"
 	"net/http"
-	"regexp"
 	"sort"
 	"strings"
 
@@ -20,16 +19,16 @@ func NewTagAliasHandler(db *badger.DB) *TagAliasHandler {
 }
 
 // storage keys per type
-func aliasKeyForType(t string) (string, error) {
+func aliasKeyForType(t string) ([]byte, error) {
 	switch t {
 	case "bookmark", "bookmarks":
-		return "bookmark_tag_aliases", nil
+		return tagAliasesKey("bookmark"), nil
 	case "note", "notes":
-		return "note_tag_aliases", nil
+		return tagAliasesKey("note"), nil
 	case "youtube":
-		return "youtube_tag_aliases", nil
+		return tagAliasesKey("youtube"), nil
 	default:
-		return "", fmt.Errorf("invalid type: %s", t)
+		return nil, fmt.Errorf("invalid type: %s", t)
 	}
 }
 
@@ -40,7 +39,7 @@ func (h *TagAliasHandler) getAliasMap(txn *badger.Txn, t string) (map[string]str
 		return nil, err
 	}
 	aliases := make(map[string]string)
-	item, err := txn.Get([]byte(key))
+	item, err := txn.Get(key)
 	if err == badger.ErrKeyNotFound {
 		return aliases, nil
 	}
@@ -63,7 +62,7 @@ func (h *TagAliasHandler) setAliasMap(txn *badger.Txn, t string, m map[string]st
 	if err != nil {
 		return err
 	}
-	return txn.Set([]byte(key), b)
+	return txn.Set(key, b)
 }
 
 // normalizeTags maps any aliases to their canonical tag and de-duplicates.
@@ -89,21 +88,6 @@ func normalizeTags(tags []string, aliases map[string]string) []string {
 	return out
 }
 
-// normalizeExpression replaces alias words with canonical in an expression.
-func normalizeExpression(expr string, aliases map[string]string) string {
-	if strings.TrimSpace(expr) == "" || len(aliases) == 0 {
-		return expr
-	}
-	wordRegex := regexp.MustCompile(`\b[a-zA-Z0-9_-]+\b`)
-	return wordRegex.ReplaceAllStringFunc(expr, func(word string) string {
-		// Preserve original casing when replacing exact alias
-		if canon, ok := aliases[word]; ok && canon != "" {
-			return canon
-		}
-		return word
-	})
-}
-
 // group view structure for UI
 type TagAliasGroupsResponse struct {
 	Success bool                `json:"success"`
@@ -112,19 +96,12 @@ type TagAliasGroupsResponse struct {
 	Count   int                 `json:"count"`
 }
 
-// GET /api/tag-aliases?type=bookmark|note|youtube
+// GET /api/v1/tag-aliases?type=bookmark|note|youtube
 func (h *TagAliasHandler) GetAliases(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
 	w.Header().Set("Content-Type", "application/json")
 	t := r.URL.Query().Get("type")
 	if t == "" {
-		writeJSONResponse(w, http.StatusBadRequest, map[string]interface{}{
-			"success": false,
-			"message": "type is required",
-		})
+		writeJSONResponse(w, http.StatusBadRequest, TagAliasGroupsResponse{Success: false, Message: "type is required"})
 		return
 	}
 	var groups map[string][]string
@@ -156,26 +133,28 @@ func (h *TagAliasHandler) GetAliases(w http.ResponseWriter, r *http.Request) {
 	writeJSONResponse(w, http.StatusOK, TagAliasGroupsResponse{Success: true, Message: "Aliases retrieved", Data: groups, Count: len(groups)})
 }
 
-type setAliasBatchRequest struct {
+// TagAliasResponse reports the outcome of an alias change
+type TagAliasResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+type SetAliasBatchRequest struct {
 	Type      string   `json:"type"`
 	Canonical string   `json:"canonical"`
 	Aliases   []string `json:"aliases"`
 }
 
-// POST /api/tag-aliases/batch {type, canonical, aliases[]}
+// POST /api/v1/tag-aliases/batch {type, canonical, aliases[]}
 func (h *TagAliasHandler) SetAliasesBatch(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
 	w.Header().Set("Content-Type", "application/json")
-	var req setAliasBatchRequest
+	var req SetAliasBatchRequest
 	if err := readJSONRequest(r, &req); err != nil {
-		writeJSONResponse(w, http.StatusBadRequest, map[string]interface{}{"success": false, "message": "Invalid JSON"})
+		writeJSONResponse(w, http.StatusBadRequest, TagAliasResponse{Success: false, Message: "Invalid JSON"})
 		return
 	}
 	if req.Type == "" || req.Canonical == "" || len(req.Aliases) == 0 {
-		writeJSONResponse(w, http.StatusBadRequest, map[string]interface{}{"success": false, "message": "type, canonical, and aliases are required"})
+		writeJSONResponse(w, http.StatusBadRequest, TagAliasResponse{Success: false, Message: "type, canonical, and aliases are required"})
 		return
 	}
 	err := h.db.Update(func(txn *badger.Txn) error {
@@ -193,25 +172,21 @@ func (h *TagAliasHandler) SetAliasesBatch(w http.ResponseWriter, r *http.Request
 		return h.setAliasMap(txn, req.Type, m)
 	})
 	if err != nil {
-		writeJSONResponse(w, http.StatusInternalServerError, map[string]interface{}{"success": false, "message": "Failed to save aliases"})
+		writeJSONResponse(w, http.StatusInternalServerError, TagAliasResponse{Success: false, Message: "Failed to save aliases"})
 		return
 	}
-	writeJSONResponse(w, http.StatusOK, map[string]interface{}{"success": true, "message": "Aliases saved"})
+	writeJSONResponse(w, http.StatusOK, TagAliasResponse{Success: true, Message: "Aliases saved"})
 }
 
-// DELETE /api/tag-aliases?type=...&alias=... to remove one alias
-// or DELETE /api/tag-aliases/group?type=...&canonical=... to remove all aliases pointing to canonical
+// DELETE /api/v1/tag-aliases?type=...&alias=... to remove one alias
+// or DELETE /api/v1/tag-aliases/group?type=...&canonical=... to remove all aliases pointing to canonical
 func (h *TagAliasHandler) DeleteAlias(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	path := r.URL.Path
-	if r.Method != http.MethodDelete {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
 	q := r.URL.Query()
 	t := q.Get("type")
 	if t == "" {
-		writeJSONResponse(w, http.StatusBadRequest, map[string]interface{}{"success": false, "message": "type is required"})
+		writeJSONResponse(w, http.StatusBadRequest, TagAliasResponse{Success: false, Message: "type is required"})
 		return
 	}
 	err := h.db.Update(func(txn *badger.Txn) error {
@@ -240,8 +215,8 @@ func (h *TagAliasHandler) DeleteAlias(w http.ResponseWriter, r *http.Request) {
 		return h.setAliasMap(txn, t, m)
 	})
 	if err != nil {
-		writeJSONResponse(w, http.StatusBadRequest, map[string]interface{}{"success": false, "message": err.Error()})
+		writeJSONResponse(w, http.StatusBadRequest, TagAliasResponse{Success: false, Message: err.Error()})
 		return
 	}
-	writeJSONResponse(w, http.StatusOK, map[string]interface{}{"success": true, "message": "Alias removed"})
+	writeJSONResponse(w, http.StatusOK, TagAliasResponse{Success: true, Message: "Alias removed"})
 }
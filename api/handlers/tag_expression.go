@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Advanced tag expressions
+//
+// Grammar (lowest to highest precedence):
+//
+//	expr    = orExpr
+//	orExpr  = andExpr { ("or" | "||") andExpr }
+//	andExpr = unary { ("and" | "&&") unary }
+//	unary   = ("not" | "!") unary | primary
+//	primary = tag | "(" expr ")"
+//	tag     = ["#"] word | ["#"] '"' quoted '"'
+//
+// Operator keywords are case-insensitive. Tags match case-insensitively.
+// A tag may contain any character other than whitespace, parentheses and
+// quotes; use a quoted tag ("my tag", #"c++ (old)") for anything else.
+
+// tagExprError describes an invalid expression and where it went wrong.
+type tagExprError struct {
+	Pos int // 1-based character position in the source expression
+	Msg string
+}
+
+func (e *tagExprError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+}
+
+type tagTokenKind int
+
+const (
+	tagTokEOF tagTokenKind = iota
+	tagTokTag
+	tagTokAnd
+	tagTokOr
+	tagTokNot
+	tagTokLParen
+	tagTokRParen
+)
+
+type tagToken struct {
+	kind tagTokenKind
+	text string // tag name for tagTokTag, raw source otherwise
+	pos  int    // 1-based character position
+}
+
+func (t tagToken) describe() string {
+	switch t.kind {
+	case tagTokEOF:
+		return "end of expression"
+	case tagTokTag:
+		return fmt.Sprintf("tag %q", t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+// tokenizeTagExpression splits an expression into tokens
+func tokenizeTagExpression(src string) ([]tagToken, error) {
+	runes := []rune(src)
+	var tokens []tagToken
+
+	isWordRune := func(r rune) bool {
+		return !unicode.IsSpace(r) && r != '(' && r != ')' && r != '"'
+	}
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		pos := i + 1
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, tagToken{kind: tagTokLParen, text: "(", pos: pos})
+			i++
+		case r == ')':
+			tokens = append(tokens, tagToken{kind: tagTokRParen, text: ")", pos: pos})
+			i++
+		case r == '!':
+			tokens = append(tokens, tagToken{kind: tagTokNot, text: "!", pos: pos})
+			i++
+		case r == '&' || r == '|':
+			if i+1 >= len(runes) || runes[i+1] != r {
+				return nil, &tagExprError{Pos: pos, Msg: fmt.Sprintf("unexpected %q (did you mean %q?)", string(r), string(r)+string(r))}
+			}
+			kind := tagTokAnd
+			if r == '|' {
+				kind = tagTokOr
+			}
+			tokens = append(tokens, tagToken{kind: kind, text: string(r) + string(r), pos: pos})
+			i += 2
+		default:
+			hashed := r == '#'
+			if hashed {
+				i++
+			}
+			if i < len(runes) && runes[i] == '"' {
+				// Quoted tag, backslash escapes the next character
+				var sb strings.Builder
+				i++
+				closed := false
+				for i < len(runes) {
+					c := runes[i]
+					if c == '\\' && i+1 < len(runes) {
+						sb.WriteRune(runes[i+1])
+						i += 2
+						continue
+					}
+					if c == '"' {
+						closed = true
+						i++
+						break
+					}
+					sb.WriteRune(c)
+					i++
+				}
+				if !closed {
+					return nil, &tagExprError{Pos: pos, Msg: "unterminated quoted tag"}
+				}
+				if sb.Len() == 0 {
+					return nil, &tagExprError{Pos: pos, Msg: "empty tag"}
+				}
+				tokens = append(tokens, tagToken{kind: tagTokTag, text: sb.String(), pos: pos})
+				continue
+			}
+
+			start := i
+			for i < len(runes) && isWordRune(runes[i]) {
+				i++
+			}
+			word := string(runes[start:i])
+			if word == "" {
+				return nil, &tagExprError{Pos: pos, Msg: "expected tag name after '#'"}
+			}
+
+			if !hashed {
+				switch strings.ToLower(word) {
+				case "and":
+					tokens = append(tokens, tagToken{kind: tagTokAnd, text: word, pos: pos})
+					continue
+				case "or":
+					tokens = append(tokens, tagToken{kind: tagTokOr, text: word, pos: pos})
+					continue
+				case "not":
+					tokens = append(tokens, tagToken{kind: tagTokNot, text: word, pos: pos})
+					continue
+				}
+			}
+			tokens = append(tokens, tagToken{kind: tagTokTag, text: word, pos: pos})
+		}
+	}
+
+	tokens = append(tokens, tagToken{kind: tagTokEOF, pos: len(runes) + 1})
+	return tokens, nil
+}
+
+// tagNode is a node of a parsed tag expression
+type tagNode interface {
+	eval(tags map[string]bool) bool
+	// resolve evaluates the node over sets of item IDs: leaf returns the
+	// items carrying a tag and all returns every item.
+	resolve(leaf func(name string) idSet, all func() idSet) idSet
+}
+
+type tagLeaf struct {
+	name string // lowercased
+}
+
+type tagNot struct {
+	x tagNode
+}
+
+type tagAnd struct {
+	left, right tagNode
+}
+
+type tagOr struct {
+	left, right tagNode
+}
+
+func (n *tagLeaf) eval(tags map[string]bool) bool { return tags[n.name] }
+func (n *tagNot) eval(tags map[string]bool) bool  { return !n.x.eval(tags) }
+func (n *tagAnd) eval(tags map[string]bool) bool {
+	return n.left.eval(tags) && n.right.eval(tags)
+}
+func (n *tagOr) eval(tags map[string]bool) bool {
+	return n.left.eval(tags) || n.right.eval(tags)
+}
+
+func (n *tagLeaf) resolve(leaf func(string) idSet, all func() idSet) idSet {
+	return leaf(n.name)
+}
+func (n *tagNot) resolve(leaf func(string) idSet, all func() idSet) idSet {
+	return all().minus(n.x.resolve(leaf, all))
+}
+func (n *tagAnd) resolve(leaf func(string) idSet, all func() idSet) idSet {
+	return n.left.resolve(leaf, all).intersect(n.right.resolve(leaf, all))
+}
+func (n *tagOr) resolve(leaf func(string) idSet, all func() idSet) idSet {
+	return n.left.resolve(leaf, all).union(n.right.resolve(leaf, all))
+}
+
+// tagExprParser is a recursive-descent parser over a token slice
+type tagExprParser struct {
+	tokens []tagToken
+	pos    int
+}
+
+func (p *tagExprParser) peek() tagToken { return p.tokens[p.pos] }
+
+func (p *tagExprParser) next() tagToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tagTokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *tagExprParser) parseOr() (tagNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tagTokOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &tagOr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *tagExprParser) parseAnd() (tagNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tagTokAnd {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &tagAnd{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *tagExprParser) parseUnary() (tagNode, error) {
+	if p.peek().kind == tagTokNot {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &tagNot{x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *tagExprParser) parsePrimary() (tagNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tagTokTag:
+		return &tagLeaf{name: strings.ToLower(tok.text)}, nil
+	case tagTokLParen:
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		closing := p.next()
+		if closing.kind != tagTokRParen {
+			return nil, &tagExprError{Pos: closing.pos, Msg: fmt.Sprintf("expected ')' to close '(' at position %d, found %s", tok.pos, closing.describe())}
+		}
+		return x, nil
+	default:
+		return nil, &tagExprError{Pos: tok.pos, Msg: fmt.Sprintf("expected tag or '(', found %s", tok.describe())}
+	}
+}
+
+// tagExpression is a compiled advanced tag expression, parsed once per request
+type tagExpression struct {
+	root tagNode
+}
+
+// parseTagExpression compiles an advanced tag expression
+func parseTagExpression(src string) (*tagExpression, error) {
+	tokens, err := tokenizeTagExpression(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &tagExprParser{tokens: tokens}
+	if p.peek().kind == tagTokEOF {
+		return nil, &tagExprError{Pos: 1, Msg: "empty expression"}
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tagTokEOF {
+		msg := fmt.Sprintf("unexpected %s", tok.describe())
+		if tok.kind == tagTokTag || tok.kind == tagTokLParen || tok.kind == tagTokNot {
+			msg += " (missing 'and' or 'or'?)"
+		}
+		return nil, &tagExprError{Pos: tok.pos, Msg: msg}
+	}
+	return &tagExpression{root: root}, nil
+}
+
+// Matches reports whether a set of item tags satisfies the expression
+func (e *tagExpression) Matches(tags []string) bool {
+	if e == nil {
+		return true // No expression matches all
+	}
+	tagSet := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tagSet[strings.ToLower(tag)] = true
+	}
+	return e.root.eval(tagSet)
+}
+
+// Resolve returns the IDs of the items satisfying the expression. leaf
+// returns the items carrying a (lowercased) tag and all returns every item.
+func (e *tagExpression) Resolve(leaf func(name string) idSet, all func() idSet) idSet {
+	return e.root.resolve(leaf, all)
+}
+
+// withAliases returns a copy of the expression with alias tags replaced by
+// their canonical tag.
+func (e *tagExpression) withAliases(aliases map[string]string) *tagExpression {
+	if e == nil || len(aliases) == 0 {
+		return e
+	}
+	lower := make(map[string]string, len(aliases))
+	for alias, canon := range aliases {
+		if canon != "" {
+			lower[strings.ToLower(alias)] = strings.ToLower(canon)
+		}
+	}
+	var rewrite func(n tagNode) tagNode
+	rewrite = func(n tagNode) tagNode {
+		switch n := n.(type) {
+		case *tagLeaf:
+			if canon, ok := lower[n.name]; ok {
+				return &tagLeaf{name: canon}
+			}
+			return n
+		case *tagNot:
+			return &tagNot{x: rewrite(n.x)}
+		case *tagAnd:
+			return &tagAnd{left: rewrite(n.left), right: rewrite(n.right)}
+		case *tagOr:
+			return &tagOr{left: rewrite(n.left), right: rewrite(n.right)}
+		}
+		return n
+	}
+	return &tagExpression{root: rewrite(e.root)}
+}
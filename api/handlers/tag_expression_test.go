@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// formatTagNode prints an expression tree with every operation parenthesized
+func formatTagNode(n tagNode) string {
+	switch n := n.(type) {
+	case *tagLeaf:
+		return n.name
+	case *tagNot:
+		return "!" + formatTagNode(n.x)
+	case *tagAnd:
+		return "(" + formatTagNode(n.left) + " & " + formatTagNode(n.right) + ")"
+	case *tagOr:
+		return "(" + formatTagNode(n.left) + " | " + formatTagNode(n.right) + ")"
+	}
+	return "?"
+}
+
+func TestParseTagExpression(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"go", "go"},
+		{"#Go", "go"},
+		{"a and b or c", "((a & b) | c)"},
+		{"a or b and c", "(a | (b & c))"},
+		{"a or b or c", "((a | b) | c)"},
+		{"a && b && c", "((a & b) & c)"},
+		{"not a and b", "(!a & b)"},
+		{"not (a and b)", "!(a & b)"},
+		{"!!a || b", "(!!a | b)"},
+		{"(a or b) and not c", "((a | b) & !c)"},
+		{"web AND (go Or rust) and NOT old", "((web & (go | rust)) & !old)"},
+		{`"my tag" or #"c++ (old)"`, "(my tag | c++ (old))"},
+		{`"say \"hi\""`, `say "hi"`},
+		{"c++ and c#", "(c++ & c#)"},
+		{"andy or order", "(andy | order)"},
+	}
+	for _, tt := range tests {
+		expr, err := parseTagExpression(tt.src)
+		if err != nil {
+			t.Errorf("%q: %v", tt.src, err)
+			continue
+		}
+		if got := formatTagNode(expr.root); got != tt.want {
+			t.Errorf("%q parsed as %s, want %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestParseTagExpressionErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		pos int
+		msg string
+	}{
+		{"", 1, "empty expression"},
+		{"   ", 1, "empty expression"},
+		{"a and", 6, "expected tag or '(', found end of expression"},
+		{"a or or b", 6, `expected tag or '(', found "or"`},
+		{"(a or b", 8, "expected ')' to close '(' at position 1"},
+		{"a and (b or (c)", 16, "expected ')' to close '(' at position 7"},
+		{"a b", 3, `unexpected tag "b" (missing 'and' or 'or'?)`},
+		{"a)", 2, `unexpected ")"`},
+		{"a & b", 3, `unexpected "&" (did you mean "&&"?)`},
+		{"a | b", 3, `unexpected "|" (did you mean "||"?)`},
+		{`a or "b`, 6, "unterminated quoted tag"},
+		{`a or ""`, 6, "empty tag"},
+		{"()", 2, `expected tag or '(', found ")"`},
+		{"ü and ö)", 8, `unexpected ")"`},
+	}
+	for _, tt := range tests {
+		_, err := parseTagExpression(tt.src)
+		var perr *tagExprError
+		if !errors.As(err, &perr) {
+			t.Errorf("%q: error %v, want a *tagExprError", tt.src, err)
+			continue
+		}
+		if perr.Pos != tt.pos || !strings.HasPrefix(perr.Msg, tt.msg) {
+			t.Errorf("%q: %q at %d, want %q at %d", tt.src, perr.Msg, perr.Pos, tt.msg, tt.pos)
+		}
+	}
+}
+
+func TestTagExpressionMatches(t *testing.T) {
+	expr, err := parseTagExpression("web and (go or rust) and not old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		tags []string
+		want bool
+	}{
+		{[]string{"web", "go"}, true},
+		{[]string{"WEB", "Rust"}, true},
+		{[]string{"web", "go", "old"}, false},
+		{[]string{"go", "rust"}, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := expr.Matches(tt.tags); got != tt.want {
+			t.Errorf("Matches(%v) = %v, want %v", tt.tags, got, tt.want)
+		}
+	}
+}
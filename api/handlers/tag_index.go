@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Tag posting index
+//
+// Every (tag, item) pair is stored as an empty key
+//
+//	tagidx/<type>/<tag>/<id>
+//
+// using the tag exactly as it is stored on the item. List requests resolve
+// tag filters and advanced expressions to a set of item IDs with set
+// operations on these postings, so only matching items are loaded.
+
+// idSet is a set of item IDs
+type idSet map[string]struct{}
+
+func (s idSet) union(o idSet) idSet {
+	out := make(idSet, len(s)+len(o))
+	for id := range s {
+		out[id] = struct{}{}
+	}
+	for id := range o {
+		out[id] = struct{}{}
+	}
+	return out
+}
+
+func (s idSet) intersect(o idSet) idSet {
+	if len(o) < len(s) {
+		s, o = o, s
+	}
+	out := make(idSet, len(s))
+	for id := range s {
+		if _, ok := o[id]; ok {
+			out[id] = struct{}{}
+		}
+	}
+	return out
+}
+
+func (s idSet) minus(o idSet) idSet {
+	out := make(idSet, len(s))
+	for id := range s {
+		if _, ok := o[id]; !ok {
+			out[id] = struct{}{}
+		}
+	}
+	return out
+}
+
+// tagIndex is the tag posting index for one item type
+type tagIndex struct {
+	kind string
+}
+
+func (ix *tagIndex) prefix() []byte {
+	return []byte("tagidx/" + ix.kind + "/")
+}
+
+func (ix *tagIndex) tagPrefix(tag string) []byte {
+	return append(append(ix.prefix(), tag...), '/')
+}
+
+func (ix *tagIndex) postingKey(tag, id string) []byte {
+	return append(ix.tagPrefix(tag), id...)
+}
+
+// update replaces an item's postings for oldTags with postings for newTags
+func (ix *tagIndex) update(txn *badger.Txn, id string, oldTags, newTags []string) error {
+	keep := make(map[string]bool, len(newTags))
+	for _, tag := range newTags {
+		if tag != "" {
+			keep[tag] = true
+		}
+	}
+	for _, tag := range oldTags {
+		if tag != "" && !keep[tag] {
+			if err := txn.Delete(ix.postingKey(tag, id)); err != nil {
+				return err
+			}
+		}
+	}
+	for tag := range keep {
+		if err := txn.Set(ix.postingKey(tag, id), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postings returns the IDs of the items carrying a stored tag
+func (ix *tagIndex) postings(txn *badger.Txn, tag string) idSet {
+	prefix := ix.tagPrefix(tag)
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = prefix
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	ids := make(idSet)
+	for it.Rewind(); it.Valid(); it.Next() {
+		id := string(it.Item().Key()[len(prefix):])
+		// Skip postings of longer tags that share this prefix ("a" vs "a/b")
+		if id != "" && !strings.Contains(id, "/") {
+			ids[id] = struct{}{}
+		}
+	}
+	return ids
+}
+
+// rebuild re-creates the postings of all items from scratch
+func (ix *tagIndex) rebuild(db *badger.DB, each func(txn *badger.Txn, fn func(id string, tags []string) error) error) error {
+	if err := db.DropPrefix(ix.prefix()); err != nil {
+		return err
+	}
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+
+	err := db.View(func(txn *badger.Txn) error {
+		return each(txn, func(id string, tags []string) error {
+			for _, tag := range tags {
+				if tag != "" {
+					if err := wb.Set(ix.postingKey(tag, id), nil); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return wb.Flush()
+}
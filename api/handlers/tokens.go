@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// API tokens
+//
+// Tokens look like mon_token_<ULID>_<64 hex digits>. The part before the
+// secret is the token's ID, so a request costs one key lookup; only a
+// SHA-256 of the secret is stored, and the token itself is shown once, when
+// it is created.
+
+// tokenPrefix starts every API token
+const tokenPrefix = "mon_"
+
+// tokenUseInterval limits how often last_used_at is rewritten
+const tokenUseInterval = time.Hour
+
+// maxTokenNameLength bounds token names
+const maxTokenNameLength = 100
+
+var errBadToken = errors.New("malformed API token")
+
+// APIToken is a named credential for scripts
+type APIToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Token      string     `json:"token,omitempty"` // Only returned when the token is created
+	SecretHash string     `json:"secret_hash,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+type NewTokenRequest struct {
+	Name string `json:"name"`
+}
+
+type TokenResponse struct {
+	Success bool      `json:"success"`
+	Message string    `json:"message"`
+	Data    *APIToken `json:"data,omitempty"`
+}
+
+type TokensListResponse struct {
+	Success bool       `json:"success"`
+	Message string     `json:"message"`
+	Data    []APIToken `json:"data"`
+	Count   int        `json:"count"`
+}
+
+func tokenKey(id string) []byte { return []byte(authTokenKeyPrefix + id) }
+
+// public returns the token without its secret hash, for responses
+func (t APIToken) public() APIToken {
+	t.SecretHash = ""
+	return t
+}
+
+// createToken stores a new token and returns it with its secret
+func createToken(db *badger.DB, name string) (APIToken, error) {
+	id := newItemID("token")
+	secret := newSecret(32)
+	t := APIToken{
+		ID:         id,
+		Name:       name,
+		SecretHash: secretHash(secret),
+		CreatedAt:  time.Now(),
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return t, err
+	}
+	err = updateWithRetry(db, func(txn *badger.Txn) error {
+		return txn.Set(tokenKey(id), data)
+	})
+	t.Token = tokenPrefix + id + "_" + secret
+	return t, err
+}
+
+// verifyToken returns the stored token matching raw. It returns errBadToken
+// or badger.ErrKeyNotFound if there is none.
+func verifyToken(db *badger.DB, raw string) (APIToken, error) {
+	var t APIToken
+	rest, ok := strings.CutPrefix(raw, tokenPrefix)
+	if !ok {
+		return t, errBadToken
+	}
+	sep := strings.LastIndexByte(rest, '_')
+	if sep <= 0 || sep == len(rest)-1 {
+		return t, errBadToken
+	}
+	id, secret := rest[:sep], rest[sep+1:]
+
+	err := db.View(func(txn *badger.Txn) error {
+		it, err := txn.Get(tokenKey(id))
+		if err != nil {
+			return err
+		}
+		return it.Value(func(val []byte) error { return json.Unmarshal(val, &t) })
+	})
+	if err != nil {
+		return t, err
+	}
+	if subtle.ConstantTimeCompare([]byte(secretHash(secret)), []byte(t.SecretHash)) != 1 {
+		return t, errBadToken
+	}
+
+	// Record the use now and then; a failure only leaves the time stale
+	now := time.Now()
+	if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) > tokenUseInterval {
+		t.LastUsedAt = &now
+		if data, err := json.Marshal(t); err == nil {
+			err = updateWithRetry(db, func(txn *badger.Txn) error {
+				if _, err := txn.Get(tokenKey(id)); err != nil {
+					return err // revoked meanwhile
+				}
+				return txn.Set(tokenKey(id), data)
+			})
+			if err != nil && err != badger.ErrKeyNotFound {
+				Warnf("failed to record use of API token %s: %v", id, err)
+			}
+		}
+	}
+	return t, nil
+}
+
+// listTokens returns every token, newest first
+func listTokens(db *badger.DB) ([]APIToken, error) {
+	tokens := []APIToken{}
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(authTokenKeyPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			var t APIToken
+			if err := it.Item().Value(func(val []byte) error { return json.Unmarshal(val, &t) }); err != nil {
+				Warnf("skipping unreadable API token %s: %v", it.Item().Key(), err)
+				continue
+			}
+			tokens = append(tokens, t.public())
+		}
+		return nil
+	})
+	sort.SliceStable(tokens, func(i, j int) bool { return tokens[i].CreatedAt.After(tokens[j].CreatedAt) })
+	return tokens, err
+}
+
+// revokeToken deletes a token. It returns badger.ErrKeyNotFound if there is
+// no such token.
+func revokeToken(db *badger.DB, id string) error {
+	return updateWithRetry(db, func(txn *badger.Txn) error {
+		if _, err := txn.Get(tokenKey(id)); err != nil {
+			return err
+		}
+		return txn.Delete(tokenKey(id))
+	})
+}
+
+// GetTokens lists the API tokens without their secrets
+func (h *AuthHandler) GetTokens(w http.ResponseWriter, r *http.Request) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	tokens, err := listTokens(h.db)
+	if err != nil {
+		response := TokensListResponse{
+			Success: false,
+			Message: "Error reading API tokens from database",
+			Data:    []APIToken{},
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	// Return success response
+	response := TokensListResponse{
+		Success: true,
+		Message: "API tokens retrieved successfully",
+		Data:    tokens,
+		Count:   len(tokens),
+	}
+
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// CreateToken creates a named API token and returns it once
+func (h *AuthHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	var req NewTokenRequest
+	if err := readJSONRequest(r, &req); err != nil {
+		response := TokenResponse{
+			Success: false,
+			Message: "Invalid JSON format",
+		}
+		writeJSONResponse(w, http.StatusBadRequest, response)
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > maxTokenNameLength {
+		response := TokenResponse{
+			Success: false,
+			Message: "Name is required and at most 100 characters",
+		}
+		writeJSONResponse(w, http.StatusBadRequest, response)
+		return
+	}
+
+	token, err := createToken(h.db, name)
+	if err != nil {
+		response := TokenResponse{
+			Success: false,
+			Message: "Error saving API token to database",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	// Return success response
+	token = token.public()
+	response := TokenResponse{
+		Success: true,
+		Message: "API token created; store it now, it won't be shown again",
+		Data:    &token,
+	}
+
+	writeJSONResponse(w, http.StatusCreated, response)
+}
+
+// RevokeToken deletes an API token
+func (h *AuthHandler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get token ID from the {id} path segment
+	id := r.PathValue("id")
+
+	if err := revokeToken(h.db, id); err != nil {
+		if err == badger.ErrKeyNotFound {
+			response := TokenResponse{
+				Success: false,
+				Message: "API token not found",
+			}
+			writeJSONResponse(w, http.StatusNotFound, response)
+			return
+		}
+
+		response := TokenResponse{
+			Success: false,
+			Message: "Error revoking API token",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	// Return success response
+	response := TokenResponse{
+		Success: true,
+		Message: "API token revoked",
+	}
+
+	writeJSONResponse(w, http.StatusOK, response)
+}
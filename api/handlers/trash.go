@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Trash
+//
+// Deleting an item moves it to trash/<type>/<id> with a deleted_at time.
+// Trashed items leave the search index, tag postings and tag counts exactly
+// like a permanent delete, so lists and tag lists never see them, but keep
+// their blob references. They can be restored, purged one by one or all at
+// once, and PurgeTrashPeriodically removes items that have been in the trash
+// longer than the retention.
+
+// errRestoreConflict means a live item already has the ID being restored
+var errRestoreConflict = errors.New("an item with this ID already exists")
+
+type EmptyTrashResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Count   int    `json:"count"` // Items purged
+}
+
+// trashPurgeInterval is how often the background purger runs
+const trashPurgeInterval = time.Hour
+
+func (s *store[T, P]) trashKey(id string) []byte {
+	return append(trashPrefix(s.kind), id...)
+}
+
+// moveToTrash removes a live item within txn and keeps it in the trash.
+// Callers update the tag counters.
+func (s *store[T, P]) moveToTrash(txn *badger.Txn, id string, existing T, now time.Time) error {
+	if err := txn.Delete(s.key(id)); err != nil {
+		return err
+	}
+	if err := s.index.removeDoc(txn, id); err != nil {
+		return err
+	}
+	if err := s.tagIdx.update(txn, id, P(&existing).searchTags(), nil); err != nil {
+		return err
+	}
+	if err := updateLinks(txn, s.kind, id, nil); err != nil {
+		return err
+	}
+
+	trashed := existing
+	P(&trashed).setDeletedAt(&now)
+	data, err := json.Marshal(trashed)
+	if err != nil {
+		return err
+	}
+	return txn.Set(s.trashKey(id), data)
+}
+
+// trashed returns the items in the trash, most recently deleted first
+func (s *store[T, P]) trashed() ([]T, error) {
+	items := []T{}
+	var deleted []time.Time
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = trashPrefix(s.kind)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			var item T
+			var meta struct {
+				DeletedAt time.Time `json:"deleted_at"`
+			}
+			err := it.Item().Value(func(val []byte) error {
+				if err := json.Unmarshal(val, &item); err != nil {
+					return err
+				}
+				return json.Unmarshal(val, &meta)
+			})
+			if err != nil {
+				Warnf("skipping unreadable trash entry %s: %v", it.Item().Key(), err)
+				continue
+			}
+			items = append(items, item)
+			deleted = append(deleted, meta.DeletedAt)
+		}
+		return nil
+	})
+
+	order := make([]int, len(items))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return deleted[order[a]].After(deleted[order[b]]) })
+	sorted := make([]T, len(items))
+	for i, j := range order {
+		sorted[i] = items[j]
+	}
+	return sorted, err
+}
+
+// restore moves an item from the trash back to the live items as a new
+// version. It returns badger.ErrKeyNotFound if the item isn't in the trash
+// and errRestoreConflict if a live item has its ID.
+func (s *store[T, P]) restore(id string) (T, error) {
+	var restored T
+	err := updateWithRetry(s.db, func(txn *badger.Txn) error {
+		it, err := txn.Get(s.trashKey(id))
+		if err != nil {
+			return err
+		}
+		if err := it.Value(func(val []byte) error { return json.Unmarshal(val, &restored) }); err != nil {
+			return err
+		}
+		if _, err := txn.Get(s.key(id)); err == nil {
+			return errRestoreConflict
+		} else if err != badger.ErrKeyNotFound {
+			return err
+		}
+
+		item := P(&restored)
+		item.setDeletedAt(nil)
+		item.setVersion(item.version() + 1)
+		if err := txn.Delete(s.trashKey(id)); err != nil {
+			return err
+		}
+		if err := s.write(txn, item); err != nil {
+			return err
+		}
+		return s.updateTags(txn, id, nil, item.searchTags())
+	})
+	return restored, err
+}
+
+// purge permanently removes one item from the trash. It returns
+// badger.ErrKeyNotFound if the item isn't in the trash.
+func (s *store[T, P]) purge(id string) error {
+	return updateWithRetry(s.db, func(txn *badger.Txn) error {
+		_, err := s.purgeTrashed(txn, id, time.Time{})
+		return err
+	})
+}
+
+// purgeTrashed removes a trashed item with its revisions and blob
+// references within txn, provided it was deleted before cutoff or cutoff is
+// zero. It returns badger.ErrKeyNotFound if the item isn't in the trash, so
+// an item restored meanwhile keeps its history.
+func (s *store[T, P]) purgeTrashed(txn *badger.Txn, id string, cutoff time.Time) (bool, error) {
+	it, err := txn.Get(s.trashKey(id))
+	if err != nil {
+		return false, err
+	}
+	if !cutoff.IsZero() {
+		var meta struct {
+			DeletedAt time.Time `json:"deleted_at"`
+		}
+		err := it.Value(func(val []byte) error { return json.Unmarshal(val, &meta) })
+		if err == nil && !meta.DeletedAt.Before(cutoff) {
+			return false, nil
+		}
+	}
+
+	if s.history != nil {
+		if err := s.history.drop(txn, id); err != nil {
+			return false, err
+		}
+	}
+	if err := updateBlobRefs(txn, s.kind, id, nil); err != nil {
+		return false, err
+	}
+	return true, txn.Delete(s.trashKey(id))
+}
+
+// purgeTrash permanently removes the items deleted before cutoff, or every
+// trashed item if cutoff is zero, and returns how many were removed. Each
+// item is purged in its own transaction that checks it is still in the
+// trash, so a concurrent restore wins.
+func (s *store[T, P]) purgeTrash(cutoff time.Time) (int, error) {
+	var ids []string
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = trashPrefix(s.kind)
+		opts.PrefetchValues = !cutoff.IsZero()
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			if !cutoff.IsZero() {
+				var meta struct {
+					DeletedAt time.Time `json:"deleted_at"`
+				}
+				err := it.Item().Value(func(val []byte) error { return json.Unmarshal(val, &meta) })
+				if err == nil && !meta.DeletedAt.Before(cutoff) {
+					continue
+				}
+			}
+			ids = append(ids, string(it.Item().Key()[len(opts.Prefix):]))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, id := range ids {
+		var removed bool
+		err := updateWithRetry(s.db, func(txn *badger.Txn) error {
+			var err error
+			removed, err = s.purgeTrashed(txn, id, cutoff)
+			return err
+		})
+		if err == badger.ErrKeyNotFound {
+			continue // restored or purged meanwhile
+		}
+		if err != nil {
+			return purged, err
+		}
+		if removed {
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// PurgeTrashPeriodically empties trashed items older than retention every
+// hour until ctx is cancelled. A retention of zero or less keeps trashed
+// items until they are purged by hand.
+func PurgeTrashPeriodically(ctx context.Context, db *badger.DB, retention time.Duration) {
+	if retention <= 0 {
+		return
+	}
+
+	type purger interface {
+		purgeTrash(cutoff time.Time) (int, error)
+	}
+	stores := map[string]purger{
+		"bookmark": newBookmarkStore(db),
+		"note":     newNoteStore(db),
+		"youtube":  newYoutubeStore(db),
+	}
+
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+	for {
+		cutoff := time.Now().Add(-retention)
+		for kind, s := range stores {
+			n, err := s.purgeTrash(cutoff)
+			if err != nil {
+				Warnf("failed to purge %s trash: %v", kind, err)
+			} else if n > 0 {
+				Infof("🗑️  Purged %d %s item(s) from the trash", n, kind)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
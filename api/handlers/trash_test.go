@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// trashedNote stores a note with an attachment and one revision and moves it
+// to the trash
+func trashedNote(t *testing.T, db *badger.DB, s *store[Note, *Note]) (id, sha string) {
+	t.Helper()
+	blob, err := saveBlob(db, strings.NewReader("attachment"), "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	note := &Note{Title: "Old", Description: "<p>x</p>", Attachments: []Attachment{{Blob: blob.SHA256}}}
+	if err := s.create(note); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.update(note.ID, precondition{}, func(existing Note) (Note, error) {
+		existing.Title = "New"
+		return existing, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.delete(note.ID, precondition{}); err != nil {
+		t.Fatal(err)
+	}
+	return note.ID, blob.SHA256
+}
+
+// checkKept reports whether an item still has its revision and blob reference
+func checkKept(t *testing.T, db *badger.DB, s *store[Note, *Note], id, sha string, want bool) {
+	t.Helper()
+	var revs [][]byte
+	var referenced bool
+	db.View(func(txn *badger.Txn) error {
+		revs = s.history.keys(txn, id)
+		referenced = blobReferenced(txn, sha)
+		return nil
+	})
+	if (len(revs) > 0) != want || referenced != want {
+		t.Errorf("%d revisions, blob referenced = %v; want kept = %v", len(revs), referenced, want)
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	db := openTestDB(t)
+	BlobDir = t.TempDir()
+	s := newNoteStore(db)
+	id, sha := trashedNote(t, db, s)
+
+	// Not yet expired
+	if n, err := s.purgeTrash(time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Fatalf("purgeTrash before expiry = %d, %v; want 0", n, err)
+	}
+	checkKept(t, db, s, id, sha, true)
+
+	if n, err := s.purgeTrash(time.Now().Add(time.Hour)); err != nil || n != 1 {
+		t.Fatalf("purgeTrash after expiry = %d, %v; want 1", n, err)
+	}
+	checkKept(t, db, s, id, sha, false)
+}
+
+func TestPurgeSkipsRestoredItem(t *testing.T) {
+	db := openTestDB(t)
+	BlobDir = t.TempDir()
+	s := newNoteStore(db)
+	id, sha := trashedNote(t, db, s)
+
+	// A restore lands after the purger listed the item but before it purges
+	if _, err := s.restore(id); err != nil {
+		t.Fatal(err)
+	}
+	err := updateWithRetry(db, func(txn *badger.Txn) error {
+		_, err := s.purgeTrashed(txn, id, time.Now().Add(time.Hour))
+		return err
+	})
+	if err != badger.ErrKeyNotFound {
+		t.Fatalf("purging a restored item: %v, want ErrKeyNotFound", err)
+	}
+	checkKept(t, db, s, id, sha, true)
+}
@@ -1,7 +1,7 @@
 package handlers
 
 import (
-	"fmt"
+	"errors"
 	"net/http"
 	"regexp"
 	"strings"
@@ -11,15 +11,63 @@ import (
 )
 
 type YoutubeVideo struct {
-	ID        string    `json:"id"`
-	Title     string    `json:"title"`
-	URL       string    `json:"url"`
-	VideoID   string    `json:"video_id"`
-	Tags      []string  `json:"tags"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        string     `json:"id"`
+	Title     string     `json:"title"`
+	URL       string     `json:"url"`
+	VideoID   string     `json:"video_id"`
+	Tags      []string   `json:"tags"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Version   int64      `json:"version"`              // Increases with every write
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // When the item was moved to the trash
+	Score     float64    `json:"score,omitempty"`      // Relevance of a keyword search match
 }
 
+// youtubeSearchFields are the text fields usable as field:value in queries
+var youtubeSearchFields = []string{"title", "url", "video"}
+
+func (v *YoutubeVideo) searchText() string {
+	return v.Title + " " + v.URL + " " + strings.Join(v.Tags, " ")
+}
+
+func (v *YoutubeVideo) searchField(name string) (string, bool) {
+	switch name {
+	case "title":
+		return v.Title, true
+	case "url":
+		return v.URL, true
+	case "video":
+		return v.VideoID, true
+	}
+	return "", false
+}
+
+func (v *YoutubeVideo) searchTags() []string { return v.Tags }
+
+func (v *YoutubeVideo) searchTimes() (time.Time, time.Time) { return v.CreatedAt, v.UpdatedAt }
+
+func (v *YoutubeVideo) indexID() string { return v.ID }
+
+func (v *YoutubeVideo) indexText() (string, string, []string) {
+	return v.Title, urlSearchText(v.URL) + " " + v.VideoID, v.Tags
+}
+
+func (v *YoutubeVideo) relevance() float64 { return v.Score }
+
+func (v *YoutubeVideo) setTags(tags []string) { v.Tags = tags }
+
+func (v *YoutubeVideo) setScore(score float64) { v.Score = score }
+
+func (v *YoutubeVideo) setUpdatedAt(t time.Time) { v.UpdatedAt = t }
+
+func (v *YoutubeVideo) version() int64 { return v.Version }
+
+func (v *YoutubeVideo) setVersion(ver int64) { v.Version = ver }
+
+func (v *YoutubeVideo) setID(id string) { v.ID = id }
+
+func (v *YoutubeVideo) setDeletedAt(t *time.Time) { v.DeletedAt = t }
+
 type NewYoutubeVideoRequest struct {
 	Title string   `json:"title"`
 	URL   string   `json:"url"`
@@ -27,9 +75,18 @@ type NewYoutubeVideoRequest struct {
 }
 
 type EditYoutubeVideoRequest struct {
-	Title string   `json:"title"`
-	URL   string   `json:"url"`
-	Tags  []string `json:"tags"`
+	Title   string   `json:"title"`
+	URL     string   `json:"url"`
+	Tags    []string `json:"tags"`
+	Version int64    `json:"version,omitempty"` // Version being replaced; 409 Conflict if stale
+}
+
+type PatchYoutubeVideoRequest struct {
+	Title   *string  `json:"title,omitempty"`
+	URL     *string  `json:"url,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	Version *int64   `json:"version,omitempty"` // Version being patched; 409 Conflict if stale
+	TagOperations
 }
 
 type YoutubeVideoResponse struct {
@@ -39,15 +96,18 @@ type YoutubeVideoResponse struct {
 }
 
 type YoutubeVideosListResponse struct {
-	Success bool           `json:"success"`
-	Message string         `json:"message"`
-	Data    []YoutubeVideo `json:"data,omitempty"`
-	Count   int            `json:"count"`
+	Success    bool           `json:"success"`
+	Message    string         `json:"message"`
+	Data       []YoutubeVideo `json:"data,omitempty"`
+	Count      int            `json:"count"`
+	Total      int            `json:"total"`                 // Matches across all pages
+	NextCursor string         `json:"next_cursor,omitempty"` // Cursor of the next page, empty on the last page
 }
 
 type DeleteYoutubeVideoResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
+	Success bool          `json:"success"`
+	Message string        `json:"message"`
+	Data    *YoutubeVideo `json:"data,omitempty"` // Server copy when the delete was refused as stale
 }
 
 type YoutubeTagsResponse struct {
@@ -57,8 +117,18 @@ type YoutubeTagsResponse struct {
 	Count   int      `json:"count"`
 }
 
+// newYoutubeStore returns the repository holding YouTube videos
+func newYoutubeStore(db *badger.DB) *store[YoutubeVideo, *YoutubeVideo] {
+	return newStore[YoutubeVideo](db, storeConfig{
+		Kind:   "youtube",
+		Prefix: youtubeKeyPrefix,
+		Fields: youtubeSearchFields,
+	})
+}
+
 type YoutubeHandler struct {
-	db *badger.DB
+	db    *badger.DB
+	store *store[YoutubeVideo, *YoutubeVideo]
 }
 
 // extractYouTubeVideoID extracts the video ID from various YouTube URL formats
@@ -85,132 +155,15 @@ func isValidYouTubeURL(url string) bool {
 }
 
 func NewYoutubeHandler(db *badger.DB) *YoutubeHandler {
-	handler := &YoutubeHandler{db: db}
+	handler := &YoutubeHandler{db: db, store: newYoutubeStore(db)}
 
-	// Initialize tag counts if they don't exist
-	handler.initializeYoutubeTagCounts()
+	// Build tag counts and the search index if they don't exist
+	handler.store.initialize()
 
 	return handler
 }
 
-// initializeYoutubeTagCounts creates the youtube_tag_counts key if it doesn't exist
-func (h *YoutubeHandler) initializeYoutubeTagCounts() error {
-	return h.db.View(func(txn *badger.Txn) error {
-		// Check if youtube_tag_counts already exists
-		_, err := txn.Get([]byte("youtube_tag_counts"))
-		if err == badger.ErrKeyNotFound {
-			// youtube_tag_counts doesn't exist, rebuild it
-			return h.rebuildYoutubeTagCounts()
-		}
-		return err
-	})
-}
-
-// updateYoutubeTagCounts maintains tag counts for efficient retrieval
-func (h *YoutubeHandler) updateYoutubeTagCounts(oldTags, newTags []string) error {
-	return h.db.Update(func(txn *badger.Txn) error {
-		// Get existing tag counts
-		tagCounts := make(map[string]int)
-
-		item, err := txn.Get([]byte("youtube_tag_counts"))
-		if err != nil && err != badger.ErrKeyNotFound {
-			return err
-		}
-
-		if err != badger.ErrKeyNotFound {
-			err = item.Value(func(val []byte) error {
-				return json.Unmarshal(val, &tagCounts)
-			})
-			if err != nil {
-				return err
-			}
-		}
-
-		// Decrease counts for old tags
-		for _, tag := range oldTags {
-			if tag != "" {
-				if count, exists := tagCounts[tag]; exists {
-					if count <= 1 {
-						delete(tagCounts, tag)
-					} else {
-						tagCounts[tag] = count - 1
-					}
-				}
-			}
-		}
-
-		// Increase counts for new tags
-		for _, tag := range newTags {
-			if tag != "" {
-				tagCounts[tag]++
-			}
-		}
-
-		// Serialize and save
-		countsJSON, err := json.Marshal(tagCounts)
-		if err != nil {
-			return err
-		}
-
-		return txn.Set([]byte("youtube_tag_counts"), countsJSON)
-	})
-}
-
-// rebuildYoutubeTagCounts rebuilds the youtube_tag_counts key by scanning all existing videos
-func (h *YoutubeHandler) rebuildYoutubeTagCounts() error {
-	return h.db.Update(func(txn *badger.Txn) error {
-		// Get all tags and their counts from existing youtube videos
-		tagCounts := make(map[string]int)
-
-		opts := badger.DefaultIteratorOptions
-		opts.PrefetchSize = 50
-		it := txn.NewIterator(opts)
-		defer it.Close()
-
-		for it.Rewind(); it.Valid(); it.Next() {
-			item := it.Item()
-			key := item.Key()
-
-			// Only process keys that start with "youtube_" and are video IDs (not tag counts)
-			keyStr := string(key)
-			if len(keyStr) >= 8 && strings.HasPrefix(keyStr, "youtube_") && keyStr != "youtube_tag_counts" {
-				err := item.Value(func(val []byte) error {
-					var video YoutubeVideo
-					if err := json.Unmarshal(val, &video); err != nil {
-						// Skip invalid JSON entries
-						return nil
-					}
-					// Count all tags from this video
-					for _, tag := range video.Tags {
-						if tag != "" {
-							tagCounts[tag]++
-						}
-					}
-					return nil
-				})
-				if err != nil {
-					return err
-				}
-			}
-		}
-
-		// Serialize and save
-		countsJSON, err := json.Marshal(tagCounts)
-		if err != nil {
-			return err
-		}
-
-		return txn.Set([]byte("youtube_tag_counts"), countsJSON)
-	})
-}
-
 func (h *YoutubeHandler) NewYoutubeVideo(w http.ResponseWriter, r *http.Request) {
-	// Only allow POST requests
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Set content type to JSON
 	w.Header().Set("Content-Type", "application/json")
 
@@ -255,51 +208,21 @@ func (h *YoutubeHandler) NewYoutubeVideo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Initialize tags if nil
-	if req.Tags == nil {
-		req.Tags = []string{}
-	}
-	// Normalize tags via aliases (youtube)
-	aliasHandler := NewTagAliasHandler(h.db)
-	_ = h.db.View(func(txn *badger.Txn) error {
-		aliases, err := aliasHandler.getAliasMap(txn, "youtube")
-		if err == nil {
-			req.Tags = normalizeTags(req.Tags, aliases)
-		}
-		return nil
-	})
-
-	// Generate unique ID
+	// The store assigns the ID when it saves the item
 	now := time.Now()
-	videoIDKey := fmt.Sprintf("youtube_%d", now.UnixNano())
 
-	// Create youtube video object
+	// Create youtube video object with tags normalized via aliases
 	video := YoutubeVideo{
-		ID:        videoIDKey,
 		Title:     req.Title,
 		URL:       req.URL,
 		VideoID:   videoID,
-		Tags:      req.Tags,
+		Tags:      h.store.normalizeTags(req.Tags),
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
 
-	// Serialize video to JSON for storage
-	videoJSON, err := json.Marshal(video)
-	if err != nil {
-		response := YoutubeVideoResponse{
-			Success: false,
-			Message: "Error serializing video data",
-		}
-		writeJSONResponse(w, http.StatusInternalServerError, response)
-		return
-	}
-
 	// Store in BadgerDB
-	err = h.db.Update(func(txn *badger.Txn) error {
-		return txn.Set([]byte(videoIDKey), videoJSON)
-	})
-	if err != nil {
+	if err := h.store.create(&video); err != nil {
 		response := YoutubeVideoResponse{
 			Success: false,
 			Message: "Error saving video to database",
@@ -308,12 +231,6 @@ func (h *YoutubeHandler) NewYoutubeVideo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Update the tag counts
-	if err := h.updateYoutubeTagCounts([]string{}, video.Tags); err != nil {
-		// Log error but don't fail the request since video was saved
-		fmt.Printf("Warning: Failed to update YouTube tag counts: %v\n", err)
-	}
-
 	// Return success response
 	response := YoutubeVideoResponse{
 		Success: true,
@@ -321,207 +238,28 @@ func (h *YoutubeHandler) NewYoutubeVideo(w http.ResponseWriter, r *http.Request)
 		Data:    video,
 	}
 
+	w.Header().Set("ETag", itemETag(video.Version))
 	writeJSONResponse(w, http.StatusCreated, response)
 }
 
 func (h *YoutubeHandler) GetYoutubeVideos(w http.ResponseWriter, r *http.Request) {
-	// Only allow GET requests
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Set content type to JSON
 	w.Header().Set("Content-Type", "application/json")
 
-	// Parse query parameters for tag filtering and keyword search
-	queryTags := r.URL.Query().Get("tags")
-	queryExcludeTags := r.URL.Query().Get("exclude_tags")
-	advancedExpression := strings.TrimSpace(r.URL.Query().Get("advanced"))
-	keywords := strings.TrimSpace(r.URL.Query().Get("keywords"))
-	var filterTags []string
-	var excludeTags []string
-
-	// Load alias map once
-	aliasHandler := NewTagAliasHandler(h.db)
-	var aliasMap map[string]string
-	_ = h.db.View(func(txn *badger.Txn) error {
-		m, err := aliasHandler.getAliasMap(txn, "youtube")
-		if err == nil {
-			aliasMap = m
-		}
-		return nil
-	})
-
-	if queryTags != "" {
-		// Split tags by comma and trim whitespace
-		for _, tag := range strings.Split(queryTags, ",") {
-			trimmed := strings.TrimSpace(tag)
-			if trimmed != "" {
-				filterTags = append(filterTags, trimmed)
-			}
-		}
-	}
-
-	if queryExcludeTags != "" {
-		// Split exclude tags by comma and trim whitespace
-		for _, tag := range strings.Split(queryExcludeTags, ",") {
-			trimmed := strings.TrimSpace(tag)
-			if trimmed != "" {
-				excludeTags = append(excludeTags, trimmed)
-			}
+	// Parse tag filters, keyword search and paging parameters
+	opts, err := h.store.parseListOptions(r.URL.Query())
+	if err != nil {
+		response := YoutubeVideosListResponse{
+			Success: false,
+			Message: err.Error(),
+			Data:    []YoutubeVideo{},
+			Count:   0,
 		}
+		writeJSONResponse(w, http.StatusBadRequest, response)
+		return
 	}
 
-	// Normalize filter tags, exclude tags and expression
-	if len(filterTags) > 0 && aliasMap != nil {
-		filterTags = normalizeTags(filterTags, aliasMap)
-	}
-	if len(excludeTags) > 0 && aliasMap != nil {
-		excludeTags = normalizeTags(excludeTags, aliasMap)
-	}
-	if advancedExpression != "" && aliasMap != nil {
-		advancedExpression = normalizeExpression(advancedExpression, aliasMap)
-	}
-
-	var videos []YoutubeVideo
-
-	// Pre-allocate slice with estimated capacity to reduce allocations
-	videos = make([]YoutubeVideo, 0, 100)
-
-	// Read all youtube videos from BadgerDB
-	err := h.db.View(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions
-		opts.PrefetchSize = 50
-		it := txn.NewIterator(opts)
-		defer it.Close()
-
-		for it.Rewind(); it.Valid(); it.Next() {
-			item := it.Item()
-			key := item.Key()
-
-			// Only process keys that start with "youtube_" and are video IDs (not tag counts)
-			keyStr := string(key)
-			if len(keyStr) >= 8 && strings.HasPrefix(keyStr, "youtube_") && keyStr != "youtube_tag_counts" {
-				err := item.Value(func(val []byte) error {
-					var video YoutubeVideo
-					if err := json.Unmarshal(val, &video); err != nil {
-						// Skip invalid JSON entries
-						return nil
-					}
-					// Normalize tags for search/UI
-					if aliasMap != nil && len(video.Tags) > 0 {
-						video.Tags = normalizeTags(video.Tags, aliasMap)
-					}
-
-					// Skip empty videos (videos with empty ID, title, or URL)
-					if video.ID == "" || video.Title == "" || video.URL == "" {
-						return nil
-					}
-
-					// Apply tag filtering based on mode
-					if advancedExpression != "" {
-						// Use advanced expression evaluation
-						if !evaluateTagExpression(video.Tags, advancedExpression) {
-							return nil
-						}
-					} else if len(filterTags) > 0 {
-						// Apply include tag filtering if filter tags are specified
-						hasAnyTag := false
-						for _, filterTag := range filterTags {
-							for _, videoTag := range video.Tags {
-								if videoTag == filterTag {
-									hasAnyTag = true
-									break
-								}
-							}
-							if hasAnyTag {
-								break
-							}
-						}
-						// Only include video if it has any of the required tags
-						if !hasAnyTag {
-							return nil
-						}
-					} else if len(excludeTags) > 0 {
-						// Apply exclude tag filtering if exclude tags are specified
-						hasExcludedTag := false
-						for _, excludeTag := range excludeTags {
-							for _, videoTag := range video.Tags {
-								if videoTag == excludeTag {
-									hasExcludedTag = true
-									break
-								}
-							}
-							if hasExcludedTag {
-								break
-							}
-						}
-						// Exclude video if it has any of the excluded tags
-						if hasExcludedTag {
-							return nil
-						}
-					}
-
-					// Apply keyword search if keywords are specified
-					if keywords != "" {
-						// Split keywords into individual words and normalize
-						keywordWords := strings.Fields(strings.ToLower(keywords))
-						if len(keywordWords) > 0 {
-							// Create searchable text by combining title, URL, and tags
-							searchableText := strings.ToLower(video.Title + " " + video.URL + " " + strings.Join(video.Tags, " "))
-
-							// Separate include and exclude words
-							var includeWords []string
-							var excludeWords []string
-
-							for _, word := range keywordWords {
-								if strings.HasPrefix(word, "-") && len(word) > 1 {
-									// Remove the "-" prefix and add to exclude list
-									excludeWords = append(excludeWords, word[1:])
-								} else {
-									// Add to include list
-									includeWords = append(includeWords, word)
-								}
-							}
-
-							// Check if any exclude words are present
-							for _, excludeWord := range excludeWords {
-								if strings.Contains(searchableText, excludeWord) {
-									// Exclude this video if it contains any exclude word
-									return nil
-								}
-							}
-
-							// Check if all include words are present (only if there are include words)
-							if len(includeWords) > 0 {
-								allIncludeWordsMatch := true
-								for _, word := range includeWords {
-									if !strings.Contains(searchableText, word) {
-										allIncludeWordsMatch = false
-										break
-									}
-								}
-
-								// Only include video if all include words are found
-								if !allIncludeWordsMatch {
-									return nil
-								}
-							}
-						}
-					}
-
-					videos = append(videos, video)
-					return nil
-				})
-				if err != nil {
-					return err
-				}
-			}
-		}
-		return nil
-	})
-
+	result, err := h.store.list(opts)
 	if err != nil {
 		response := YoutubeVideosListResponse{
 			Success: false,
@@ -535,76 +273,73 @@ func (h *YoutubeHandler) GetYoutubeVideos(w http.ResponseWriter, r *http.Request
 
 	// Return success response
 	response := YoutubeVideosListResponse{
-		Success: true,
-		Message: "YouTube videos retrieved successfully",
-		Data:    videos,
-		Count:   len(videos),
+		Success:    true,
+		Message:    "YouTube videos retrieved successfully",
+		Data:       result.Items,
+		Count:      len(result.Items),
+		Total:      result.Total,
+		NextCursor: result.NextCursor,
 	}
 
 	writeJSONResponse(w, http.StatusOK, response)
 }
 
-func (h *YoutubeHandler) GetYoutubeTags(w http.ResponseWriter, r *http.Request) {
-	// Only allow GET requests
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
+func (h *YoutubeHandler) GetYoutubeVideo(w http.ResponseWriter, r *http.Request) {
 	// Set content type to JSON
 	w.Header().Set("Content-Type", "application/json")
 
-	var tags []string
+	// Get video ID from the {id} path segment
+	videoID := r.PathValue("id")
 
-	// Load alias map
-	aliasHandler := NewTagAliasHandler(h.db)
-	var aliasMap map[string]string
-	_ = h.db.View(func(txn *badger.Txn) error {
-		m, err := aliasHandler.getAliasMap(txn, "youtube")
-		if err == nil {
-			aliasMap = m
+	if videoID == "" {
+		response := YoutubeVideoResponse{
+			Success: false,
+			Message: "Video ID is required",
 		}
-		return nil
-	})
+		writeJSONResponse(w, http.StatusBadRequest, response)
+		return
+	}
 
-	// Read tag counts from BadgerDB
-	err := h.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte("youtube_tag_counts"))
-		if err != nil {
-			if err == badger.ErrKeyNotFound {
-				// No tags exist yet, return empty list
-				tags = []string{}
-				return nil
+	video, err := h.store.find(videoID)
+	if err != nil {
+		if err == badger.ErrKeyNotFound {
+			response := YoutubeVideoResponse{
+				Success: false,
+				Message: "YouTube video not found",
 			}
-			return err
+			writeJSONResponse(w, http.StatusNotFound, response)
+			return
 		}
 
-		return item.Value(func(val []byte) error {
-			var tagCounts map[string]int
-			if err := json.Unmarshal(val, &tagCounts); err != nil {
-				return err
-			}
-			// Merge counts using alias map
-			if len(aliasMap) > 0 {
-				merged := make(map[string]int)
-				for tag, count := range tagCounts {
-					canon := aliasMap[tag]
-					if canon == "" {
-						canon = tag
-					}
-					merged[canon] += count
-				}
-				tagCounts = merged
-			}
-			// Convert to "tag,{count}" format
-			tags = make([]string, 0, len(tagCounts))
-			for tag, count := range tagCounts {
-				tags = append(tags, fmt.Sprintf("%s,%d", tag, count))
-			}
-			return nil
-		})
-	})
+		response := YoutubeVideoResponse{
+			Success: false,
+			Message: "Error reading YouTube video from database",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	// Let clients revalidate their cached copy
+	if notModified(w, r, itemETag(video.Version)) {
+		return
+	}
+
+	// Return success response
+	response := YoutubeVideoResponse{
+		Success: true,
+		Message: "YouTube video retrieved successfully",
+		Data:    video,
+	}
+
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+func (h *YoutubeHandler) GetYoutubeTags(w http.ResponseWriter, r *http.Request) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
 
+	// Read tag counts from BadgerDB
+	tags, err := h.store.tagList()
 	if err != nil {
 		response := YoutubeTagsResponse{
 			Success: false,
@@ -616,11 +351,6 @@ func (h *YoutubeHandler) GetYoutubeTags(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Initialize empty slice if nil
-	if tags == nil {
-		tags = []string{}
-	}
-
 	// Return success response
 	response := YoutubeTagsResponse{
 		Success: true,
@@ -633,17 +363,11 @@ func (h *YoutubeHandler) GetYoutubeTags(w http.ResponseWriter, r *http.Request)
 }
 
 func (h *YoutubeHandler) DeleteYoutubeVideo(w http.ResponseWriter, r *http.Request) {
-	// Only allow DELETE requests
-	if r.Method != http.MethodDelete {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Set content type to JSON
 	w.Header().Set("Content-Type", "application/json")
 
-	// Get video ID from URL path
-	videoID := r.URL.Path[len("/api/youtube/delete/"):]
+	// Get video ID from the {id} path segment
+	videoID := r.PathValue("id")
 
 	if videoID == "" {
 		response := DeleteYoutubeVideoResponse{
@@ -654,25 +378,19 @@ func (h *YoutubeHandler) DeleteYoutubeVideo(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Get the video first to retrieve its tags for count updates
-	var deletedTags []string
-	err := h.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte(videoID))
-		if err != nil {
-			return err
-		}
-
-		return item.Value(func(val []byte) error {
-			var video YoutubeVideo
-			if err := json.Unmarshal(val, &video); err != nil {
-				return err
+	// Delete the video
+	if err := h.store.delete(videoID, requestPrecondition(r)); err != nil {
+		if stale, ok := asStale[YoutubeVideo](err); ok {
+			w.Header().Set("ETag", itemETag(stale.current.Version))
+			response := DeleteYoutubeVideoResponse{
+				Success: false,
+				Message: "YouTube video was changed by another request",
+				Data:    &stale.current,
 			}
-			deletedTags = video.Tags
-			return nil
-		})
-	})
+			writeJSONResponse(w, stale.status, response)
+			return
+		}
 
-	if err != nil {
 		if err == badger.ErrKeyNotFound {
 			response := DeleteYoutubeVideoResponse{
 				Success: false,
@@ -682,20 +400,6 @@ func (h *YoutubeHandler) DeleteYoutubeVideo(w http.ResponseWriter, r *http.Reque
 			return
 		}
 
-		response := DeleteYoutubeVideoResponse{
-			Success: false,
-			Message: "Error reading YouTube video from database",
-		}
-		writeJSONResponse(w, http.StatusInternalServerError, response)
-		return
-	}
-
-	// Delete the video
-	err = h.db.Update(func(txn *badger.Txn) error {
-		return txn.Delete([]byte(videoID))
-	})
-
-	if err != nil {
 		response := DeleteYoutubeVideoResponse{
 			Success: false,
 			Message: "Error deleting YouTube video from database",
@@ -704,33 +408,21 @@ func (h *YoutubeHandler) DeleteYoutubeVideo(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Update tag counts by removing the deleted video's tags
-	if err := h.updateYoutubeTagCounts(deletedTags, []string{}); err != nil {
-		// Log error but don't fail the request since video was deleted
-		fmt.Printf("Warning: Failed to update YouTube tag counts: %v\n", err)
-	}
-
 	// Return success response
 	response := DeleteYoutubeVideoResponse{
 		Success: true,
-		Message: "YouTube video deleted successfully",
+		Message: "YouTube video moved to trash",
 	}
 
 	writeJSONResponse(w, http.StatusOK, response)
 }
 
 func (h *YoutubeHandler) EditYoutubeVideo(w http.ResponseWriter, r *http.Request) {
-	// Only allow PUT requests
-	if r.Method != http.MethodPut {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Set content type to JSON
 	w.Header().Set("Content-Type", "application/json")
 
-	// Get video ID from URL path
-	videoID := r.URL.Path[len("/api/youtube/edit/"):]
+	// Get video ID from the {id} path segment
+	videoID := r.PathValue("id")
 
 	if videoID == "" {
 		response := YoutubeVideoResponse{
@@ -782,64 +474,119 @@ func (h *YoutubeHandler) EditYoutubeVideo(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Initialize tags if nil
-	if req.Tags == nil {
-		req.Tags = []string{}
-	}
 	// Normalize requested tags via aliases
-	aliasHandler := NewTagAliasHandler(h.db)
-	_ = h.db.View(func(txn *badger.Txn) error {
-		aliases, err := aliasHandler.getAliasMap(txn, "youtube")
-		if err == nil {
-			req.Tags = normalizeTags(req.Tags, aliases)
-		}
-		return nil
-	})
+	tags := h.store.normalizeTags(req.Tags)
 
-	var updatedVideo YoutubeVideo
-	var oldTags []string
+	// Honor If-Match and the version the client loaded
+	pre := requestPrecondition(r)
+	pre.version = req.Version
 
 	// Update video in BadgerDB
-	err := h.db.Update(func(txn *badger.Txn) error {
-		// First get the existing video
-		item, err := txn.Get([]byte(videoID))
-		if err != nil {
-			return err
+	updatedVideo, err := h.store.update(videoID, pre, func(existing YoutubeVideo) (YoutubeVideo, error) {
+		return YoutubeVideo{
+			ID:        existing.ID,
+			Title:     req.Title,
+			URL:       req.URL,
+			VideoID:   youtubeVideoID,
+			Tags:      tags,
+			CreatedAt: existing.CreatedAt, // Keep original creation time
+			UpdatedAt: time.Now(),         // Update the modification time
+		}, nil
+	})
+
+	if err != nil {
+		if stale, ok := asStale[YoutubeVideo](err); ok {
+			w.Header().Set("ETag", itemETag(stale.current.Version))
+			response := YoutubeVideoResponse{
+				Success: false,
+				Message: "YouTube video was changed by another request",
+				Data:    stale.current,
+			}
+			writeJSONResponse(w, stale.status, response)
+			return
 		}
 
-		var existingVideo YoutubeVideo
-		err = item.Value(func(val []byte) error {
-			return json.Unmarshal(val, &existingVideo)
-		})
-		if err != nil {
-			return err
+		if err == badger.ErrKeyNotFound {
+			response := YoutubeVideoResponse{
+				Success: false,
+				Message: "YouTube video not found",
+			}
+			writeJSONResponse(w, http.StatusNotFound, response)
+			return
 		}
 
-		// Store old tags for count update
-		oldTags = existingVideo.Tags
+		response := YoutubeVideoResponse{
+			Success: false,
+			Message: "Error updating YouTube video in database",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
 
-		// Update the video with new values
-		updatedVideo = YoutubeVideo{
-			ID:        existingVideo.ID,
-			Title:     req.Title,
-			URL:       req.URL,
-			VideoID:   youtubeVideoID,
-			Tags:      req.Tags,
-			CreatedAt: existingVideo.CreatedAt, // Keep original creation time
-			UpdatedAt: time.Now(),              // Update the modification time
+	// Return success response
+	response := YoutubeVideoResponse{
+		Success: true,
+		Message: "YouTube video updated successfully",
+		Data:    updatedVideo,
+	}
+
+	w.Header().Set("ETag", itemETag(updatedVideo.Version))
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// PatchYoutubeVideo applies a JSON Merge Patch with optional add_tags/remove_tags to a YouTube video
+func (h *YoutubeHandler) PatchYoutubeVideo(w http.ResponseWriter, r *http.Request) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get YouTube video ID from the {id} path segment
+	videoID := r.PathValue("id")
+
+	if videoID == "" {
+		response := YoutubeVideoResponse{
+			Success: false,
+			Message: "Video ID is required",
 		}
+		writeJSONResponse(w, http.StatusBadRequest, response)
+		return
+	}
 
-		// Serialize updated video to JSON
-		videoJSON, err := json.Marshal(updatedVideo)
-		if err != nil {
-			return err
+	// Parse the patch document
+	patch, err := parseItemPatch(r)
+	if err != nil {
+		response := YoutubeVideoResponse{
+			Success: false,
+			Message: err.Error(),
 		}
+		writeJSONResponse(w, http.StatusBadRequest, response)
+		return
+	}
 
-		// Save updated video
-		return txn.Set([]byte(videoID), videoJSON)
-	})
+	// Apply the patch in BadgerDB
+	updated, err := h.store.patch(videoID, requestPrecondition(r), patch, validateYoutubePatch)
 
 	if err != nil {
+		var perr *patchError
+		if errors.As(err, &perr) {
+			response := YoutubeVideoResponse{
+				Success: false,
+				Message: perr.msg,
+			}
+			writeJSONResponse(w, http.StatusBadRequest, response)
+			return
+		}
+
+		if stale, ok := asStale[YoutubeVideo](err); ok {
+			w.Header().Set("ETag", itemETag(stale.current.Version))
+			response := YoutubeVideoResponse{
+				Success: false,
+				Message: "YouTube video was changed by another request",
+				Data:    stale.current,
+			}
+			writeJSONResponse(w, stale.status, response)
+			return
+		}
+
 		if err == badger.ErrKeyNotFound {
 			response := YoutubeVideoResponse{
 				Success: false,
@@ -857,17 +604,172 @@ func (h *YoutubeHandler) EditYoutubeVideo(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Update the tag counts with old and new tags
-	if err := h.updateYoutubeTagCounts(oldTags, updatedVideo.Tags); err != nil {
-		// Log error but don't fail the request since video was updated
-		fmt.Printf("Warning: Failed to update YouTube tag counts: %v\n", err)
+	// Return success response
+	response := YoutubeVideoResponse{
+		Success: true,
+		Message: "YouTube video updated successfully",
+		Data:    updated,
+	}
+
+	w.Header().Set("ETag", itemETag(updated.Version))
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// validateYoutubePatch checks a patched video like EditYoutubeVideo checks its
+// request and re-derives the video ID from the URL
+func validateYoutubePatch(v *YoutubeVideo) error {
+	if v.Title == "" {
+		return &patchError{"Title is required"}
+	}
+	if v.URL == "" {
+		return &patchError{"URL is required"}
+	}
+	v.VideoID = extractYouTubeVideoID(v.URL)
+	if v.VideoID == "" {
+		return &patchError{"Invalid YouTube URL. Please provide a valid YouTube video URL."}
+	}
+	return nil
+}
+
+// BulkYoutubeVideos applies a list of delete, tag and set operations to many YouTube videos at once
+func (h *YoutubeHandler) BulkYoutubeVideos(w http.ResponseWriter, r *http.Request) {
+	handleBulk(w, r, h.store, validateYoutubePatch)
+}
+
+// GetYoutubeBacklinks lists the items linking to a YouTube video
+func (h *YoutubeHandler) GetYoutubeBacklinks(w http.ResponseWriter, r *http.Request) {
+	handleBacklinks(w, r, h.store, "YouTube video not found")
+}
+
+func (h *YoutubeHandler) GetYoutubeTrash(w http.ResponseWriter, r *http.Request) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	// Load trashed YouTube videos, most recently deleted first
+	items, err := h.store.trashed()
+	if err != nil {
+		response := YoutubeVideosListResponse{
+			Success: false,
+			Message: "Error reading trash from database",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	// Return success response
+	response := YoutubeVideosListResponse{
+		Success: true,
+		Message: "Trashed YouTube videos retrieved successfully",
+		Data:    items,
+		Count:   len(items),
+		Total:   len(items),
+	}
+
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+func (h *YoutubeHandler) RestoreYoutubeVideo(w http.ResponseWriter, r *http.Request) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get YouTube video ID from the {id} path segment
+	videoID := r.PathValue("id")
+
+	// Move the YouTube video back out of the trash
+	restored, err := h.store.restore(videoID)
+	if err != nil {
+		if err == badger.ErrKeyNotFound {
+			response := YoutubeVideoResponse{
+				Success: false,
+				Message: "YouTube video not found in trash",
+			}
+			writeJSONResponse(w, http.StatusNotFound, response)
+			return
+		}
+
+		if err == errRestoreConflict {
+			response := YoutubeVideoResponse{
+				Success: false,
+				Message: "A YouTube video with this ID already exists",
+			}
+			writeJSONResponse(w, http.StatusConflict, response)
+			return
+		}
+
+		response := YoutubeVideoResponse{
+			Success: false,
+			Message: "Error restoring YouTube video in database",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
 	}
 
 	// Return success response
 	response := YoutubeVideoResponse{
 		Success: true,
-		Message: "YouTube video updated successfully",
-		Data:    updatedVideo,
+		Message: "YouTube video restored successfully",
+		Data:    restored,
+	}
+
+	w.Header().Set("ETag", itemETag(restored.Version))
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+func (h *YoutubeHandler) PurgeYoutubeVideo(w http.ResponseWriter, r *http.Request) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get YouTube video ID from the {id} path segment
+	videoID := r.PathValue("id")
+
+	// Remove the YouTube video from the trash for good
+	if err := h.store.purge(videoID); err != nil {
+		if err == badger.ErrKeyNotFound {
+			response := DeleteYoutubeVideoResponse{
+				Success: false,
+				Message: "YouTube video not found in trash",
+			}
+			writeJSONResponse(w, http.StatusNotFound, response)
+			return
+		}
+
+		response := DeleteYoutubeVideoResponse{
+			Success: false,
+			Message: "Error purging YouTube video from database",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	// Return success response
+	response := DeleteYoutubeVideoResponse{
+		Success: true,
+		Message: "YouTube video permanently deleted",
+	}
+
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+func (h *YoutubeHandler) EmptyYoutubeTrash(w http.ResponseWriter, r *http.Request) {
+	// Set content type to JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	// Purge every trashed YouTube video
+	count, err := h.store.purgeTrash(time.Time{})
+	if err != nil {
+		response := EmptyTrashResponse{
+			Success: false,
+			Message: "Error emptying trash",
+		}
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	// Return success response
+	response := EmptyTrashResponse{
+		Success: true,
+		Message: "Trash emptied successfully",
+		Count:   count,
 	}
 
 	writeJSONResponse(w, http.StatusOK, response)
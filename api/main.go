@@ -1,14 +1,22 @@
 package main
 
 import (
+	"bufio"
 	"compress/gzip"
+	"context"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"mon-api/handlers"
 
@@ -46,7 +54,7 @@ func gzipMiddleware(next http.HandlerFunc) http.HandlerFunc {
 
 		// Set response headers
 		w.Header().Set("Content-Encoding", "gzip")
-		w.Header().Set("Vary", "Accept-Encoding")
+		w.Header().Add("Vary", "Accept-Encoding")
 
 		// Create a wrapper that implements http.ResponseWriter
 		gzipResponseWriter := &gzipResponseWriterWrapper{
@@ -73,18 +81,42 @@ func (w *gzipResponseWriterWrapper) WriteHeader(statusCode int) {
 	w.ResponseWriter.WriteHeader(statusCode)
 }
 
-// CORS middleware with gzip compression
-func corsGzipMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return gzipMiddleware(corsMiddleware(next))
+// apiCORS applies CORS handling to API requests before they are routed, so
+// preflight OPTIONS requests are answered without an OPTIONS route
+func apiCORS(mux *http.ServeMux, origins []string) http.HandlerFunc {
+	withCORS := corsMiddleware(mux.ServeHTTP, origins)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			withCORS(w, r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}
 }
 
-// CORS middleware
-func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
+// CORS middleware allowing the configured origins. Listed origins may send
+// the session cookie; "*" allows any origin but never with credentials, so
+// other sites can't act with a logged-in browser's session.
+func corsMiddleware(next http.HandlerFunc, origins []string) http.HandlerFunc {
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		allowed[strings.TrimSuffix(origin, "/")] = true
+	}
+
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Set CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		// Set CORS headers for allowed origins only
+		if allowed["*"] {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Add("Vary", "Origin")
+			if origin := r.Header.Get("Origin"); allowed[origin] {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token, If-Match, If-None-Match, Range, If-Range")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Content-Range, Content-Disposition")
 
 		// Handle preflight requests
 		if r.Method == "OPTIONS" {
@@ -97,6 +129,41 @@ func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// statusRecorder remembers the status code a handler sent
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// requestLogger prints one line per request at the debug log level
+func requestLogger(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if handlers.Level > handlers.LevelDebug {
+			next(w, r)
+			return
+		}
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+		handlers.Debugf("%s %s %d %s", r.Method, r.URL.RequestURI(), rec.status, time.Since(start).Round(time.Microsecond))
+	}
+}
+
+// trackRequests counts running handlers in inFlight, so shutdown can wait for
+// them even after their connections are closed
+func trackRequests(inFlight *sync.WaitGroup, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inFlight.Add(1)
+		defer inFlight.Done()
+		next(w, r)
+	}
+}
+
 // Static file handler that serves the React app with gzip compression and cache headers
 func staticFileHandler(distDir string) http.HandlerFunc {
 	return gzipMiddleware(func(w http.ResponseWriter, r *http.Request) {
@@ -149,20 +216,83 @@ func setCacheHeaders(w http.ResponseWriter, path string) {
 }
 
 func main() {
+	cfg, sources, act, err := loadConfig(os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	}
+	if err == errFlagsReported {
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	if act.printConfig {
+		printConfig(os.Stdout, &cfg, sources)
+		return
+	}
+
+	handlers.Level, _ = handlers.ParseLogLevel(cfg.LogLevel)
+	handlers.NoteRevisionLimit = cfg.NoteRevisions
+	handlers.MaxBlobSize = cfg.MaxBlobSize
+	handlers.BlobDir = cfg.blobDir()
+	handlers.SessionTTL = cfg.Auth.SessionTTL
+	handlers.SecureCookies = cfg.Auth.SecureCookies
+	handlers.TrustedOrigins = cfg.CORSOrigins
+
 	// Initialize BadgerDB
-	dbPath := "./data/bookmarks"
-	if err := os.MkdirAll(dbPath, 0755); err != nil {
+	if err := os.MkdirAll(cfg.dbPath(), 0755); err != nil {
 		log.Fatal("Failed to create database directory:", err)
 	}
 
-	opts := badger.DefaultOptions(dbPath)
-	opts.Logger = nil // Disable default logger to reduce noise
-
-	db, err := badger.Open(opts)
+	db, err := badger.Open(cfg.badgerOptions())
 	if err != nil {
 		log.Fatal("Failed to open database:", err)
 	}
-	defer db.Close()
+
+	// Move databases from the original flat key layout to per-type namespaces
+	if err := handlers.MigrateStorage(db); err != nil {
+		log.Fatal("Failed to migrate database:", err)
+	}
+
+	// Reset the password from the command line, e.g. when it is forgotten
+	if act.setPassword {
+		err := setPasswordFromStdin(db)
+		db.Close()
+		if err != nil {
+			log.Fatal("Failed to set password: ", err)
+		}
+		fmt.Println("Password set; every session has been logged out")
+		return
+	}
+	if set, err := handlers.PasswordSet(db); err == nil && !set {
+		handlers.Warnf("no password is set. Open the app to choose one, or run with -set-password.")
+	}
+
+	// Stop on Ctrl-C or SIGTERM; background jobs end when ctx is cancelled
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var background sync.WaitGroup
+	runInBackground := func(job func()) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			job()
+		}()
+	}
+
+	// Empty old items from the trash in the background
+	runInBackground(func() { handlers.PurgeTrashPeriodically(ctx, db, cfg.TrashRetention) })
+
+	// Delete attachment blobs that nothing refers to any more
+	runInBackground(func() { handlers.SweepBlobsPeriodically(ctx, db) })
+
+	// Fold the search statistics changes of recent writes together
+	runInBackground(func() { handlers.CompactSearchStatsPeriodically(ctx, db) })
+
+	// Reclaim the space of overwritten and deleted values
+	runInBackground(func() {
+		handlers.CollectGarbagePeriodically(ctx, db, cfg.Badger.GCInterval, cfg.Badger.GCDiscardRatio)
+	})
 
 	// Initialize handlers
 	bookmarkHandler := handlers.NewBookmarkHandler(db)
@@ -170,42 +300,20 @@ func main() {
 	youtubeHandler := handlers.NewYoutubeHandler(db)
 	importExportHandler := handlers.NewImportExportHandler(db)
 	tagAliasHandler := handlers.NewTagAliasHandler(db)
+	blobHandler := handlers.NewBlobHandler(db)
+	authHandler := handlers.NewAuthHandler(db)
 
-	// Register bookmark API routes with CORS and gzip middleware
-	http.HandleFunc("/api/bookmark/create", corsGzipMiddleware(bookmarkHandler.NewBookmark))
-	http.HandleFunc("/api/bookmark/list", corsGzipMiddleware(bookmarkHandler.GetBookmarks))
-	http.HandleFunc("/api/bookmark/tag/list", corsGzipMiddleware(bookmarkHandler.GetBookmarkTags))
-	http.HandleFunc("/api/bookmark/check-duplicates", corsGzipMiddleware(bookmarkHandler.CheckDuplicates))
-	http.HandleFunc("/api/bookmark/edit/", corsGzipMiddleware(bookmarkHandler.EditBookmark))
-	http.HandleFunc("/api/bookmark/delete/", corsGzipMiddleware(bookmarkHandler.DeleteBookmark))
-
-	// Register note API routes with CORS and gzip middleware
-	http.HandleFunc("/api/note/create", corsGzipMiddleware(noteHandler.NewNote))
-	http.HandleFunc("/api/note/list", corsGzipMiddleware(noteHandler.GetNotes))
-	http.HandleFunc("/api/note/tag/list", corsGzipMiddleware(noteHandler.GetNoteTags))
-	http.HandleFunc("/api/note/edit/", corsGzipMiddleware(noteHandler.EditNote))
-	http.HandleFunc("/api/note/delete/", corsGzipMiddleware(noteHandler.DeleteNote))
-
-	// Register YouTube API routes with CORS and gzip middleware
-	http.HandleFunc("/api/youtube/create", corsGzipMiddleware(youtubeHandler.NewYoutubeVideo))
-	http.HandleFunc("/api/youtube/list", corsGzipMiddleware(youtubeHandler.GetYoutubeVideos))
-	http.HandleFunc("/api/youtube/tag/list", corsGzipMiddleware(youtubeHandler.GetYoutubeTags))
-	http.HandleFunc("/api/youtube/edit/", corsGzipMiddleware(youtubeHandler.EditYoutubeVideo))
-	http.HandleFunc("/api/youtube/delete/", corsGzipMiddleware(youtubeHandler.DeleteYoutubeVideo))
-
-	// Register Import/Export routes
-	http.HandleFunc("/api/export/", corsGzipMiddleware(importExportHandler.ExportAll))
-	http.HandleFunc("/api/import/", corsGzipMiddleware(importExportHandler.ImportAll))
-
-	// Register Tag Alias routes
-	http.HandleFunc("/api/tag-aliases", corsGzipMiddleware(tagAliasHandler.GetAliases))
-	http.HandleFunc("/api/tag-aliases/batch", corsGzipMiddleware(tagAliasHandler.SetAliasesBatch))
-	http.HandleFunc("/api/tag-aliases/group", corsGzipMiddleware(tagAliasHandler.DeleteAlias))
-	// delete single alias via same handler (path check)
-	http.HandleFunc("/api/tag-aliases/delete", corsGzipMiddleware(tagAliasHandler.DeleteAlias))
+	// Register API routes; each handler also answers its legacy path, and
+	// all but the login routes need a session or API token
+	mux := http.NewServeMux()
+	routes := apiRoutes(bookmarkHandler, noteHandler, youtubeHandler, importExportHandler, tagAliasHandler, blobHandler, authHandler)
+	registerRoutes(mux, routes, db)
+
+	// Serve the OpenAPI description of the routes above; it is public
+	mux.HandleFunc("GET /api/v1/openapi.json", gzipMiddleware(serveOpenAPI(routes)))
 
 	// Serve robots.txt to deny all crawlers
-	http.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("GET /robots.txt", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/plain")
 		w.Header().Set("Cache-Control", "public, max-age=86400") // Cache for 1 day
 		w.WriteHeader(http.StatusOK)
@@ -213,7 +321,7 @@ func main() {
 	})
 
 	// Serve static files from the React build
-	distDir := "./dist"
+	distDir := cfg.DistDir
 	if _, err := os.Stat(distDir); err == nil {
 		// Serve static assets with gzip compression and cache headers
 		assetsHandler := http.StripPrefix("/assets/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -222,25 +330,85 @@ func main() {
 			// Serve the file
 			http.FileServer(http.Dir(filepath.Join(distDir, "assets"))).ServeHTTP(w, r)
 		}))
-		http.Handle("/assets/", gzipMiddleware(assetsHandler.ServeHTTP))
+		mux.Handle("GET /assets/", gzipMiddleware(assetsHandler.ServeHTTP))
 
-		// Serve the React app for all non-API routes
-		http.HandleFunc("/", staticFileHandler(distDir))
-		fmt.Println("📱 Serving React app from ./dist with gzip compression and cache optimization")
+		// Serve the React app for all non-API routes. The pattern is limited
+		// to GET so API paths called with the wrong method still get a 405.
+		mux.HandleFunc("GET /", staticFileHandler(distDir))
+		handlers.Infof("📱 Serving React app from %s with gzip compression and cache optimization", distDir)
 	} else {
-		fmt.Println("⚠️  React build not found. Run the build script first.")
-		http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Warnf("React build not found in %s. Run the build script first.", distDir)
+		mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusNotFound)
 			fmt.Fprintf(w, "React app not built. Please run the build script first.")
 		})
 	}
 
 	// Start the server
-	port := ":8081"
-	fmt.Printf("🚀 Server starting on port %s\n", port)
-	fmt.Printf("🌐 App available at: http://localhost%s\n", port)
+	var inFlight sync.WaitGroup
+	server := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           trackRequests(&inFlight, requestLogger(apiCORS(mux, cfg.CORSOrigins))),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.ListenAndServe() }()
 
-	if err := http.ListenAndServe(port, nil); err != nil {
+	handlers.Infof("🚀 Server starting on %s", cfg.Listen)
+	handlers.Infof("🌐 App available at: %s", appURL(cfg.Listen))
+
+	select {
+	case err := <-serveErr:
+		stop()
+		background.Wait()
+		db.Close()
 		log.Fatal("Server failed to start:", err)
+	case <-ctx.Done():
+	}
+
+	// Let a second signal kill the process right away
+	stop()
+
+	// Finish in-flight requests, then wait for the background jobs so
+	// nothing uses the database once it is closed. Closing the connections
+	// of requests that take too long doesn't stop their handlers, so those
+	// are waited for too.
+	handlers.Infof("🛑 Shutting down, waiting up to %s for requests to finish", cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		handlers.Warnf("closing connections still busy after %s: %v", cfg.ShutdownTimeout, err)
+		server.Close()
+		handlers.Infof("⏳ Waiting for running handlers to return")
+	}
+	inFlight.Wait()
+	background.Wait()
+
+	if err := db.Close(); err != nil {
+		log.Fatal("Failed to close database:", err)
+	}
+	handlers.Infof("👋 Database closed")
+}
+
+// setPasswordFromStdin reads a password line from standard input and makes
+// it the only valid one
+func setPasswordFromStdin(db *badger.DB) error {
+	fmt.Fprint(os.Stderr, "New password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return fmt.Errorf("reading password: %v", err)
+	}
+	return handlers.SetPassword(db, strings.TrimRight(line, "\r\n"))
+}
+
+// appURL is the address to open in a browser for a listen address
+func appURL(listen string) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "http://" + listen
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
 	}
+	return "http://" + net.JoinHostPort(host, port)
 }
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShutdownWaitsForHandlersAfterClose(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var finished atomic.Bool
+
+	var inFlight sync.WaitGroup
+	server := &http.Server{Handler: trackRequests(&inFlight, func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		finished.Store(true)
+	})}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(ln)
+	go http.Get("http://" + ln.Addr().String())
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(ctx); err == nil {
+		t.Fatal("Shutdown returned while a handler was running")
+	}
+	server.Close()
+
+	// The handler outlives its connection; release it a little later
+	time.AfterFunc(50*time.Millisecond, func() { close(release) })
+	inFlight.Wait()
+	if !finished.Load() {
+		t.Fatal("inFlight.Wait returned before the handler finished")
+	}
+}
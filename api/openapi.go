@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"mon-api/handlers"
+)
+
+// OpenAPI document
+//
+// The /api/v1 description is generated at startup from the route table: path
+// and query parameters come from the route fields, and request and response
+// schemas are derived by reflection from the Go structs the handlers encode,
+// so the document can't drift from the wire format.
+
+// openAPIVersion is the API version reported in the document's info block
+const openAPIVersion = "1.0.0"
+
+// pathParamPattern matches ServeMux wildcards such as {id}
+var pathParamPattern = regexp.MustCompile(`\{([^}.]+)(\.\.\.)?\}`)
+
+// schemaBuilder turns Go types into JSON schemas, collecting named structs
+// under components/schemas so they are described once and referenced by $ref
+type schemaBuilder struct {
+	schemas map[string]any
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (b *schemaBuilder) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		if _, ok := b.schemas[t.Name()]; !ok {
+			b.schemas[t.Name()] = nil // placeholder for recursive types
+			b.schemas[t.Name()] = b.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	// interface{} and anything else: any JSON value
+	return map[string]any{}
+}
+
+// object describes a struct's JSON fields. Fields without omitempty are
+// always encoded, so they are listed as required.
+func (b *schemaBuilder) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	required := []string{}
+	b.fields(t, properties, &required)
+
+	out := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		out["required"] = required
+	}
+	return out
+}
+
+func (b *schemaBuilder) fields(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		// Untagged embedded structs are flattened into the parent, as
+		// encoding/json does
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				b.fields(ft, properties, required)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		properties[name] = b.schema(f.Type)
+		if !strings.Contains(","+opts+",", ",omitempty,") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// buildOpenAPI describes the /api/v1 routes as an OpenAPI 3 document
+func buildOpenAPI(routes []route) map[string]any {
+	b := &schemaBuilder{schemas: map[string]any{}}
+	paths := map[string]any{}
+
+	for _, rt := range routes {
+		if !strings.HasPrefix(rt.Path, "/api/v1/") {
+			continue
+		}
+
+		parameters := []any{}
+		for _, m := range pathParamPattern.FindAllStringSubmatch(rt.Path, -1) {
+			parameters = append(parameters, map[string]any{
+				"name":     m[1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]any{"type": "string"},
+			})
+		}
+		for _, p := range rt.Query {
+			parameters = append(parameters, map[string]any{
+				"name":        p.Name,
+				"in":          "query",
+				"description": p.Description,
+				"schema":      map[string]any{"type": "string"},
+			})
+		}
+
+		status := rt.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		responses := map[string]any{}
+		if rt.Response != nil {
+			responses[strconv.Itoa(status)] = map[string]any{
+				"description": http.StatusText(status),
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": b.schema(reflect.TypeOf(rt.Response))},
+				},
+			}
+		} else {
+			responses[strconv.Itoa(status)] = map[string]any{"description": http.StatusText(status)}
+		}
+		responses["default"] = map[string]any{
+			"description": "Error: a {success: false, message} envelope or a plain-text message",
+		}
+
+		op := map[string]any{
+			"operationId": rt.Operation,
+			"summary":     rt.Summary,
+			"responses":   responses,
+		}
+		if rt.Tag != "" {
+			op["tags"] = []string{rt.Tag}
+		}
+		if rt.Public {
+			op["security"] = []any{}
+		}
+		if len(parameters) > 0 {
+			op["parameters"] = parameters
+		}
+		if rt.Request != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": b.schema(reflect.TypeOf(rt.Request))},
+				},
+			}
+		}
+
+		// Path templates use the same {name} syntax as ServeMux, minus "..."
+		path := pathParamPattern.ReplaceAllString(rt.Path, "{$1}")
+		item, _ := paths[path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[path] = item
+		}
+		item[strings.ToLower(rt.Method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Mon API",
+			"version": openAPIVersion,
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": b.schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer"},
+				"cookieAuth": map[string]any{"type": "apiKey", "in": "cookie", "name": handlers.SessionCookie},
+			},
+		},
+		// Either credential works; cookie-authenticated writes also need
+		// the X-CSRF-Token header
+		"security": []any{
+			map[string]any{"bearerAuth": []string{}},
+			map[string]any{"cookieAuth": []string{}},
+		},
+	}
+}
+
+// serveOpenAPI returns a handler serving the encoded document
+func serveOpenAPI(routes []route) http.HandlerFunc {
+	doc, err := json.MarshalIndent(buildOpenAPI(routes), "", "  ")
+	if err != nil {
+		panic("encoding OpenAPI document: " + err.Error())
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(doc)
+	}
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+
+	"mon-api/handlers"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// route is one API endpoint. Method and Path form a Go 1.22 ServeMux
+// pattern; path wildcards like {id} are read with r.PathValue. The remaining
+// fields document the endpoint in the generated OpenAPI document.
+type route struct {
+	Method  string
+	Path    string
+	Handler http.HandlerFunc
+	Aliases []string // legacy paths served by the same handler
+	Raw     bool     // serve without gzip, for handlers that stream ranges of files
+	Public  bool     // serve without a session or API token
+
+	Operation string  // unique OpenAPI operationId
+	Summary   string  // one-line description
+	Tag       string  // OpenAPI tag grouping related operations
+	Query     []param // query string parameters
+	Request   any     // zero value of the JSON request body type, nil if none
+	Response  any     // zero value of the JSON response type
+	Status    int     // success status code, 200 if zero
+}
+
+// param documents a query string parameter
+type param struct {
+	Name        string
+	Description string
+}
+
+// listParams are the filter, search and paging parameters of list endpoints
+var listParams = []param{
+	{"tags", "Comma-separated tags; matches items with any of them"},
+	{"exclude_tags", "Comma-separated tags; hides items with any of them"},
+	{"advanced", "Boolean tag expression, e.g. web and (go or rust) and not old"},
+	{"keywords", "Search query: words, \"phrases\", field:value, tag:, created:/updated: and -negation"},
+	{"limit", "Page size, up to 1000; all matches when omitted"},
+	{"sort", "created_at, updated_at, title or relevance"},
+	{"order", "asc or desc"},
+	{"cursor", "next_cursor of the previous page"},
+}
+
+// renderParam asks for note descriptions as HTML
+var renderParam = param{"render", "html renders Markdown descriptions as HTML"}
+
+// aliasTypeParam selects the item type of tag alias endpoints
+var aliasTypeParam = param{"type", "Item type: bookmark, note or youtube"}
+
+// apiRoutes lists every API endpoint
+func apiRoutes(
+	bookmarks *handlers.BookmarkHandler,
+	notes *handlers.NoteHandler,
+	youtube *handlers.YoutubeHandler,
+	importExport *handlers.ImportExportHandler,
+	tagAliases *handlers.TagAliasHandler,
+	blobs *handlers.BlobHandler,
+	auth *handlers.AuthHandler,
+) []route {
+	return []route{
+		// Authentication
+		{
+			Method: http.MethodGet, Path: "/api/v1/auth/session", Handler: auth.GetSession, Public: true,
+			Operation: "getSession", Summary: "Tell whether the request is logged in and return the session's CSRF token", Tag: "auth",
+			Response: handlers.SessionResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v1/auth/setup", Handler: auth.Setup, Public: true,
+			Operation: "setupPassword", Summary: "Set the first password and log in", Tag: "auth",
+			Request: handlers.PasswordRequest{}, Response: handlers.SessionResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v1/auth/login", Handler: auth.Login, Public: true,
+			Operation: "login", Summary: "Log in with the password and get a session cookie", Tag: "auth",
+			Request: handlers.PasswordRequest{}, Response: handlers.SessionResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v1/auth/logout", Handler: auth.Logout,
+			Operation: "logout", Summary: "End the current session", Tag: "auth",
+			Response: handlers.AuthResponse{},
+		},
+		{
+			Method: http.MethodPut, Path: "/api/v1/auth/password", Handler: auth.ChangePassword,
+			Operation: "changePassword", Summary: "Change the password, ending every session", Tag: "auth",
+			Request: handlers.ChangePasswordRequest{}, Response: handlers.SessionResponse{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v1/auth/tokens", Handler: auth.GetTokens,
+			Operation: "listTokens", Summary: "List API tokens", Tag: "auth",
+			Response: handlers.TokensListResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v1/auth/tokens", Handler: auth.CreateToken,
+			Operation: "createToken", Summary: "Create a named API token; the token is only returned now", Tag: "auth",
+			Request: handlers.NewTokenRequest{}, Response: handlers.TokenResponse{}, Status: http.StatusCreated,
+		},
+		{
+			Method: http.MethodDelete, Path: "/api/v1/auth/tokens/{id}", Handler: auth.RevokeToken,
+			Operation: "revokeToken", Summary: "Revoke an API token", Tag: "auth",
+			Response: handlers.TokenResponse{},
+		},
+
+		// Bookmarks
+		{
+			Method: http.MethodGet, Path: "/api/v1/bookmarks", Handler: bookmarks.GetBookmarks, Aliases: []string{"/api/bookmark/list"},
+			Operation: "listBookmarks", Summary: "List bookmarks", Tag: "bookmarks", Query: listParams,
+			Response: handlers.BookmarksListResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v1/bookmarks", Handler: bookmarks.NewBookmark, Aliases: []string{"/api/bookmark/create"},
+			Operation: "createBookmark", Summary: "Create a bookmark", Tag: "bookmarks",
+			Request: handlers.NewBookmarkRequest{}, Response: handlers.BookmarkResponse{}, Status: http.StatusCreated,
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v1/bookmarks/tags", Handler: bookmarks.GetBookmarkTags, Aliases: []string{"/api/bookmark/tag/list"},
+			Operation: "listBookmarkTags", Summary: "List bookmark tags as \"tag,count\" entries", Tag: "bookmarks",
+			Response: handlers.TagsResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v1/bookmarks/check-duplicates", Handler: bookmarks.CheckDuplicates, Aliases: []string{"/api/bookmark/check-duplicates"},
+			Operation: "checkBookmarkDuplicates", Summary: "Find bookmarks with the same title or URL", Tag: "bookmarks",
+			Request: handlers.CheckDuplicatesRequest{}, Response: handlers.DuplicateCheckResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v1/bookmarks/bulk", Handler: bookmarks.BulkBookmarks, Aliases: []string{"/api/bookmark/bulk"},
+			Operation: "bulkBookmarks", Summary: "Apply delete, tag and set operations to many bookmarks", Tag: "bookmarks",
+			Request: handlers.BulkRequest{}, Response: handlers.BulkResponse{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v1/bookmarks/trash", Handler: bookmarks.GetBookmarkTrash,
+			Operation: "listBookmarkTrash", Summary: "List trashed bookmarks, most recently deleted first", Tag: "bookmarks",
+			Response: handlers.BookmarksListResponse{},
+		},
+		{
+			Method: http.MethodDelete, Path: "/api/v1/bookmarks/trash", Handler: bookmarks.EmptyBookmarkTrash,
+			Operation: "emptyBookmarkTrash", Summary: "Permanently delete all trashed bookmarks", Tag: "bookmarks",
+			Response: handlers.EmptyTrashResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v1/bookmarks/trash/{id}/restore", Handler: bookmarks.RestoreBookmark,
+			Operation: "restoreBookmark", Summary: "Restore a trashed bookmark", Tag: "bookmarks",
+			Response: handlers.BookmarkResponse{},
+		},
+		{
+			Method: http.MethodDelete, Path: "/api/v1/bookmarks/trash/{id}", Handler: bookmarks.PurgeBookmark,
+			Operation: "purgeBookmark", Summary: "Permanently delete a trashed bookmark", Tag: "bookmarks",
+			Response: handlers.DeleteBookmarkResponse{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v1/bookmarks/{id}", Handler: bookmarks.GetBookmark, Aliases: []string{"/api/bookmark/{id}"},
+			Operation: "getBookmark", Summary: "Get a bookmark", Tag: "bookmarks",
+			Response: handlers.BookmarkResponse{},
+		},
+		{
+			Method: http.MethodPut, Path: "/api/v1/bookmarks/{id}", Handler: bookmarks.EditBookmark, Aliases: []string{"/api/bookmark/edit/{id}"},
+			Operation: "updateBookmark", Summary: "Replace a bookmark", Tag: "bookmarks",
+			Request: handlers.EditBookmarkRequest{}, Response: handlers.BookmarkResponse{},
+		},
+		{
+			Method: http.MethodPatch, Path: "/api/v1/bookmarks/{id}", Handler: bookmarks.PatchBookmark,
+			Operation: "patchBookmark", Summary: "Update some fields or tags of a bookmark", Tag: "bookmarks",
+			Request: handlers.PatchBookmarkRequest{}, Response: handlers.BookmarkResponse{},
+		},
+		{
+			Method: http.MethodDelete, Path: "/api/v1/bookmarks/{id}", Handler: bookmarks.DeleteBookmark, Aliases: []string{"/api/bookmark/delete/{id}"},
+			Operation: "deleteBookmark", Summary: "Move a bookmark to the trash", Tag: "bookmarks",
+			Response: handlers.DeleteBookmarkResponse{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v1/bookmarks/{id}/backlinks", Handler: bookmarks.GetBookmarkBacklinks, Aliases: []string{"/api/bookmark/{id}/backlinks"},
+			Operation: "listBookmarkBacklinks", Summary: "List the items linking to a bookmark", Tag: "bookmarks",
+			Response: handlers.BacklinksResponse{},
+		},
+
+		// Notes
+		{
+			Method: http.MethodGet, Path: "/api/v1/notes", Handler: notes.GetNotes, Aliases: []string{"/api/note/list"},
+			Operation: "listNotes", Summary: "List notes", Tag: "notes", Query: slices.Concat(listParams, []param{renderParam}),
+			Response: handlers.NotesListResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v1/notes", Handler: notes.NewNote, Aliases: []string{"/api/note/create"},
+			Operation: "createNote", Summary: "Create a note", Tag: "notes",
+			Request: handlers.NewNoteRequest{}, Response: handlers.NoteResponse{}, Status: http.StatusCreated,
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v1/notes/tags", Handler: notes.GetNoteTags, Aliases: []string{"/api/note/tag/list"},
+			Operation: "listNoteTags", Summary: "List note tags as \"tag,count\" entries", Tag: "notes",
+			Response: handlers.NoteTagsResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v1/notes/bulk", Handler: notes.BulkNotes, Aliases: []string{"/api/note/bulk"},
+			Operation: "bulkNotes", Summary: "Apply delete, tag and set operations to many notes", Tag: "notes",
+			Request: handlers.BulkRequest{}, Response: handlers.BulkResponse{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v1/notes/trash", Handler: notes.GetNoteTrash,
+			Operation: "listNoteTrash", Summary: "List trashed notes, most recently deleted first", Tag: "notes",
+			Response: handlers.NotesListResponse{},
+		},
+		{
+			Method: http.MethodDelete, Path: "/api/v1/notes/trash", Handler: notes.EmptyNoteTrash,
+			Operation: "emptyNoteTrash", Summary: "Permanently delete all trashed notes", Tag: "notes",
+			Response: handlers.EmptyTrashResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v1/notes/trash/{id}/restore", Handler: notes.RestoreNote,
+			Operation: "restoreNote", Summary: "Restore a trashed note", Tag: "notes",
+			Response: handlers.NoteResponse{},
+		},
+		{
+			Method: http.MethodDelete, Path: "/api/v1/notes/trash/{id}", Handler: notes.PurgeNote,
+			Operation: "purgeNote", Summary: "Permanently delete a trashed note", Tag: "notes",
+			Response: handlers.DeleteNoteResponse{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v1/notes/{id}", Handler: notes.GetNote, Aliases: []string{"/api/note/{id}"},
+			Operation: "getNote", Summary: "Get a note", Tag: "notes", Query: []param{renderParam},
+			Response: handlers.NoteResponse{},
+		},
+		{
+			Method: http.MethodPut, Path: "/api/v1/notes/{id}", Handler: notes.EditNote, Aliases: []string{"/api/note/edit/{id}"},
+			Operation: "updateNote", Summary: "Replace a note", Tag: "notes",
+			Request: handlers.EditNoteRequest{}, Response: handlers.NoteResponse{},
+		},
+		{
+			Method: http.MethodPatch, Path: "/api/v1/notes/{id}", Handler: notes.PatchNote,
+			Operation: "patchNote", Summary: "Update some fields or tags of a note", Tag: "notes",
+			Request: handlers.PatchNoteRequest{}, Response: handlers.NoteResponse{},
+		},
+		{
+			Method: http.MethodDelete, Path: "/api/v1/notes/{id}", Handler: notes.DeleteNote, Aliases: []string{"/api/note/delete/{id}"},
+			Operation: "deleteNote", Summary: "Move a note to the trash", Tag: "notes",
+			Response: handlers.DeleteNoteResponse{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v1/notes/{id}/backlinks", Handler: notes.GetNoteBacklinks, Aliases: []string{"/api/note/{id}/backlinks"},
+			Operation: "listNoteBacklinks", Summary: "List the items linking to a note by ID or title", Tag: "notes",
+			Response: handlers.BacklinksResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v1/notes/{id}/convert", Handler: notes.ConvertNote,
+			Operation: "convertNote", Summary: "Rewrite a note's description as HTML or Markdown", Tag: "notes",
+			Request: handlers.ConvertNoteRequest{}, Response: handlers.NoteResponse{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v1/notes/{id}/revisions", Handler: notes.GetNoteRevisions, Aliases: []string{"/api/note/{id}/revisions"},
+			Operation: "listNoteRevisions", Summary: "List earlier versions of a note, newest first", Tag: "notes",
+			Response: handlers.NotesListResponse{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v1/notes/{id}/revisions/{rev}", Handler: notes.GetNoteRevision,
+			Operation: "getNoteRevision", Summary: "Get a note as it was at a version", Tag: "notes",
+			Response: handlers.NoteResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v1/notes/{id}/revisions/{rev}/restore", Handler: notes.RestoreNoteRevision, Aliases: []string{"/api/note/{id}/restore/{rev}"},
+			Operation: "restoreNoteRevision", Summary: "Restore an earlier version of a note as its newest version", Tag: "notes",
+			Response: handlers.NoteResponse{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v1/notes/{id}/diff", Handler: notes.GetNoteDiff,
+			Operation: "diffNote", Summary: "Compare two versions of a note", Tag: "notes",
+			Query: []param{
+				{"from", "Older version; defaults to the newest revision before to"},
+				{"to", "Newer version; defaults to the current version"},
+			},
+			Response: handlers.NoteDiffResponse{},
+		},
+
+		// YouTube videos
+		{
+			Method: http.MethodGet, Path: "/api/v1/youtube", Handler: youtube.GetYoutubeVideos, Aliases: []string{"/api/youtube/list"},
+			Operation: "listYoutubeVideos", Summary: "List YouTube videos", Tag: "youtube", Query: listParams,
+			Response: handlers.YoutubeVideosListResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v1/youtube", Handler: youtube.NewYoutubeVideo, Aliases: []string{"/api/youtube/create"},
+			Operation: "createYoutubeVideo", Summary: "Add a YouTube video", Tag: "youtube",
+			Request: handlers.NewYoutubeVideoRequest{}, Response: handlers.YoutubeVideoResponse{}, Status: http.StatusCreated,
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v1/youtube/tags", Handler: youtube.GetYoutubeTags, Aliases: []string{"/api/youtube/tag/list"},
+			Operation: "listYoutubeTags", Summary: "List YouTube video tags as \"tag,count\" entries", Tag: "youtube",
+			Response: handlers.YoutubeTagsResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v1/youtube/bulk", Handler: youtube.BulkYoutubeVideos, Aliases: []string{"/api/youtube/bulk"},
+			Operation: "bulkYoutubeVideos", Summary: "Apply delete, tag and set operations to many YouTube videos", Tag: "youtube",
+			Request: handlers.BulkRequest{}, Response: handlers.BulkResponse{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v1/youtube/trash", Handler: youtube.GetYoutubeTrash,
+			Operation: "listYoutubeTrash", Summary: "List trashed YouTube videos, most recently deleted first", Tag: "youtube",
+			Response: handlers.YoutubeVideosListResponse{},
+		},
+		{
+			Method: http.MethodDelete, Path: "/api/v1/youtube/trash", Handler: youtube.EmptyYoutubeTrash,
+			Operation: "emptyYoutubeTrash", Summary: "Permanently delete all trashed YouTube videos", Tag: "youtube",
+			Response: handlers.EmptyTrashResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v1/youtube/trash/{id}/restore", Handler: youtube.RestoreYoutubeVideo,
+			Operation: "restoreYoutubeVideo", Summary: "Restore a trashed YouTube video", Tag: "youtube",
+			Response: handlers.YoutubeVideoResponse{},
+		},
+		{
+			Method: http.MethodDelete, Path: "/api/v1/youtube/trash/{id}", Handler: youtube.PurgeYoutubeVideo,
+			Operation: "purgeYoutubeVideo", Summary: "Permanently delete a trashed YouTube video", Tag: "youtube",
+			Response: handlers.DeleteYoutubeVideoResponse{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v1/youtube/{id}", Handler: youtube.GetYoutubeVideo, Aliases: []string{"/api/youtube/{id}"},
+			Operation: "getYoutubeVideo", Summary: "Get a YouTube video", Tag: "youtube",
+			Response: handlers.YoutubeVideoResponse{},
+		},
+		{
+			Method: http.MethodPut, Path: "/api/v1/youtube/{id}", Handler: youtube.EditYoutubeVideo, Aliases: []string{"/api/youtube/edit/{id}"},
+			Operation: "updateYoutubeVideo", Summary: "Replace a YouTube video", Tag: "youtube",
+			Request: handlers.EditYoutubeVideoRequest{}, Response: handlers.YoutubeVideoResponse{},
+		},
+		{
+			Method: http.MethodPatch, Path: "/api/v1/youtube/{id}", Handler: youtube.PatchYoutubeVideo,
+			Operation: "patchYoutubeVideo", Summary: "Update some fields or tags of a YouTube video", Tag: "youtube",
+			Request: handlers.PatchYoutubeVideoRequest{}, Response: handlers.YoutubeVideoResponse{},
+		},
+		{
+			Method: http.MethodDelete, Path: "/api/v1/youtube/{id}", Handler: youtube.DeleteYoutubeVideo, Aliases: []string{"/api/youtube/delete/{id}"},
+			Operation: "deleteYoutubeVideo", Summary: "Move a YouTube video to the trash", Tag: "youtube",
+			Response: handlers.DeleteYoutubeVideoResponse{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v1/youtube/{id}/backlinks", Handler: youtube.GetYoutubeBacklinks, Aliases: []string{"/api/youtube/{id}/backlinks"},
+			Operation: "listYoutubeBacklinks", Summary: "List the items linking to a YouTube video", Tag: "youtube",
+			Response: handlers.BacklinksResponse{},
+		},
+
+		// Blobs
+		{
+			Method: http.MethodPost, Path: "/api/v1/blobs", Handler: blobs.UploadBlob,
+			Operation: "uploadBlob", Summary: "Upload a file as the request body or a multipart file field", Tag: "blobs",
+			Response: handlers.BlobResponse{}, Status: http.StatusCreated,
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v1/blobs/{sha}", Handler: blobs.GetBlob, Raw: true,
+			Operation: "getBlob", Summary: "Download a file, honoring Range requests", Tag: "blobs",
+			Query: []param{{"name", "File name for the Content-Disposition header"}},
+		},
+
+		// Import/Export
+		{
+			Method: http.MethodGet, Path: "/api/v1/export", Handler: importExport.ExportAll, Aliases: []string{"/api/export/"},
+			Operation: "exportAll", Summary: "Download all content as one JSON file, or a zip with attachments", Tag: "import-export",
+			Query:    []param{{"format", "json (default) or zip"}},
+			Response: handlers.ExportData{},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v1/import", Handler: importExport.ImportAll, Aliases: []string{"/api/import/"},
+			Operation: "importAll", Summary: "Import a JSON or zip export file, skipping duplicates", Tag: "import-export",
+			Request: handlers.ExportData{}, Response: handlers.ImportResponse{},
+		},
+
+		// Tag aliases
+		{
+			Method: http.MethodGet, Path: "/api/v1/tag-aliases", Handler: tagAliases.GetAliases, Aliases: []string{"/api/tag-aliases"},
+			Operation: "listTagAliases", Summary: "List aliases grouped by canonical tag", Tag: "tag-aliases", Query: []param{aliasTypeParam},
+			Response: handlers.TagAliasGroupsResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v1/tag-aliases/batch", Handler: tagAliases.SetAliasesBatch, Aliases: []string{"/api/tag-aliases/batch"},
+			Operation: "setTagAliases", Summary: "Map aliases to a canonical tag", Tag: "tag-aliases",
+			Request: handlers.SetAliasBatchRequest{}, Response: handlers.TagAliasResponse{},
+		},
+		{
+			Method: http.MethodDelete, Path: "/api/v1/tag-aliases", Handler: tagAliases.DeleteAlias, Aliases: []string{"/api/tag-aliases", "/api/tag-aliases/delete"},
+			Operation: "deleteTagAlias", Summary: "Remove one alias", Tag: "tag-aliases",
+			Query:    []param{aliasTypeParam, {"alias", "Alias to remove"}},
+			Response: handlers.TagAliasResponse{},
+		},
+		{
+			Method: http.MethodDelete, Path: "/api/v1/tag-aliases/group", Handler: tagAliases.DeleteAlias, Aliases: []string{"/api/tag-aliases/group"},
+			Operation: "deleteTagAliasGroup", Summary: "Remove all aliases of a canonical tag", Tag: "tag-aliases",
+			Query:    []param{aliasTypeParam, {"canonical", "Canonical tag whose aliases are removed"}},
+			Response: handlers.TagAliasResponse{},
+		},
+	}
+}
+
+// registerRoutes adds API routes and their legacy aliases to mux with gzip
+// compression. Routes that aren't public require a session or API token.
+// Requests whose path matches but method doesn't get a 405 with an Allow
+// header from the mux.
+func registerRoutes(mux *http.ServeMux, routes []route, db *badger.DB) {
+	for _, rt := range routes {
+		handler := rt.Handler
+		if !rt.Public {
+			handler = handlers.RequireAuth(db, handler)
+		}
+		if !rt.Raw {
+			handler = gzipMiddleware(handler)
+		}
+		mux.HandleFunc(rt.Method+" "+rt.Path, handler)
+		for _, alias := range rt.Aliases {
+			mux.HandleFunc(rt.Method+" "+alias, handler)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRouteQueriesDontShareListParams(t *testing.T) {
+	routes := apiRoutes(nil, nil, nil, nil, nil, nil, nil)
+	for _, rt := range routes {
+		if len(rt.Query) == 0 || len(rt.Query) == len(listParams) {
+			continue
+		}
+		// A route extending listParams must own its slice, or appending to
+		// it could overwrite parameters of other routes
+		if &rt.Query[0] == &listParams[0] {
+			t.Errorf("%s %s: query parameters share listParams' array", rt.Method, rt.Path)
+		}
+		if rt.Operation == "listNotes" && !slices.Contains(rt.Query, renderParam) {
+			t.Errorf("listNotes lacks the render parameter")
+		}
+	}
+	if slices.Contains(listParams, renderParam) {
+		t.Errorf("listParams was changed to include the render parameter")
+	}
+}
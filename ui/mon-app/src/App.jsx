@@ -6,8 +6,11 @@ import YoutubeWatchlist from 'pages/YoutubeWatchlist/YoutubeWatchlist'
 import Notes from 'pages/Notes/Notes'
 import Settings from 'pages/Settings/Settings'
 import NotFound from 'pages/NotFound/NotFound'
+import Login from 'pages/Login/Login'
+import { useAuth } from 'contexts/AuthContext'
 
 function App() {
+  const { session, logout } = useAuth()
   const [activeSection, setActiveSection] = useState('home')
 
   const navigationItems = [
@@ -62,6 +65,14 @@ function App() {
   }
 
   const renderContent = () => {
+    // Ask for the password until the session is confirmed
+    if (!session) {
+      return <div className="section-content"><p>Loading…</p></div>
+    }
+    if (!session.authenticated) {
+      return <Login />
+    }
+
     switch (activeSection) {
       case 'home':
         return <Home />
@@ -103,6 +114,12 @@ function App() {
               ))}
             </ul>
           </nav>
+
+          {session?.authenticated && (
+            <button className="nav-button logout-button" onClick={logout}>
+              Log Out
+            </button>
+          )}
         </div>
       </header>
 
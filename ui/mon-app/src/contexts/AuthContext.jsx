@@ -0,0 +1,92 @@
+import { createContext, useContext, useState, useEffect, useCallback } from 'react'
+
+const API_BASE = 'http://localhost:8081/api'
+
+const AuthContext = createContext()
+
+// CSRF token of the current session, sent with every write
+let csrfToken = ''
+// Called when the API answers 401 so the app can ask for the password again
+let onUnauthorized = () => {}
+
+// fetch for API calls: sends the session cookie and, for writes, the CSRF token
+export const apiFetch = async (url, options = {}) => {
+  if (!String(url).startsWith(API_BASE)) {
+    return fetch(url, options)
+  }
+
+  const method = (options.method || 'GET').toUpperCase()
+  const headers = new Headers(options.headers)
+  if (!['GET', 'HEAD', 'OPTIONS'].includes(method) && csrfToken) {
+    headers.set('X-CSRF-Token', csrfToken)
+  }
+
+  const response = await fetch(url, { ...options, headers, credentials: 'include' })
+  if (response.status === 401) {
+    onUnauthorized()
+  }
+  return response
+}
+
+export const useAuth = () => {
+  const context = useContext(AuthContext)
+  if (!context) {
+    throw new Error('useAuth must be used within an AuthProvider')
+  }
+  return context
+}
+
+export const AuthProvider = ({ children }) => {
+  const [session, setSession] = useState(null) // null while loading
+
+  const applySession = useCallback((info) => {
+    csrfToken = info?.csrf_token || ''
+    setSession(info || { authenticated: false })
+  }, [])
+
+  const refresh = useCallback(async () => {
+    try {
+      const res = await fetch(`${API_BASE}/v1/auth/session`, { credentials: 'include' })
+      const data = await res.json()
+      applySession(data.data)
+    } catch (err) {
+      console.error('Error checking session:', err)
+      applySession({ authenticated: false, error: 'Could not reach the server' })
+    }
+  }, [applySession])
+
+  // Check the session on mount and whenever an API call is refused
+  useEffect(() => {
+    onUnauthorized = () => applySession({ authenticated: false })
+    refresh()
+  }, [refresh, applySession])
+
+  // Set the first password (setup) or log in with it
+  const login = async (password, setup = false) => {
+    const res = await fetch(`${API_BASE}/v1/auth/${setup ? 'setup' : 'login'}`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      credentials: 'include',
+      body: JSON.stringify({ password })
+    })
+    const data = await res.json()
+    if (!res.ok || !data.success) {
+      throw new Error(data.message || 'Login failed')
+    }
+    applySession(data.data)
+  }
+
+  const logout = async () => {
+    try {
+      await apiFetch(`${API_BASE}/v1/auth/logout`, { method: 'POST' })
+    } finally {
+      applySession({ authenticated: false })
+    }
+  }
+
+  return (
+    <AuthContext.Provider value={{ session, login, logout, refresh }}>
+      {children}
+    </AuthContext.Provider>
+  )
+}
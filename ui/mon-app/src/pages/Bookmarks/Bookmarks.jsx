@@ -3,6 +3,7 @@ import TagsFilter from 'components/TagsFilter/TagsFilter'
 import SearchInput from 'components/SearchInput/SearchInput'
 import Modal from 'components/Modal/Modal'
 import TagAutocompleteInput from 'components/TagAutocomplete/TagAutocompleteInput'
+import { apiFetch } from 'contexts/AuthContext'
 
 const Bookmarks = () => {
   // Debounce hook for performance optimization
@@ -56,8 +57,8 @@ const Bookmarks = () => {
       try {
         // Fetch both tags and bookmarks in parallel
         const [tagsResponse, bookmarksResponse] = await Promise.all([
-          fetch('http://localhost:8081/api/bookmark/tag/list'),
-          fetch('http://localhost:8081/api/bookmark/list')
+          apiFetch('http://localhost:8081/api/bookmark/tag/list'),
+          apiFetch('http://localhost:8081/api/bookmark/list')
         ])
         
         const [tagsData, bookmarksData] = await Promise.all([
@@ -145,7 +146,7 @@ const Bookmarks = () => {
         url += `?${params.toString()}`
       }
       
-      const response = await fetch(url)
+      const response = await apiFetch(url)
       const data = await response.json()
       
       if (data.success) {
@@ -172,7 +173,7 @@ const Bookmarks = () => {
   const fetchTags = useCallback(async () => {
     try {
       setTagsLoading(true)
-      const response = await fetch('http://localhost:8081/api/bookmark/tag/list')
+      const response = await apiFetch('http://localhost:8081/api/bookmark/tag/list')
       const data = await response.json()
       
       if (data.success) {
@@ -197,7 +198,7 @@ const Bookmarks = () => {
     try {
       setCheckingDuplicates(true)
       
-      const response = await fetch('http://localhost:8081/api/bookmark/check-duplicates', {
+      const response = await apiFetch('http://localhost:8081/api/bookmark/check-duplicates', {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
@@ -280,7 +281,7 @@ const Bookmarks = () => {
       
       const method = editingBookmark ? 'PUT' : 'POST'
 
-      const response = await fetch(url, {
+      const response = await apiFetch(url, {
         method: method,
         headers: {
           'Content-Type': 'application/json',
@@ -450,7 +451,7 @@ const Bookmarks = () => {
     }
 
     try {
-      const response = await fetch(`http://localhost:8081/api/bookmark/delete/${bookmark.id}`, {
+      const response = await apiFetch(`http://localhost:8081/api/bookmark/delete/${bookmark.id}`, {
         method: 'DELETE',
       })
 
@@ -0,0 +1,86 @@
+import { useState } from 'react'
+import { useAuth } from 'contexts/AuthContext'
+
+function Login() {
+  const { session, login } = useAuth()
+  const [password, setPassword] = useState('')
+  const [confirm, setConfirm] = useState('')
+  const [error, setError] = useState('')
+  const [submitting, setSubmitting] = useState(false)
+
+  const setup = session?.setup_required
+
+  const handleSubmit = async (e) => {
+    e.preventDefault()
+    setError('')
+    if (setup && password !== confirm) {
+      setError('Passwords do not match')
+      return
+    }
+
+    setSubmitting(true)
+    try {
+      await login(password, setup)
+    } catch (err) {
+      setError(err.message)
+    } finally {
+      setSubmitting(false)
+    }
+  }
+
+  return (
+    <div className="section-content login-page">
+      <div className="settings-section">
+        <h3>{setup ? 'Set a password' : 'Log in'}</h3>
+        <p className="settings-description">
+          {setup
+            ? 'Choose the password that protects your bookmarks, notes and videos. It must be at least 8 characters.'
+            : 'Enter your password to continue.'}
+        </p>
+
+        {session?.error && <div className="error-message">{session.error}</div>}
+
+        <form className="settings-form" onSubmit={handleSubmit}>
+          <div className="form-group">
+            <label htmlFor="password">Password</label>
+            <input
+              id="password"
+              type="password"
+              className="settings-input"
+              value={password}
+              onChange={e => setPassword(e.target.value)}
+              autoComplete={setup ? 'new-password' : 'current-password'}
+              autoFocus
+              required
+            />
+          </div>
+
+          {setup && (
+            <div className="form-group">
+              <label htmlFor="confirm-password">Confirm Password</label>
+              <input
+                id="confirm-password"
+                type="password"
+                className="settings-input"
+                value={confirm}
+                onChange={e => setConfirm(e.target.value)}
+                autoComplete="new-password"
+                required
+              />
+            </div>
+          )}
+
+          {error && <div className="error-message">{error}</div>}
+
+          <div className="settings-actions">
+            <button type="submit" className="save-button" disabled={submitting}>
+              {submitting ? 'Please wait…' : setup ? 'Set Password' : 'Log In'}
+            </button>
+          </div>
+        </form>
+      </div>
+    </div>
+  )
+}
+
+export default Login
@@ -4,6 +4,7 @@ import TagsFilter from 'components/TagsFilter/TagsFilter'
 import SearchInput from 'components/SearchInput/SearchInput'
 import Modal from 'components/Modal/Modal'
 import TagAutocompleteInput from 'components/TagAutocomplete/TagAutocompleteInput'
+import { apiFetch } from 'contexts/AuthContext'
 
 const Notes = () => {
   // Debounce hook for performance optimization
@@ -53,8 +54,8 @@ const Notes = () => {
       try {
         // Fetch both tags and notes in parallel
         const [tagsResponse, notesResponse] = await Promise.all([
-          fetch('http://localhost:8081/api/note/tag/list'),
-          fetch('http://localhost:8081/api/note/list')
+          apiFetch('http://localhost:8081/api/note/tag/list'),
+          apiFetch('http://localhost:8081/api/note/list?render=html')
         ])
         
         const [tagsData, notesData] = await Promise.all([
@@ -99,6 +100,9 @@ const Notes = () => {
       let url = 'http://localhost:8081/api/note/list'
       const params = new URLSearchParams()
       
+      // Markdown notes come back rendered, ready for display and the editor
+      params.append('render', 'html')
+      
       if (filterMode === 'include' && selectedTags.length > 0) {
         // Include mode: send selected tags to show notes with any of these tags
         params.append('tags', selectedTags.join(','))
@@ -143,7 +147,7 @@ const Notes = () => {
         url += `?${params.toString()}`
       }
       
-      const response = await fetch(url)
+      const response = await apiFetch(url)
       const notesData = await response.json()
       
       if (notesData.success) {
@@ -170,7 +174,7 @@ const Notes = () => {
   const fetchTags = useCallback(async () => {
     try {
       setTagsLoading(true)
-      const response = await fetch('http://localhost:8081/api/note/tag/list')
+      const response = await apiFetch('http://localhost:8081/api/note/tag/list')
       const data = await response.json()
       
       if (data.success) {
@@ -212,7 +216,7 @@ const Notes = () => {
 
       const method = editingNote ? 'PUT' : 'POST'
 
-      const response = await fetch(url, {
+      const response = await apiFetch(url, {
         method: method,
         headers: {
           'Content-Type': 'application/json',
@@ -220,12 +224,22 @@ const Notes = () => {
         body: JSON.stringify({
           title: formData.title.trim(),
           description: formData.description.trim(),
+          format: formData.format,
           tags: tags
         })
       })
 
       const data = await response.json()
       
+      if (data.success && data.data.format === 'markdown') {
+        // The list shows Markdown notes rendered, like the server lists them
+        const rendered = await apiFetch(`http://localhost:8081/api/v1/notes/${data.data.id}?render=html`)
+        const renderedData = await rendered.json()
+        if (renderedData.success) {
+          data.data = renderedData.data
+        }
+      }
+
       if (data.success) {
         // Reset form
         setFormData({ title: '', description: '', tags: [] })
@@ -262,12 +276,30 @@ const Notes = () => {
     }
   }
 
-  const editNote = (note) => {
+  const editNote = async (note) => {
+    // The list holds Markdown rendered as HTML and marked as HTML; edit the
+    // stored source and format instead
+    let source = note
+    try {
+      const response = await apiFetch(`http://localhost:8081/api/v1/notes/${note.id}`)
+      const data = await response.json()
+      if (data.success) {
+        source = data.data
+      }
+    } catch (err) {
+      console.error('Error loading note:', err)
+    }
+    if (source === note) {
+      alert('Could not load the note for editing')
+      return
+    }
+
     setEditingNote(note)
     setFormData({
-      title: note.title,
-      description: note.description,
-      tags: note.tags || []
+      title: source.title,
+      description: source.description,
+      format: source.format || 'html',
+      tags: source.tags || []
     })
     setShowModal(true)
   }
@@ -385,7 +417,7 @@ const Notes = () => {
     }
 
     try {
-      const response = await fetch(`http://localhost:8081/api/note/delete/${note.id}`, {
+      const response = await apiFetch(`http://localhost:8081/api/note/delete/${note.id}`, {
         method: 'DELETE',
       })
 
@@ -622,11 +654,22 @@ const Notes = () => {
 
           <div className="form-group">
             <label htmlFor="description">Description</label>
-            <WysiwygEditor
-              value={formData.description}
-              onChange={(value) => setFormData(prev => ({ ...prev, description: value }))}
-              placeholder="Enter note description with formatting..."
-            />
+            {formData.format === 'markdown' ? (
+              <textarea
+                id="description"
+                className="settings-textarea"
+                rows="12"
+                value={formData.description}
+                onChange={(e) => setFormData(prev => ({ ...prev, description: e.target.value }))}
+                placeholder="Enter the note in Markdown..."
+              />
+            ) : (
+              <WysiwygEditor
+                value={formData.description}
+                onChange={(value) => setFormData(prev => ({ ...prev, description: value }))}
+                placeholder="Enter note description with formatting..."
+              />
+            )}
           </div>
 
           <div className="form-group">
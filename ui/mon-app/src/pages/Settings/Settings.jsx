@@ -1,5 +1,6 @@
 import { useState, useEffect } from 'react'
 import { useTheme } from 'contexts/ThemeContext'
+import { apiFetch, useAuth } from 'contexts/AuthContext'
 
 function Settings() {
   const { theme, toggleTheme } = useTheme()
@@ -19,6 +20,12 @@ function Settings() {
   const [exporting, setExporting] = useState(false)
   const [importing, setImporting] = useState(false)
   const [importSummary, setImportSummary] = useState(null)
+  // Password and API token state
+  const { refresh } = useAuth()
+  const [passwords, setPasswords] = useState({ current: '', next: '' })
+  const [tokens, setTokens] = useState([])
+  const [tokenName, setTokenName] = useState('')
+  const [newToken, setNewToken] = useState(null)
 
   // Load settings from localStorage on component mount
   useEffect(() => {
@@ -44,8 +51,8 @@ function Settings() {
             ? 'http://localhost:8081/api/note/tag/list'
             : 'http://localhost:8081/api/youtube/tag/list'
         const [tagsRes, aliasRes] = await Promise.all([
-          fetch(tagURL),
-          fetch(`http://localhost:8081/api/tag-aliases?type=${tagType}`)
+          apiFetch(tagURL),
+          apiFetch(`http://localhost:8081/api/tag-aliases?type=${tagType}`)
         ])
         const tagsJson = await tagsRes.json().catch(() => null)
         const aliasJson = await aliasRes.json().catch(() => null)
@@ -76,7 +83,7 @@ function Settings() {
     const aliases = aliasCandidates.split(',').map(s => s.trim()).filter(Boolean)
     if (!canonical || aliases.length === 0) return alert('Enter canonical and at least one alias')
     try {
-      const res = await fetch('http://localhost:8081/api/tag-aliases/batch', {
+      const res = await apiFetch('http://localhost:8081/api/tag-aliases/batch', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ type: tagType, canonical, aliases })
@@ -84,7 +91,7 @@ function Settings() {
       if (!res.ok) throw new Error('Failed to save aliases')
       setAliasCanonical('')
       setAliasCandidates('')
-      const aliasRes = await fetch(`http://localhost:8081/api/tag-aliases?type=${tagType}`)
+      const aliasRes = await apiFetch(`http://localhost:8081/api/tag-aliases?type=${tagType}`)
       const aliasJson = await aliasRes.json().catch(() => null)
       if (aliasRes.ok && aliasJson?.data) setAliasGroups(aliasJson.data)
     } catch (e) {
@@ -96,7 +103,7 @@ function Settings() {
   const removeAlias = async (canonical, alias) => {
     try {
       const url = `http://localhost:8081/api/tag-aliases/delete?type=${encodeURIComponent(tagType)}&alias=${encodeURIComponent(alias)}`
-      const res = await fetch(url, { method: 'DELETE' })
+      const res = await apiFetch(url, { method: 'DELETE' })
       if (!res.ok) throw new Error('Failed')
       setAliasGroups(prev => {
         const next = { ...prev }
@@ -113,7 +120,7 @@ function Settings() {
   const removeGroup = async (canonical) => {
     try {
       const url = `http://localhost:8081/api/tag-aliases/group?type=${encodeURIComponent(tagType)}&canonical=${encodeURIComponent(canonical)}`
-      const res = await fetch(url, { method: 'DELETE' })
+      const res = await apiFetch(url, { method: 'DELETE' })
       if (!res.ok) throw new Error('Failed')
       setAliasGroups(prev => {
         const next = { ...prev }
@@ -155,10 +162,72 @@ function Settings() {
     setSaved(false)
   }
 
+  // Load API tokens on mount
+  const fetchTokens = async () => {
+    try {
+      const res = await apiFetch('http://localhost:8081/api/v1/auth/tokens')
+      const data = await res.json()
+      if (data.success) setTokens(data.data || [])
+    } catch (e) {
+      console.error('Error loading API tokens:', e)
+    }
+  }
+
+  useEffect(() => {
+    fetchTokens()
+  }, [])
+
+  const handleCreateToken = async () => {
+    if (!tokenName.trim()) return
+    try {
+      const res = await apiFetch('http://localhost:8081/api/v1/auth/tokens', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ name: tokenName.trim() })
+      })
+      const data = await res.json()
+      if (!res.ok || !data.success) throw new Error(data.message || 'Failed to create token')
+      setNewToken(data.data)
+      setTokenName('')
+      fetchTokens()
+    } catch (e) {
+      alert(e.message)
+    }
+  }
+
+  const handleRevokeToken = async (token) => {
+    if (!confirm(`Revoke the API token "${token.name}"? Scripts using it will stop working.`)) return
+    try {
+      const res = await apiFetch(`http://localhost:8081/api/v1/auth/tokens/${token.id}`, { method: 'DELETE' })
+      if (!res.ok) throw new Error('Failed to revoke token')
+      fetchTokens()
+    } catch (e) {
+      alert(e.message)
+    }
+  }
+
+  const handleChangePassword = async () => {
+    try {
+      const res = await apiFetch('http://localhost:8081/api/v1/auth/password', {
+        method: 'PUT',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ current_password: passwords.current, new_password: passwords.next })
+      })
+      const data = await res.json()
+      if (!res.ok || !data.success) throw new Error(data.message || 'Failed to change password')
+      setPasswords({ current: '', next: '' })
+      // Every session ended; pick up the new one and its CSRF token
+      await refresh()
+      alert('Password changed')
+    } catch (e) {
+      alert(e.message)
+    }
+  }
+
   const handleExport = async () => {
     try {
       setExporting(true)
-      const res = await fetch('http://localhost:8081/api/export/')
+      const res = await apiFetch('http://localhost:8081/api/export/')
       if (!res.ok) throw new Error('Export failed')
       const blob = await res.blob()
       const disposition = res.headers.get('Content-Disposition') || ''
@@ -187,7 +256,7 @@ function Settings() {
       setImportSummary(null)
       const form = new FormData()
       form.append('file', file)
-      const res = await fetch('http://localhost:8081/api/import/', {
+      const res = await apiFetch('http://localhost:8081/api/import/', {
         method: 'POST',
         body: form
       })
@@ -373,6 +442,64 @@ function Settings() {
         </div>
       </div>
 
+      <div className="settings-section">
+        <h3>Security</h3>
+        <p className="settings-description">Change the password and manage API tokens for scripts. Changing the password logs out every other browser.</p>
+
+        <div className="settings-form">
+          <div className="form-group">
+            <label htmlFor="current-password">Current Password</label>
+            <input id="current-password" type="password" className="settings-input" autoComplete="current-password"
+                   value={passwords.current} onChange={e => setPasswords(p => ({ ...p, current: e.target.value }))} />
+          </div>
+          <div className="form-group">
+            <label htmlFor="new-password">New Password</label>
+            <input id="new-password" type="password" className="settings-input" autoComplete="new-password"
+                   value={passwords.next} onChange={e => setPasswords(p => ({ ...p, next: e.target.value }))} />
+            <small>At least 8 characters.</small>
+          </div>
+          <div className="settings-actions">
+            <button className="save-button" onClick={handleChangePassword} disabled={!passwords.current || !passwords.next}>
+              Change Password
+            </button>
+          </div>
+
+          <div className="form-group">
+            <label htmlFor="token-name">API Tokens</label>
+            <div style={{ display: 'flex', gap: 12 }}>
+              <input id="token-name" className="settings-input" value={tokenName} onChange={e => setTokenName(e.target.value)} placeholder="e.g. backup script" />
+              <button className="save-button" onClick={handleCreateToken} disabled={!tokenName.trim()}>Create</button>
+            </div>
+            <small>Send a token as <code>Authorization: Bearer &lt;token&gt;</code>.</small>
+          </div>
+          {newToken && (
+            <div className="form-group">
+              <small>Copy the token for "{newToken.name}" now; it won't be shown again:</small>
+              <input className="settings-input" readOnly value={newToken.token} onFocus={e => e.target.select()} />
+            </div>
+          )}
+          {tokens.length === 0 ? (
+            <small>No API tokens yet.</small>
+          ) : (
+            <div style={{ display: 'grid', gap: 8 }}>
+              {tokens.map(token => (
+                <div key={token.id} style={{ display: 'flex', gap: 12, alignItems: 'center', justifyContent: 'space-between' }}>
+                  <div>
+                    <strong>{token.name}</strong>
+                    <div style={{ fontSize: 12, opacity: 0.8 }}>
+                      Created {new Date(token.created_at).toLocaleDateString()}
+                      {' · '}
+                      {token.last_used_at ? `last used ${new Date(token.last_used_at).toLocaleDateString()}` : 'never used'}
+                    </div>
+                  </div>
+                  <button className="reset-button" onClick={() => handleRevokeToken(token)}>Revoke</button>
+                </div>
+              ))}
+            </div>
+          )}
+        </div>
+      </div>
+
       <div className="settings-section">
         <h3>Import / Export</h3>
         <p className="settings-description">Export all data to a JSON file or import from a previous export.</p>
@@ -3,6 +3,7 @@ import TagsFilter from 'components/TagsFilter/TagsFilter'
 import SearchInput from 'components/SearchInput/SearchInput'
 import Modal from 'components/Modal/Modal'
 import TagAutocompleteInput from 'components/TagAutocomplete/TagAutocompleteInput'
+import { apiFetch } from 'contexts/AuthContext'
 
 const YoutubeWatchlist = () => {
   // Debounce hook for performance optimization
@@ -68,8 +69,8 @@ const YoutubeWatchlist = () => {
       try {
         // Fetch both tags and videos in parallel
         const [tagsResponse, videosResponse] = await Promise.all([
-          fetch('http://localhost:8081/api/youtube/tag/list'),
-          fetch('http://localhost:8081/api/youtube/list')
+          apiFetch('http://localhost:8081/api/youtube/tag/list'),
+          apiFetch('http://localhost:8081/api/youtube/list')
         ])
         
         const [tagsData, videosData] = await Promise.all([
@@ -157,7 +158,7 @@ const YoutubeWatchlist = () => {
         url += `?${params.toString()}`
       }
       
-      const response = await fetch(url)
+      const response = await apiFetch(url)
       const data = await response.json()
       
       if (data.success) {
@@ -184,7 +185,7 @@ const YoutubeWatchlist = () => {
   const fetchTags = useCallback(async () => {
     try {
       setTagsLoading(true)
-      const response = await fetch('http://localhost:8081/api/youtube/tag/list')
+      const response = await apiFetch('http://localhost:8081/api/youtube/tag/list')
       const data = await response.json()
       
       if (data.success) {
@@ -226,7 +227,7 @@ const YoutubeWatchlist = () => {
       
       const method = editingVideo ? 'PUT' : 'POST'
 
-      const response = await fetch(url, {
+      const response = await apiFetch(url, {
         method: method,
         headers: {
           'Content-Type': 'application/json',
@@ -395,7 +396,7 @@ const YoutubeWatchlist = () => {
     }
 
     try {
-      const response = await fetch(`http://localhost:8081/api/youtube/delete/${video.id}`, {
+      const response = await apiFetch(`http://localhost:8081/api/youtube/delete/${video.id}`, {
         method: 'DELETE',
       })
 